@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"lcheck/checker"
+)
+
+// ================= Result cache =================
+
+// fileCache is a checker.Cache of one JSON file per key result, in a
+// directory shared by every run. The files are named by the checker's id
+// of the result and by the build of lcheck, so that a rebuilt lcheck
+// starts afresh.
+type fileCache struct {
+	dir   string
+	build string
+	// refresh ignores the stored results, checking every key again and
+	// replacing what was stored
+	refresh bool
+	// warned is done once a result could not be stored
+	warned sync.Once
+}
+
+// defaultCacheDir is where results are cached unless -cache-dir says
+// otherwise, or "" if the user has no cache directory.
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "lcheck")
+}
+
+// openCache returns the cache in dir for this build of lcheck.
+func openCache(dir string, refresh bool) (*fileCache, error) {
+	build, err := buildId()
+	if err != nil {
+		return nil, err
+	}
+	return &fileCache{dir: dir, build: build, refresh: refresh}, nil
+}
+
+// buildId identifies this build of lcheck: its version and a hash of its
+// executable, which changes with every rebuild of a "dev" version too.
+func buildId() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("finding the lcheck executable: %v", err)
+	}
+	f, err := os.Open(exe)
+	if err != nil {
+		return "", fmt.Errorf("reading the lcheck executable: %v", err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	fmt.Fprintln(h, versionString())
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("reading the lcheck executable: %v", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// path returns the file of the result stored under id.
+func (c *fileCache) path(id string) string {
+	sum := sha256.Sum256([]byte(c.build + "\n" + id))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(c.dir, name[:2], name+".json")
+}
+
+func (c *fileCache) Get(id string) (checker.CacheEntry, bool) {
+	var e checker.CacheEntry
+	if c.refresh {
+		return e, false
+	}
+	data, err := os.ReadFile(c.path(id))
+	if err != nil || json.Unmarshal(data, &e) != nil {
+		return checker.CacheEntry{}, false
+	}
+	return e, true
+}
+
+// Put writes the file through a temporary file renamed into place, so
+// that a concurrent run never reads half of it. A result that cannot be
+// stored is only warned about, once: the run is correct without it.
+func (c *fileCache) Put(id string, e checker.CacheEntry) {
+	data, err := json.Marshal(e)
+	if err == nil {
+		err = writeFileAtomic(c.path(id), data)
+	}
+	if err != nil {
+		c.warned.Do(func() { fmt.Fprintf(checker.Warnings, "Warning: cannot cache the results: %v\n", err) })
+	}
+}
+
+// writeFileAtomic writes data to path, creating its directory.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
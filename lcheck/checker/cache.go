@@ -0,0 +1,129 @@
+package checker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// ================= Result cache =================
+
+// cacheVersion changes whenever what a cached result means does, so that
+// results of an older checker are not restored. Version 1 also cached keys
+// that timed out.
+const cacheVersion = 2
+
+// A Cache stores the results of key checks by an id of everything the
+// result depends on: the key's events and the options it was checked with.
+// Only Ok and Illegal results are stored; a key that timed out is checked
+// again. Its methods may be called concurrently.
+type Cache interface {
+	// Get returns the result stored under id, if any
+	Get(id string) (CacheEntry, bool)
+	// Put stores a result under id, replacing any stored before
+	Put(id string, c CacheEntry)
+}
+
+// CacheEntry is the part of a KeyResult that a Cache stores: enough to
+// report and explain the result without checking the key again. It does not
+// hold porcupine's LinearizationInfo, which cannot be stored, so a restored
+// result has an empty Info.
+type CacheEntry struct {
+	Result  porcupine.CheckResult `json:"result"`
+	Elapsed time.Duration         `json:"elapsed"`
+	Timed   bool                  `json:"timed,omitempty"`
+	// Partials are the partial linearizations of a result that is not Ok,
+	// as Info.PartialLinearizations returns them
+	Partials [][][]int `json:"partials,omitempty"`
+	// Order is the longest order CheckSequential or CheckClientOrder found
+	Order []int `json:"order,omitempty"`
+	// Stale holds the read and write of each stale read CheckReadYourWrites
+	// found, as operation ids
+	Stale [][2]int `json:"stale,omitempty"`
+	// Unwritten holds the reads CheckEventual found to return values not
+	// written yet, as operation ids
+	Unwritten []int `json:"unwritten,omitempty"`
+	// Counterexample lists the operations of the key's minimal failing
+	// slice, numbered in order of first appearance, once it was shrunk
+	Counterexample []int `json:"counterexample,omitempty"`
+}
+
+// cacheId returns the id a key's result is cached under: a hash of its
+// events and of the options that affect checking them.
+func cacheId(key string, evs []porcupine.Event, opts Options) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "lcheck %d %q model=%q sequential=%t ryw=%t eventual=%t client-order=%t whole=%t timeout=%d/%d\n", cacheVersion, key, opts.Model,
+		opts.Sequential, opts.ReadYourWrites, opts.Eventual, opts.ClientOrder, opts.WholeHistory, opts.keyTimeout(len(evs)), opts.Timeout)
+	// The whole history's model starts every key at its initial value
+	var inits []string
+	for k, v := range opts.InitValues {
+		if opts.WholeHistory || k == key {
+			inits = append(inits, fmt.Sprintf("%q=%q", k, v))
+		}
+	}
+	sort.Strings(inits)
+	fmt.Fprintln(h, inits)
+	for _, ev := range evs {
+		v := ev.Value.(InputOutput)
+		fmt.Fprintf(h, "%v %d %d %d %q %q %t %t %q %t %t %d %d %t %d\n", ev.Kind, ev.ClientId, ev.Id,
+			v.Op, v.Key, v.Value, v.None, v.Deleted, v.Old, v.OldNone, v.OldDeleted, v.Delta, v.Time.UnixNano(), v.Pending, v.Multi)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// CacheEntry returns what a Cache stores of the key's result, with the minimal
+// failing slice Counterexample returned for it, if any.
+func (r KeyResult) CacheEntry(counterexample []porcupine.Event) CacheEntry {
+	c := CacheEntry{Result: r.Result, Elapsed: r.Elapsed, Timed: r.Timed, Order: r.order, Unwritten: r.unwritten}
+	if r.Result != porcupine.Ok && !r.searched() && !r.ReadYourWrites && !r.Eventual {
+		c.Partials = r.partialLinearizations()
+	}
+	for _, s := range r.stale {
+		c.Stale = append(c.Stale, [2]int{s.read, s.write})
+	}
+	if counterexample != nil {
+		in := make(map[int]bool)
+		for _, ev := range counterexample {
+			in[ev.Id] = true
+		}
+		for i, id := range opOrder(r.Events) {
+			if in[id] {
+				c.Counterexample = append(c.Counterexample, i)
+			}
+		}
+	}
+	return c
+}
+
+// restore rebuilds the result of a key from what a Cache stored of it.
+func (c CacheEntry) restore(r KeyResult) KeyResult {
+	r.Result, r.Elapsed, r.Timed, r.order, r.unwritten = c.Result, c.Elapsed, c.Timed, c.Order, c.Unwritten
+	r.Cached = true
+	r.partials = c.Partials
+	for _, s := range c.Stale {
+		r.stale = append(r.stale, staleRead{read: s[0], write: s[1]})
+	}
+	if c.Counterexample != nil {
+		keep := make([]bool, len(opOrder(r.Events)))
+		for _, i := range c.Counterexample {
+			if i >= 0 && i < len(keep) {
+				keep[i] = true
+			}
+		}
+		r.shrunk = opEvents(r.Events, keep)
+	}
+	return r
+}
+
+// partialLinearizations returns the partial linearizations of the key's
+// check, from Info or, for a restored result, from the cache.
+func (r KeyResult) partialLinearizations() [][][]int {
+	if r.Cached {
+		return r.partials
+	}
+	return r.Info.PartialLinearizations()
+}
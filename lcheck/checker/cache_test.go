@@ -0,0 +1,84 @@
+package checker
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// mapCache is a Cache in memory
+type mapCache struct {
+	mu      sync.Mutex
+	entries map[string]CacheEntry
+}
+
+func (c *mapCache) Get(id string) (CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[id]
+	return e, ok
+}
+
+func (c *mapCache) Put(id string, e CacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[id] = e
+}
+
+func TestCheckKeysCache(t *testing.T) {
+	good := events([]porcupine.Operation{
+		op(1, 0, 1, put("a"), val("a")),
+		op(1, 2, 3, get(), val("a")),
+	})
+	bad := events([]porcupine.Operation{
+		op(1, 0, 1, put("a"), val("a")),
+		op(2, 2, 3, put("b"), val("b")),
+		op(1, 4, 5, get(), val("a")),
+	})
+	keys := []string{"good", "bad"}
+	grouped := map[string][]porcupine.Event{"good": good, "bad": bad}
+	cache := &mapCache{entries: make(map[string]CacheEntry)}
+	opts := Options{Cache: cache}
+
+	first := CheckKeys(keys, grouped, opts)
+	slice := first[1].Counterexample(0)
+	if first[0].Cached || first[1].Cached || len(cache.entries) != 2 {
+		t.Fatalf("first run: cached = %v, %v with %d entries; want 2 keys checked and stored",
+			first[0].Cached, first[1].Cached, len(cache.entries))
+	}
+
+	again := CheckKeys(keys, grouped, opts)
+	for i, r := range again {
+		if !r.Cached || r.Result != first[i].Result || r.Elapsed != first[i].Elapsed {
+			t.Errorf("%s: cached = %v, result = %v; want %v restored", r.Key, r.Cached, r.Result, first[i].Result)
+		}
+	}
+	if got, want := again[1].Violation().Lines(), first[1].Violation().Lines(); !reflect.DeepEqual(got, want) {
+		t.Errorf("restored violation = %q, want %q", got, want)
+	}
+	if got := again[1].Counterexample(0); !reflect.DeepEqual(got, slice) {
+		t.Errorf("restored counterexample = %v, want %v", got, slice)
+	}
+
+	// Different options or events are checked afresh
+	if r := CheckKeys(keys, grouped, Options{Cache: cache, Sequential: true}); r[0].Cached {
+		t.Error("a sequential check restored the linearizability result")
+	}
+	grouped["good"] = good[:2]
+	if r := CheckKeys(keys, grouped, opts); r[0].Cached || !r[1].Cached {
+		t.Errorf("after changing good: cached = %v, %v; want false, true", r[0].Cached, r[1].Cached)
+	}
+
+	// A timeout depends on the machine's load, so it is not stored
+	slow := map[string][]porcupine.Event{"slow": slowHistory(22)}
+	timeoutOpts := Options{Cache: cache, Timeout: 20 * time.Millisecond}
+	if r := CheckKeys([]string{"slow"}, slow, timeoutOpts)[0]; r.Result != porcupine.Unknown {
+		t.Fatalf("slow key: result = %v, want the check to time out", r.Result)
+	}
+	if r := CheckKeys([]string{"slow"}, slow, timeoutOpts)[0]; r.Cached {
+		t.Error("a timed-out result was restored from the cache")
+	}
+}
@@ -0,0 +1,871 @@
+// Package checker checks logged key-value histories for linearizability
+// with porcupine, or for sequential, read-your-writes or eventual
+// consistency. It parses client logs into porcupine events, splits them by
+// key and checks each key against a model of a single register, or the
+// whole history against a model of the store. Other models can be added
+// with RegisterModel.
+//
+// The lcheck command is a thin CLI over this package; a test harness can use
+// it directly:
+//
+//	events, stats, err := checker.ParseLogFormat(r, checker.DefaultFormat)
+//	... // stats.Warnings() lists the malformed lines
+//	res, err := checker.CheckEvents(events, checker.Options{Timeout: time.Minute})
+//	if res.Status != porcupine.Ok { ... }
+//
+// The events may as well be built in memory, and each key's result drawn
+// with KeyResult.Visualize:
+//
+//	events := []porcupine.Event{
+//		{Kind: porcupine.CallEvent, Value: checker.InputOutput{Op: checker.OpPut, Key: "k", Value: "v"}, Id: 0, ClientId: 1},
+//		{Kind: porcupine.ReturnEvent, Value: checker.InputOutput{Key: "k", Value: "v"}, Id: 0, ClientId: 1},
+//	}
+//	res, err := checker.CheckEvents(events, checker.Options{})
+//	r, _ := res.Key("k")
+//	err = r.Visualize(w)
+package checker
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anishathalye/porcupine"
+	"github.com/maruel/natural"
+)
+
+// Warnings receives the parse warnings of ParseLog, which has no MatchStats
+// to return them in. It is standard error unless set, which is not safe while
+// another goroutine parses; ParseLogFormat leaves it alone.
+var Warnings io.Writer = os.Stderr
+
+// MaxLineSize is the longest line, in bytes, that ParseLog, ParseLogFormat
+// and ParseJSONL read. A longer line fails the parse instead of ending it
+// silently, as big values may make lines longer than a bufio.Scanner's
+// default 64KB. The indexed and followed logs read lines of any length.
+var MaxLineSize = 64 << 20
+
+// ErrNoEvents is returned by CheckEvents for a history without a single
+// completed operation to check.
+var ErrNoEvents = errors.New("no events to check")
+
+// ================= Per-key check logic =================
+
+func SplitEventsByKey(events []porcupine.Event) map[string][]porcupine.Event {
+	grouped := make(map[string][]porcupine.Event)
+	for _, e := range events {
+		io := e.Value.(InputOutput)
+		grouped[io.Key] = append(grouped[io.Key], e)
+	}
+	return grouped
+}
+
+// SplitUnfinished separates the events of completed operations from the
+// call events of operations that never returned.
+func SplitUnfinished(events []porcupine.Event) (finished, pending []porcupine.Event) {
+	// 1. Identify which Call IDs actually finished (O(N) pass over the events slice)
+	finishedIds := make(map[int]bool)
+	for _, ev := range events {
+		if ev.Kind == porcupine.ReturnEvent {
+			// This ID corresponds to a completed operation
+			finishedIds[ev.Id] = true
+		}
+	}
+
+	// 2. Filter the events list (O(N) pass over the events slice)
+	for _, ev := range events {
+		// Keep all Return events (we already used them to populate finishedIds)
+		if ev.Kind == porcupine.ReturnEvent || finishedIds[ev.Id] {
+			finished = append(finished, ev)
+		} else {
+			// The call is dangling
+			pending = append(pending, ev)
+		}
+	}
+	return finished, pending
+}
+
+// PendingReturns synthesizes a return at the end of the history for each
+// unfinished call, so porcupine treats the operation as ongoing: it may take
+// effect at any point after its call, and its output is unknown.
+func PendingReturns(pending []porcupine.Event) []porcupine.Event {
+	returns := make([]porcupine.Event, len(pending))
+	for i, ev := range pending {
+		in := ev.Value.(InputOutput)
+		returns[i] = porcupine.Event{
+			ClientId: ev.ClientId,
+			Kind:     porcupine.ReturnEvent,
+			Value:    InputOutput{Op: in.Op, Key: in.Key, Pending: true},
+			Id:       ev.Id,
+		}
+	}
+	return returns
+}
+
+// Options configures how a history is checked. The zero value checks every
+// key without a timeout, one key per CPU at a time.
+type Options struct {
+	// Timeout bounds each per-key check; 0 means no timeout. When
+	// TimeoutPerEvent is set it is the ceiling of the scaled timeout.
+	Timeout time.Duration
+	// TimeoutPerEvent, if non-zero, scales each key's timeout with its
+	// number of events, so small keys don't get the budget of big ones
+	TimeoutPerEvent time.Duration
+	// MinTimeout is the floor of the scaled timeout
+	MinTimeout time.Duration
+	// Jobs is the number of keys checked concurrently; 0 means one per CPU
+	Jobs int
+	// WholeHistory checks all keys' operations as one history against a
+	// model of the whole store, instead of each key independently
+	WholeHistory bool
+	// IncludePending feeds unfinished operations to porcupine as ongoing
+	// operations instead of discarding them
+	IncludePending bool
+	// InitValues overrides the initial value of individual keys
+	InitValues map[string]string
+	// Model names the model keys are checked against: DefaultModel (also
+	// when empty) or one added with RegisterModel
+	Model string
+	// Tombstone, if set, is the value a read of a deleted key returns: a
+	// delete leaves its key deleted, which only reads of Tombstone observe,
+	// rather than unwritten, which only reads of NONE observe
+	Tombstone string
+	// NumericKeys holds names or glob patterns of keys whose values are
+	// numbers, compared by their value rather than as strings: a write of
+	// 007 reads back as 7. Their events are checked, and shown, with each
+	// value in canonical form. Other keys compare values as strings.
+	NumericKeys []string
+	// Format is the set of log line patterns to parse with; nil means
+	// DefaultFormat
+	Format *Format
+	// Keys, if non-empty, restricts the check to keys matching one of these
+	// names or glob patterns
+	Keys []string
+	// ExcludeKeys leaves out the keys matching one of these names or glob
+	// patterns, even if they match Keys
+	ExcludeKeys []string
+	// Clients, if non-empty, restricts the check to the operations of these
+	// clients; the operations of every other client are dropped
+	Clients []int
+	// Progress, if set, is called as the check of each key starts, with the
+	// key's position i of n among the keys being checked. It is called from
+	// the checking goroutines, so calls may be concurrent.
+	Progress func(i, n int, key string, events int)
+	// Sequential checks for sequential consistency (see CheckSequential)
+	// instead of linearizability
+	Sequential bool
+	// ReadYourWrites checks for read-your-writes consistency (see
+	// CheckReadYourWrites) instead of linearizability
+	ReadYourWrites bool
+	// Eventual checks only that every read returned a value written before
+	// it returned (see CheckEventual) instead of linearizability
+	Eventual bool
+	// ClientOrder checks for linearizability with each client's operations
+	// also taking effect in the order it called them (see
+	// CheckClientOrder), for clients that pipeline their requests
+	ClientOrder bool
+	// MaxEvents, if non-zero, skips the keys with more events than this
+	// instead of checking them; their result is Unknown
+	MaxEvents int
+	// MinOps, if non-zero, leaves out the keys with fewer operations than
+	// this as trivial, as Keys leaves out the keys it doesn't match
+	MinOps int
+	// FailFast stops checking further keys once one is not linearizable or
+	// its check timed out
+	FailFast bool
+	// Interrupt, if set, stops the check when it is closed: no further keys
+	// are started, and the keys being checked are abandoned, their checks
+	// left to run out in the background
+	Interrupt <-chan struct{}
+	// Cache, if set, holds the results of earlier checks: a key whose
+	// events and options are unchanged is restored from it instead of
+	// checked, and the result of every key checked is stored in it
+	Cache Cache
+}
+
+// keyTimeout returns the check timeout for a key with n events.
+func (o Options) keyTimeout(n int) time.Duration {
+	if o.TimeoutPerEvent == 0 {
+		return o.Timeout
+	}
+	t := o.TimeoutPerEvent * time.Duration(n)
+	if t < o.MinTimeout {
+		t = o.MinTimeout
+	}
+	if o.Timeout > 0 && t > o.Timeout {
+		t = o.Timeout
+	}
+	return t
+}
+
+// validate rejects options that cannot be checked with.
+func (o Options) validate() error {
+	if o.Timeout < 0 || o.TimeoutPerEvent < 0 || o.MinTimeout < 0 {
+		return errors.New("timeouts must not be negative")
+	}
+	if o.Jobs < 0 {
+		return errors.New("jobs must not be negative")
+	}
+	if o.MaxEvents < 0 {
+		return errors.New("max events must not be negative")
+	}
+	if o.MinOps < 0 {
+		return errors.New("min operations must not be negative")
+	}
+	models := 0
+	for _, on := range []bool{o.Sequential, o.ReadYourWrites, o.Eventual} {
+		if on {
+			models++
+		}
+	}
+	if models > 1 {
+		return errors.New("only one of sequential, read-your-writes and eventual consistency can be checked")
+	}
+	if o.ClientOrder && models > 0 {
+		return errors.New("client order only applies to linearizability")
+	}
+	if o.Model != "" && o.Model != DefaultModel {
+		if _, ok := registeredModel(o.Model); !ok {
+			return fmt.Errorf("unknown model %q (want one of %s)", o.Model, strings.Join(Models(), ", "))
+		}
+		if len(o.InitValues) > 0 {
+			return fmt.Errorf("initial values only apply to the %s model", DefaultModel)
+		}
+	}
+	if o.Tombstone == NoneValue {
+		return errors.New("the tombstone must not be NONE, which is read from unwritten keys")
+	}
+	patterns := append(o.Keys[:len(o.Keys):len(o.Keys)], o.ExcludeKeys...)
+	for _, p := range append(patterns, o.NumericKeys...) {
+		if _, err := filepath.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid key pattern %q: %v", p, err)
+		}
+	}
+	return nil
+}
+
+// SortKeys sorts keys in natural order, key_2 before key_10, the order
+// results are reported in. natural orders every two distinct keys, even
+// key_01 and key_1, so the order never depends on the order keys came in.
+func SortKeys(keys []string) {
+	sort.Sort(natural.StringSlice(keys))
+}
+
+// SortedKeys returns the keys of a history split by key, such as
+// SplitEventsByKey returns, in natural order (see SortKeys). Ranging over
+// the map itself would yield them in a different order on every run.
+func SortedKeys(grouped map[string][]porcupine.Event) []string {
+	keys := make([]string, 0, len(grouped))
+	for k := range grouped {
+		keys = append(keys, k)
+	}
+	SortKeys(keys)
+	return keys
+}
+
+// SelectKeys returns the keys matching any of the patterns (exact names or
+// globs, see filepath.Match), and the patterns that matched no key. With no
+// patterns every key is selected.
+func SelectKeys(keys, patterns []string) (selected, unmatched []string) {
+	if len(patterns) == 0 {
+		return keys, nil
+	}
+	hits := make([]bool, len(patterns))
+	for _, key := range keys {
+		keep := false
+		for i, p := range patterns {
+			if ok, _ := filepath.Match(p, key); ok || p == key {
+				hits[i] = true
+				keep = true
+			}
+		}
+		if keep {
+			selected = append(selected, key)
+		}
+	}
+	for i, p := range patterns {
+		if !hits[i] {
+			unmatched = append(unmatched, p)
+		}
+	}
+	return selected, unmatched
+}
+
+// ExcludeKeys returns the keys matching none of the patterns (exact names
+// or glob patterns), in order, and the keys left out.
+func ExcludeKeys(keys, patterns []string) (kept, excluded []string) {
+	if len(patterns) == 0 {
+		return keys, nil
+	}
+	for _, key := range keys {
+		drop := false
+		for _, p := range patterns {
+			if ok, _ := filepath.Match(p, key); ok || p == key {
+				drop = true
+				break
+			}
+		}
+		if drop {
+			excluded = append(excluded, key)
+		} else {
+			kept = append(kept, key)
+		}
+	}
+	return kept, excluded
+}
+
+// SelectBusyKeys returns the keys with at least minOps operations in
+// grouped, and the trivial keys with fewer, both in the order of keys.
+func SelectBusyKeys(keys []string, grouped map[string][]porcupine.Event, minOps int) (busy, trivial []string) {
+	if minOps == 0 {
+		return keys, nil
+	}
+	for _, k := range keys {
+		if len(opOrder(grouped[k])) < minOps {
+			trivial = append(trivial, k)
+		} else {
+			busy = append(busy, k)
+		}
+	}
+	return busy, trivial
+}
+
+// SelectClients returns the events of the given clients, in order, and the
+// clients that have no event. With no clients every event is selected.
+func SelectClients(events []porcupine.Event, clients []int) (selected []porcupine.Event, unmatched []int) {
+	if len(clients) == 0 {
+		return events, nil
+	}
+	hits := make(map[int]bool, len(clients))
+	for _, c := range clients {
+		hits[c] = false
+	}
+	for _, ev := range events {
+		if _, ok := hits[ev.ClientId]; ok {
+			hits[ev.ClientId] = true
+			selected = append(selected, ev)
+		}
+	}
+	for _, c := range clients {
+		if !hits[c] {
+			unmatched = append(unmatched, c)
+			hits[c] = true // list each client once
+		}
+	}
+	return selected, unmatched
+}
+
+// KeyResult is the outcome of one key's porcupine check
+type KeyResult struct {
+	Key    string
+	Events []porcupine.Event // the key's history as checked
+	Result porcupine.CheckResult
+	Info   porcupine.LinearizationInfo
+	// Model is the model the key was checked with, needed to visualize Info
+	Model   porcupine.Model
+	Elapsed time.Duration // time porcupine spent on the key
+	// Sequential is set if the key was checked for sequential consistency,
+	// which leaves Info empty
+	Sequential bool
+	// ReadYourWrites is set if the key was checked for read-your-writes
+	// consistency, which also leaves Info empty
+	ReadYourWrites bool
+	// Eventual is set if the key was checked for eventual consistency,
+	// which also leaves Info empty
+	Eventual bool
+	// ClientOrder is set if the key was checked for linearizability in
+	// each client's order, which also leaves Info empty
+	ClientOrder bool
+	// Skipped is set if the key had more than Options.MaxEvents events and
+	// was not checked, which makes Result Unknown
+	Skipped bool
+	// Timed is set if every event had a timestamp, so that the key was
+	// checked as operations spanning their logged times
+	Timed bool
+	// Cached is set if the result was restored from Options.Cache rather
+	// than checked; Info is then empty
+	Cached bool
+	// Err is set if the check failed, with a *PanicError, rather than
+	// deciding the key; Result is then Unknown
+	Err   error
+	order []int       // the longest order CheckSequential or CheckClientOrder found, if not Ok
+	stale []staleRead // the reads CheckReadYourWrites found stale
+	// the reads CheckEventual found to return values not written yet
+	unwritten []int
+	// The cache the result is stored in and its id there, and what was
+	// restored from it
+	cache    Cache
+	cacheId  string
+	partials [][][]int
+	shrunk   []porcupine.Event
+}
+
+// Violation explains an Illegal result; it is empty for other results.
+func (r KeyResult) Violation() Violation {
+	if r.Result != porcupine.Illegal {
+		return Violation{}
+	}
+	if r.Sequential {
+		return sequentialViolation(r.Events, r.Model, r.order)
+	}
+	if r.ClientOrder {
+		// The same search, whose prefix is linearizable
+		v := sequentialViolation(r.Events, r.Model, r.order)
+		v.sequential = false
+		return v
+	}
+	if r.ReadYourWrites {
+		return rywViolation(r.Events, r.Model, r.stale)
+	}
+	if r.Eventual {
+		return eventualViolation(r.Events, r.Model, r.unwritten)
+	}
+	return findViolation(r.Events, r.partialLinearizations(), r.Model)
+}
+
+// Progress tells how far the search of a key got before it stopped, to
+// judge whether a check that timed out would have finished with more time
+type Progress struct {
+	// Longest is the length of the longest linearizable, or sequentially
+	// consistent, prefix of the key's operations found
+	Longest int
+	// Operations is the number of operations of the key
+	Operations int
+	// Partials counts the distinct partial linearizations porcupine
+	// recorded where it had to backtrack; it is 0 for a sequential check
+	Partials int
+}
+
+// Progress returns how far the check of a key that timed out got. ok is
+// false for any other result, and if the check recorded no progress at
+// all.
+func (r KeyResult) Progress() (p Progress, ok bool) {
+	if r.Result != porcupine.Unknown || r.Skipped || r.Err != nil {
+		return Progress{}, false
+	}
+	p.Operations = len(opOrder(r.Events))
+	if r.searched() {
+		p.Longest = len(r.order)
+		return p, r.order != nil
+	}
+	partitions := r.partialLinearizations()
+	if len(partitions) == 0 {
+		return Progress{}, false
+	}
+	for _, partial := range partitions[0] {
+		if len(partial) > p.Longest {
+			p.Longest = len(partial)
+		}
+	}
+	p.Partials = len(partitions[0])
+	return p, true
+}
+
+// Concurrency returns the most operations of the key's history in flight at
+// once, each from its call to its return. The search of a check grows with
+// it far more than with the number of operations, so a key that times out
+// usually has a high one.
+func (r KeyResult) Concurrency() int {
+	open := make(map[int]bool)
+	peak := 0
+	for _, ev := range r.Events {
+		if ev.Kind == porcupine.CallEvent {
+			open[ev.Id] = true
+			if len(open) > peak {
+				peak = len(open)
+			}
+		} else {
+			delete(open, ev.Id)
+		}
+	}
+	return peak
+}
+
+// Visualizable reports whether porcupine can draw the key's result: the key
+// was checked by porcupine, and for an Illegal result Info holds the partial
+// linearizations that show where the check got stuck.
+func (r KeyResult) Visualizable() bool {
+	if r.searched() || r.ReadYourWrites || r.Eventual || r.Skipped || r.Err != nil {
+		return false
+	}
+	return r.Result != porcupine.Illegal || len(r.partialLinearizations()) > 0
+}
+
+// ErrNotVisualizable is returned by Visualize for a result that has no
+// linearization info to draw.
+var ErrNotVisualizable = errors.New("result cannot be visualized")
+
+// Visualize writes porcupine's interactive HTML visualization of the key's
+// check to w. A result that is not Visualizable, or was restored from the
+// cache and so has no Info, returns ErrNotVisualizable; Recheck the key's
+// Events to draw a cached result.
+func (r KeyResult) Visualize(w io.Writer) error {
+	if !r.Visualizable() || r.Cached {
+		return ErrNotVisualizable
+	}
+	return porcupine.Visualize(r.Model, r.Info, w)
+}
+
+// searched reports whether the key was checked by the search of
+// CheckSequential or CheckClientOrder rather than by porcupine.
+func (r KeyResult) searched() bool {
+	return r.Sequential || r.ClientOrder
+}
+
+// CheckKeys checks each key's events independently on a pool of opts.Jobs
+// workers. The results are indexed like keys; reporting and visualization
+// are left to the caller so that they happen in key order. With
+// opts.FailFast the results are only those of the keys checked before the
+// first failure, and once opts.Interrupt is closed those of the keys whose
+// check finished, in key order.
+func CheckKeys(keys []string, grouped map[string][]porcupine.Event, opts Options) []KeyResult {
+	jobs := opts.Jobs
+	if jobs == 0 {
+		jobs = runtime.NumCPU()
+	}
+	// mu guards results and checked, which abandoned checks may still write
+	var mu sync.Mutex
+	results := make([]KeyResult, len(keys))
+	checked := make([]bool, len(keys))
+	next := make(chan int)
+	// stop is closed on the first failure with opts.FailFast
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				r := checkKey(keys[i], grouped[keys[i]], i, len(keys), opts)
+				mu.Lock()
+				results[i], checked[i] = r, true
+				mu.Unlock()
+				if opts.FailFast && r.Result != porcupine.Ok {
+					stopOnce.Do(func() { close(stop) })
+				}
+			}
+		}()
+	}
+	interrupted := false
+dispatch:
+	for i := range keys {
+		select {
+		case next <- i:
+		case <-stop:
+			break dispatch
+		case <-opts.Interrupt:
+			interrupted = true
+			break dispatch
+		}
+	}
+	close(next)
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-opts.Interrupt:
+		interrupted = true
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !opts.FailFast && !interrupted {
+		return results
+	}
+	var done []KeyResult
+	for i, r := range results {
+		if checked[i] {
+			done = append(done, r)
+		}
+	}
+	return done
+}
+
+// checkKey checks the events of one key, the i-th of n being checked. A
+// panic of the check, as on an event with an unexpected value, is recovered
+// as the key's Err, so that the other keys are still checked.
+func checkKey(key string, evs []porcupine.Event, i, n int, opts Options) (r KeyResult) {
+	start := time.Now()
+	var g panicGuard
+	failed := func() KeyResult {
+		return KeyResult{Key: key, Events: evs, Result: porcupine.Unknown, Elapsed: time.Since(start), Err: g.err}
+	}
+	defer func() {
+		if g.record(recover()) {
+			r = failed()
+		}
+	}()
+	if opts.Tombstone != "" {
+		evs = markTombstones(evs, opts.Tombstone)
+	}
+	if len(opts.NumericKeys) > 0 {
+		evs, opts.InitValues = canonicalNumbers(evs, opts.InitValues, opts.NumericKeys)
+	}
+	if opts.MaxEvents > 0 && len(evs) > opts.MaxEvents {
+		return KeyResult{Key: key, Events: evs, Result: porcupine.Unknown, Skipped: true}
+	}
+	model := ModelFor(key, evs, opts.InitValues)
+	if opts.WholeHistory {
+		model = NewHistoryModel(evs, opts.InitValues)
+	}
+	if registered, ok := registeredModel(opts.Model); ok {
+		model = registered
+	}
+	r = KeyResult{Key: key, Events: evs, Model: model, Sequential: opts.Sequential, ReadYourWrites: opts.ReadYourWrites, Eventual: opts.Eventual, ClientOrder: opts.ClientOrder}
+	if opts.Cache != nil {
+		r.cache, r.cacheId = opts.Cache, cacheId(key, evs, opts)
+		if c, ok := opts.Cache.Get(r.cacheId); ok {
+			return c.restore(r)
+		}
+	}
+	if opts.Progress != nil {
+		opts.Progress(i, n, key, len(evs))
+	}
+	start = time.Now()
+	// porcupine steps the model on goroutines of its own, out of reach of
+	// the recover above
+	guarded := g.guard(model)
+	if opts.Sequential {
+		r.Result, r.order = CheckSequential(guarded, evs, opts.keyTimeout(len(evs)))
+	} else if opts.ReadYourWrites {
+		r.Result, r.stale = checkReadYourWrites(evs)
+	} else if opts.Eventual {
+		r.Result, r.unwritten = checkEventual(guarded, evs)
+	} else if opts.ClientOrder {
+		r.Result, r.order = CheckClientOrder(guarded, evs, opts.keyTimeout(len(evs)))
+	} else if ops, timed := timedOperations(evs); timed {
+		r.Timed = true
+		r.Result, r.Info = porcupine.CheckOperationsVerbose(guarded, ops, opts.keyTimeout(len(evs)))
+	} else {
+		r.Result, r.Info = porcupine.CheckEventsVerbose(guarded, evs, opts.keyTimeout(len(evs)))
+	}
+	if g.err != nil {
+		return failed()
+	}
+	r.Elapsed = time.Since(start)
+	// Whether a check times out depends on how loaded the machine was, so
+	// only a decided result is worth restoring
+	if r.cache != nil && r.Result != porcupine.Unknown {
+		r.cache.Put(r.cacheId, r.CacheEntry(nil))
+	}
+	return r
+}
+
+// A PanicError is the panic of a key's check, recovered by CheckKeys
+type PanicError struct {
+	Value interface{} // the value the check panicked with
+	Stack []byte      // the stack of the check as it panicked
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("check panicked: %v", e.Value)
+}
+
+// panicGuard holds the first panic recovered during a key's check
+type panicGuard struct {
+	once sync.Once
+	err  *PanicError
+}
+
+// record keeps v, the result of recover, and its stack if it is the first
+// panic. It reports whether there was a panic at all. It must be called
+// by the deferred function itself, so that the stack is the panic's.
+func (g *panicGuard) record(v interface{}) bool {
+	if v == nil {
+		return false
+	}
+	stack := debug.Stack()
+	g.once.Do(func() { g.err = &PanicError{Value: v, Stack: stack} })
+	return true
+}
+
+// guard returns model with the functions a check calls recovering their
+// panics into g. A function that panicked rejects the operation, or the
+// state, it was called with, and g fails the check once it returns.
+func (g *panicGuard) guard(model porcupine.Model) porcupine.Model {
+	init, step, equal := model.Init, model.Step, model.Equal
+	model.Init = func() (state interface{}) {
+		defer func() { g.record(recover()) }()
+		return init()
+	}
+	model.Step = func(state, input, output interface{}) (ok bool, next interface{}) {
+		defer func() {
+			if g.record(recover()) {
+				ok, next = false, state
+			}
+		}()
+		return step(state, input, output)
+	}
+	if equal != nil {
+		model.Equal = func(a, b interface{}) (eq bool) {
+			defer func() { g.record(recover()) }()
+			return equal(a, b)
+		}
+	}
+	return model
+}
+
+// Result is the outcome of checking a history
+type Result struct {
+	// Status is Illegal if any key is not linearizable, otherwise Unknown if
+	// any key's check timed out or was skipped, otherwise Ok
+	Status porcupine.CheckResult
+	// Keys holds the per-key results in natural key order, or a single
+	// result for HistoryKey with Options.WholeHistory
+	Keys []KeyResult
+	// Unfinished holds the calls of operations that never returned
+	Unfinished []porcupine.Event
+	// UnmatchedKeys lists the Options.Keys patterns that matched no key
+	UnmatchedKeys []string
+	// ExcludedKeys lists the keys matching Options.Keys that
+	// Options.ExcludeKeys left out
+	ExcludedKeys []string
+	// Selected counts the keys matching Options.Keys and not
+	// Options.ExcludeKeys, of the Total keys of the history
+	Selected, Total int
+	// UnmatchedClients lists the Options.Clients that have no operation
+	UnmatchedClients []int
+	// TrivialKeys lists the keys left out for having fewer than
+	// Options.MinOps operations
+	TrivialKeys []string
+	// Unchecked counts the keys left unchecked by Options.FailFast
+	Unchecked int
+}
+
+// Key returns the result of a key, or of HistoryKey with
+// Options.WholeHistory, and whether it was checked.
+func (res Result) Key(key string) (KeyResult, bool) {
+	for _, r := range res.Keys {
+		if r.Key == key {
+			return r, true
+		}
+	}
+	return KeyResult{}, false
+}
+
+// CheckEvents checks a parsed history, such as ParseLog returns, or one built
+// in memory: call and return events whose values are InputOutput, paired by
+// Id. The keys are checked against the model named by Options.Model. It
+// returns ErrNoEvents if the history has no completed operation.
+func CheckEvents(events []porcupine.Event, opts Options) (Result, error) {
+	if err := opts.validate(); err != nil {
+		return Result{}, err
+	}
+
+	var res Result
+	events, res.UnmatchedClients = SelectClients(events, opts.Clients)
+	finalEvents, pending := SplitUnfinished(events)
+	res.Unfinished = pending
+	if len(pending) > 0 && opts.IncludePending {
+		// Keep the calls where they happened and close them at the end
+		finalEvents = append(events[:len(events):len(events)], PendingReturns(pending)...)
+	}
+
+	grouped := SplitEventsByKey(finalEvents)
+	if len(grouped) == 0 {
+		return res, ErrNoEvents
+	}
+	keys := SortedKeys(grouped)
+	res.Total = len(keys)
+	keys, res.UnmatchedKeys = SelectKeys(keys, opts.Keys)
+	keys, res.ExcludedKeys = ExcludeKeys(keys, opts.ExcludeKeys)
+	res.Selected = len(keys)
+	keys, res.TrivialKeys = SelectBusyKeys(keys, grouped, opts.MinOps)
+
+	if opts.WholeHistory {
+		// Check the selected keys' operations together, in log order
+		selected := make(map[string]bool, len(keys))
+		for _, k := range keys {
+			selected[k] = true
+		}
+		var history []porcupine.Event
+		for _, ev := range finalEvents {
+			if selected[ev.Value.(InputOutput).Key] {
+				history = append(history, ev)
+			}
+		}
+		keys = []string{HistoryKey}
+		grouped = map[string][]porcupine.Event{HistoryKey: history}
+	}
+
+	res.Keys = CheckKeys(keys, grouped, opts)
+	res.Unchecked = len(keys) - len(res.Keys)
+	res.Status = Verdict(res.Keys)
+	return res, nil
+}
+
+// timedOperations pairs the events of a history into operations spanning
+// their logged timestamps, so that porcupine compares real-time intervals
+// rather than positions in the event order. Operations are numbered in order
+// of first appearance, as porcupine numbers events, so violations index them
+// the same way. It returns false if an event has no timestamp. The
+// synthesized return of an unfinished operation is placed after every
+// logged time, and a return logged before its call, as by a skewed clock,
+// at its call.
+func timedOperations(evs []porcupine.Event) ([]porcupine.Operation, bool) {
+	index := make(map[int]int)
+	var ops []porcupine.Operation
+	var pending []int
+	var last int64
+	for _, ev := range evs {
+		v := ev.Value.(InputOutput)
+		if v.Time.IsZero() && !v.Pending {
+			return nil, false
+		}
+		i, ok := index[ev.Id]
+		if !ok {
+			i = len(ops)
+			index[ev.Id] = i
+			ops = append(ops, porcupine.Operation{ClientId: ev.ClientId})
+		}
+		t := v.Time.UnixNano()
+		if t > last {
+			last = t
+		}
+		switch {
+		case ev.Kind == porcupine.CallEvent:
+			ops[i].Input, ops[i].Call = v, t
+		case v.Pending:
+			ops[i].Output = v
+			pending = append(pending, i)
+		default:
+			ops[i].Output, ops[i].Return = v, t
+		}
+	}
+	for i := range ops {
+		if ops[i].Return < ops[i].Call {
+			ops[i].Return = ops[i].Call
+		}
+	}
+	for _, i := range pending {
+		ops[i].Return = last + 1
+	}
+	return ops, len(ops) > 0
+}
+
+// Verdict combines per-key results: Illegal if any key is not linearizable,
+// otherwise Unknown if any key timed out or was skipped, otherwise Ok.
+func Verdict(results []KeyResult) porcupine.CheckResult {
+	verdict := porcupine.Ok
+	for _, r := range results {
+		switch r.Result {
+		case porcupine.Illegal:
+			return porcupine.Illegal
+		case porcupine.Unknown:
+			verdict = porcupine.Unknown
+		}
+	}
+	return verdict
+}
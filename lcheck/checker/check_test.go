@@ -0,0 +1,731 @@
+package checker
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anishathalye/porcupine"
+)
+
+func TestCheckKeysFailFast(t *testing.T) {
+	good := events([]porcupine.Operation{
+		op(1, 0, 1, put("a"), val("a")),
+		op(1, 2, 3, get(), val("a")),
+	})
+	bad := events([]porcupine.Operation{
+		op(1, 0, 1, put("a"), val("a")),
+		op(1, 2, 3, get(), val("b")),
+	})
+	keys := []string{"k1", "k2", "k3", "k4"}
+	grouped := map[string][]porcupine.Event{"k1": good, "k2": bad, "k3": good, "k4": bad}
+
+	res := CheckKeys(keys, grouped, Options{FailFast: true, Jobs: 1})
+	if len(res) != 2 || res[0].Key != "k1" || res[1].Key != "k2" {
+		t.Fatalf("checked %d keys, want k1 and k2", len(res))
+	}
+	if res[1].Result != porcupine.Illegal {
+		t.Errorf("k2 result = %v, want Illegal", res[1].Result)
+	}
+
+	if res := CheckKeys(keys, grouped, Options{Jobs: 1}); len(res) != len(keys) {
+		t.Errorf("without FailFast checked %d keys, want %d", len(res), len(keys))
+	}
+}
+
+func TestCheckKeysTimed(t *testing.T) {
+	at := func(io InputOutput, sec int64) InputOutput {
+		io.Time = time.Unix(sec, 0)
+		return io
+	}
+	// The get starts in the same second as the put returns. By the event
+	// order it follows the put and can't read NONE; by the logged times the
+	// two overlap.
+	evs := []porcupine.Event{
+		{ClientId: 1, Kind: porcupine.CallEvent, Value: at(put("a"), 0), Id: 0},
+		{ClientId: 1, Kind: porcupine.ReturnEvent, Value: at(val("a"), 1), Id: 0},
+		{ClientId: 2, Kind: porcupine.CallEvent, Value: at(get(), 1), Id: 1},
+		{ClientId: 2, Kind: porcupine.ReturnEvent, Value: at(none(), 2), Id: 1},
+	}
+	res := CheckKeys([]string{"k"}, map[string][]porcupine.Event{"k": evs}, Options{})
+	if !res[0].Timed || res[0].Result != porcupine.Ok {
+		t.Errorf("timed = %v, result = %v; want a timed Ok", res[0].Timed, res[0].Result)
+	}
+
+	// Without a timestamp on every event the event order is used
+	untimed := append([]porcupine.Event(nil), evs...)
+	untimed[3].Value = none()
+	res = CheckKeys([]string{"k"}, map[string][]porcupine.Event{"k": untimed}, Options{})
+	if res[0].Timed || res[0].Result != porcupine.Illegal {
+		t.Errorf("timed = %v, result = %v; want an untimed Illegal", res[0].Timed, res[0].Result)
+	}
+}
+
+func TestTimedOperations(t *testing.T) {
+	evs := []porcupine.Event{
+		{ClientId: 1, Kind: porcupine.CallEvent, Value: InputOutput{Op: OpGet, Key: "k", Time: time.Unix(5, 0)}, Id: 7},
+		{ClientId: 2, Kind: porcupine.CallEvent, Value: InputOutput{Op: OpGet, Key: "k", Time: time.Unix(6, 0)}, Id: 3},
+		// A skewed clock logged this return before its call
+		{ClientId: 1, Kind: porcupine.ReturnEvent, Value: InputOutput{Key: "k", Time: time.Unix(4, 0)}, Id: 7},
+		{ClientId: 2, Kind: porcupine.ReturnEvent, Value: InputOutput{Key: "k", Pending: true}, Id: 3},
+	}
+	ops, ok := timedOperations(evs)
+	if !ok || len(ops) != 2 {
+		t.Fatalf("got %d operations, ok %v", len(ops), ok)
+	}
+	// Numbered by first appearance, like porcupine numbers events
+	if ops[0].ClientId != 1 || ops[1].ClientId != 2 {
+		t.Errorf("clients = %d, %d; want 1, 2", ops[0].ClientId, ops[1].ClientId)
+	}
+	if ops[0].Return != ops[0].Call {
+		t.Errorf("early return at %d, want clamped to its call at %d", ops[0].Return, ops[0].Call)
+	}
+	if ops[1].Return <= time.Unix(6, 0).UnixNano() {
+		t.Errorf("pending return at %d, want after every logged time", ops[1].Return)
+	}
+}
+
+// benchLog generates a linearizable log of ops operations by clients
+// clients on keys keys, in the default format. Clients run their operations
+// one at a time, interleaved at random, and each operation takes effect as
+// it returns, so that reads overlap the writes they may or may not see.
+func benchLog(clients, keys, ops int) string {
+	rng := rand.New(rand.NewSource(1))
+	type inFlight struct {
+		req      int
+		put      bool
+		key, val string
+	}
+	busy := make([]*inFlight, clients)
+	state := make(map[string]string)
+	var b strings.Builder
+	for started, running := 0, 0; started < ops || running > 0; {
+		c := rng.Intn(clients)
+		op := busy[c]
+		if op == nil {
+			if started == ops {
+				continue
+			}
+			started++
+			running++
+			op = &inFlight{req: started, put: rng.Intn(2) == 0, key: fmt.Sprintf("key_%d", rng.Intn(keys))}
+			if op.put {
+				op.val = fmt.Sprintf("v%d", started)
+				fmt.Fprintf(&b, "Client_%d [Req:%d] Setting %s = %s\n", c, op.req, op.key, op.val)
+			} else {
+				fmt.Fprintf(&b, "Client_%d [Req:%d] Getting %s\n", c, op.req, op.key)
+			}
+			busy[c] = op
+			continue
+		}
+		if op.put {
+			state[op.key] = op.val
+			fmt.Fprintf(&b, "Client_%d [Req:%d] Set %s = %s\n", c, op.req, op.key, op.val)
+		} else {
+			v, ok := state[op.key]
+			if !ok {
+				v = NoneValue
+			}
+			fmt.Fprintf(&b, "Client_%d [Req:%d] Get %s = %s\n", c, op.req, op.key, v)
+		}
+		busy[c] = nil
+		running--
+	}
+	return b.String()
+}
+
+func BenchmarkParseLog(b *testing.B) {
+	log := benchLog(8, 16, 20000)
+	b.SetBytes(int64(len(log)))
+	for i := 0; i < b.N; i++ {
+		if _, _, err := ParseLogFormat(strings.NewReader(log), DefaultFormat); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCheck(b *testing.B) {
+	events, _, err := ParseLogFormat(strings.NewReader(benchLog(8, 16, 20000)), DefaultFormat)
+	if err != nil {
+		b.Fatal(err)
+	}
+	jobs := []int{1}
+	if runtime.NumCPU() > 1 {
+		jobs = append(jobs, runtime.NumCPU())
+	}
+	for _, jobs := range jobs {
+		b.Run(fmt.Sprintf("jobs=%d", jobs), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				res, err := CheckEvents(events, Options{Jobs: jobs})
+				if err != nil {
+					b.Fatal(err)
+				}
+				if res.Status != porcupine.Ok {
+					b.Fatalf("status = %v, want Ok", res.Status)
+				}
+			}
+		})
+	}
+}
+
+func TestVisualizable(t *testing.T) {
+	evs := events([]porcupine.Operation{
+		op(1, 0, 1, put("a"), val("a")),
+		op(1, 2, 3, get(), none()),
+	})
+	grouped := map[string][]porcupine.Event{"k": evs}
+	if r := CheckKeys([]string{"k"}, grouped, Options{})[0]; r.Result != porcupine.Illegal || !r.Visualizable() {
+		t.Errorf("checked Illegal key: result %v, visualizable %v; want Illegal, true", r.Result, r.Visualizable())
+	}
+	if r := CheckKeys([]string{"k"}, grouped, Options{Sequential: true})[0]; r.Visualizable() {
+		t.Error("key checked for sequential consistency is visualizable")
+	}
+	// An Illegal result whose info holds nothing to draw
+	r := KeyResult{Key: "k", Events: evs, Result: porcupine.Illegal, Model: singleKeyModel}
+	if r.Visualizable() {
+		t.Error("Illegal key without linearization info is visualizable")
+	}
+}
+
+// slowHistory returns a key's history that takes the checks long to
+// decide: any order of its n overlapping puts is linearizable up to the read
+// that follows them, which returns a value none of them wrote, so the
+// search has to try every subset of them before giving up.
+func slowHistory(n int) []porcupine.Event {
+	var ops []porcupine.Operation
+	for i := 0; i < n; i++ {
+		ops = append(ops, op(i, int64(i), int64(n+i), put(fmt.Sprint(i)), val(fmt.Sprint(i))))
+	}
+	ops = append(ops, op(n, int64(2*n), int64(2*n+1), get(), val("x")))
+	return events(ops)
+}
+
+func TestProgress(t *testing.T) {
+	const n = 22
+	grouped := map[string][]porcupine.Event{"k": slowHistory(n)}
+
+	for _, sequential := range []bool{false, true} {
+		r := CheckKeys([]string{"k"}, grouped, Options{Timeout: 50 * time.Millisecond, Sequential: sequential})[0]
+		if r.Result != porcupine.Unknown {
+			t.Fatalf("sequential %v: result = %v, want the check to time out", sequential, r.Result)
+		}
+		p, ok := r.Progress()
+		if !ok || p.Operations != n+1 || p.Longest == 0 || p.Longest > n {
+			t.Errorf("sequential %v: progress = %+v, %v; want a prefix of up to %d of %d operations", sequential, p, ok, n, n+1)
+		}
+		if !sequential && p.Partials == 0 {
+			t.Error("no partial linearizations counted")
+		}
+	}
+
+	if _, ok := CheckKeys([]string{"k"}, grouped, Options{MaxEvents: 1})[0].Progress(); ok {
+		t.Error("progress reported for a skipped key")
+	}
+}
+
+func TestCheckKeysPanic(t *testing.T) {
+	good := events([]porcupine.Operation{
+		op(1, 0, 1, put("a"), val("a")),
+		op(1, 2, 3, get(), val("a")),
+	})
+	malformed := append(events([]porcupine.Operation{op(1, 0, 1, put("a"), val("a"))}),
+		porcupine.Event{ClientId: 2, Kind: porcupine.CallEvent, Value: "get", Id: 1})
+	keys := []string{"k1", "k2", "k3"}
+	grouped := map[string][]porcupine.Event{"k1": good, "k2": malformed, "k3": good}
+
+	res := CheckKeys(keys, grouped, Options{Jobs: 1})
+	if len(res) != len(keys) || res[0].Result != porcupine.Ok || res[2].Result != porcupine.Ok {
+		t.Fatalf("results = %v, want the other keys checked Ok", res)
+	}
+	pe, ok := res[1].Err.(*PanicError)
+	if !ok || res[1].Result != porcupine.Unknown {
+		t.Fatalf("malformed key: result %v, err %v; want Unknown with a *PanicError", res[1].Result, res[1].Err)
+	}
+	if !strings.Contains(string(pe.Stack), "ModelFor") {
+		t.Errorf("stack does not show where the check panicked:\n%s", pe.Stack)
+	}
+}
+
+func TestPanicGuard(t *testing.T) {
+	// porcupine steps the model on goroutines of its own
+	model := singleKeyModel
+	step := model.Step
+	model.Step = func(state, input, output interface{}) (bool, interface{}) {
+		if output.(InputOutput).Value == "boom" {
+			panic("bad value")
+		}
+		return step(state, input, output)
+	}
+	evs := events([]porcupine.Operation{
+		op(1, 0, 1, put("a"), val("a")),
+		op(2, 2, 3, get(), val("boom")),
+	})
+	var g panicGuard
+	porcupine.CheckEventsVerbose(g.guard(model), evs, time.Second)
+	if g.err == nil || g.err.Value != "bad value" {
+		t.Fatalf("recovered %v, want the panic of Step", g.err)
+	}
+}
+
+func TestCheckKeysInterrupt(t *testing.T) {
+	quick := events([]porcupine.Operation{
+		op(1, 0, 1, put("a"), val("a")),
+		op(1, 2, 3, get(), val("a")),
+	})
+	keys := []string{"quick", "slow", "never"}
+	grouped := map[string][]porcupine.Event{"quick": quick, "slow": slowHistory(22), "never": quick}
+
+	// Interrupt as the slow key starts; its check runs out in the
+	// background
+	interrupt := make(chan struct{})
+	opts := Options{Jobs: 1, Timeout: 2 * time.Second, Interrupt: interrupt}
+	opts.Progress = func(i, n int, key string, events int) {
+		if key == "slow" {
+			close(interrupt)
+		}
+	}
+	start := time.Now()
+	res := CheckKeys(keys, grouped, opts)
+	if len(res) != 1 || res[0].Key != "quick" || res[0].Result != porcupine.Ok {
+		t.Fatalf("got %d results, want only the quick key's", len(res))
+	}
+	if took := time.Since(start); took >= opts.Timeout {
+		t.Errorf("interrupted check took %v, as long as the slow key's timeout", took)
+	}
+}
+
+func TestCheckEventsClients(t *testing.T) {
+	// Client 2 reads a value nobody wrote
+	evs := events([]porcupine.Operation{
+		op(1, 0, 1, put("a"), val("a")),
+		op(2, 2, 3, get(), val("x")),
+		op(1, 4, 5, get(), val("a")),
+	})
+	res, err := CheckEvents(evs, Options{Clients: []int{1}})
+	if err != nil || res.Status != porcupine.Ok {
+		t.Fatalf("client 1: status = %v, err = %v; want Ok", res.Status, err)
+	}
+	if n := len(res.Keys[0].Events); n != 4 {
+		t.Errorf("client 1: checked %d events, want its 4", n)
+	}
+
+	res, err = CheckEvents(evs, Options{Clients: []int{2, 3}})
+	if err != nil || res.Status != porcupine.Illegal {
+		t.Fatalf("clients 2 and 3: status = %v, err = %v; want Illegal", res.Status, err)
+	}
+	if len(res.UnmatchedClients) != 1 || res.UnmatchedClients[0] != 3 {
+		t.Errorf("unmatched clients = %v, want [3]", res.UnmatchedClients)
+	}
+
+	if _, err := CheckEvents(evs, Options{Clients: []int{3}}); err != ErrNoEvents {
+		t.Errorf("client 3: err = %v, want ErrNoEvents", err)
+	}
+}
+
+func TestCheckEventsMinOps(t *testing.T) {
+	// The trivial key reads a value nobody wrote, but is left out
+	evs := events([]porcupine.Operation{
+		op(1, 0, 1, put("a"), val("a")),
+		op(1, 2, 3, get(), val("a")),
+	})
+	lone := events([]porcupine.Operation{op(2, 0, 1, get(), val("x"))})
+	for i := range lone {
+		v := lone[i].Value.(InputOutput)
+		v.Key = "lone"
+		lone[i].Value, lone[i].Id = v, lone[i].Id+2
+	}
+	res, err := CheckEvents(append(evs, lone...), Options{MinOps: 2})
+	if err != nil || res.Status != porcupine.Ok {
+		t.Fatalf("status = %v, err = %v; want Ok", res.Status, err)
+	}
+	if len(res.Keys) != 1 || res.Keys[0].Key != "k" {
+		t.Errorf("checked %d keys, want only k", len(res.Keys))
+	}
+	if len(res.TrivialKeys) != 1 || res.TrivialKeys[0] != "lone" {
+		t.Errorf("trivial keys = %v, want [lone]", res.TrivialKeys)
+	}
+
+	if res, _ := CheckEvents(append(evs, lone...), Options{}); res.Status != porcupine.Illegal {
+		t.Errorf("without MinOps: status = %v, want Illegal", res.Status)
+	}
+}
+
+func TestCheckEventsTombstone(t *testing.T) {
+	del := InputOutput{Op: OpDelete, Key: "k"}
+	tests := []struct {
+		name string
+		ops  []porcupine.Operation
+		opts Options
+		want porcupine.CheckResult
+	}{
+		{
+			name: "read of the tombstone after a delete",
+			ops: []porcupine.Operation{
+				op(1, 0, 1, put("a"), val("a")),
+				op(1, 2, 3, del, val("")),
+				op(2, 4, 5, get(), val("gone")),
+			},
+			want: porcupine.Ok,
+		},
+		{
+			name: "read of NONE after a delete",
+			ops: []porcupine.Operation{
+				op(1, 0, 1, put("a"), val("a")),
+				op(1, 2, 3, del, val("")),
+				op(2, 4, 5, get(), none()),
+			},
+			want: porcupine.Illegal,
+		},
+		{
+			name: "read of NONE before any write",
+			ops:  []porcupine.Operation{op(1, 0, 1, get(), none())},
+			want: porcupine.Ok,
+		},
+		{
+			name: "read of the tombstone before any delete",
+			ops:  []porcupine.Operation{op(1, 0, 1, get(), val("gone"))},
+			want: porcupine.Illegal,
+		},
+		{
+			name: "cas expecting the tombstone",
+			ops: []porcupine.Operation{
+				op(1, 0, 1, del, val("")),
+				op(1, 2, 3, cas("gone", "b"), val("b")),
+				op(2, 4, 5, get(), val("b")),
+			},
+			want: porcupine.Ok,
+		},
+		{
+			name: "append to a deleted key",
+			ops: []porcupine.Operation{
+				op(1, 0, 1, appendOp("x"), val("x")),
+				op(1, 2, 3, del, val("")),
+				op(1, 4, 5, appendOp("y"), val("y")),
+			},
+			want: porcupine.Ok,
+		},
+		{
+			name: "eventual read of the tombstone before the delete",
+			ops: []porcupine.Operation{
+				op(2, 0, 1, get(), val("gone")),
+				op(1, 2, 3, del, val("")),
+			},
+			opts: Options{Eventual: true},
+			want: porcupine.Illegal,
+		},
+		{
+			name: "eventual read of the tombstone after the delete",
+			ops: []porcupine.Operation{
+				op(1, 0, 1, put("a"), val("a")),
+				op(1, 2, 3, del, val("")),
+				op(2, 4, 5, get(), val("a")),
+				op(2, 6, 7, get(), val("gone")),
+			},
+			opts: Options{Eventual: true},
+			want: porcupine.Ok,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Tombstone = "gone"
+			res, err := CheckEvents(events(tt.ops), tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Status != tt.want {
+				t.Errorf("status = %v, want %v", res.Status, tt.want)
+			}
+		})
+	}
+
+	if _, err := CheckEvents(events([]porcupine.Operation{op(1, 0, 1, get(), none())}), Options{Tombstone: NoneValue}); err == nil {
+		t.Error("CheckEvents accepted NONE as the tombstone")
+	}
+}
+
+func TestCheckEventsNumericKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		ops     []porcupine.Operation
+		init    string
+		numeric []string
+		want    porcupine.CheckResult
+	}{
+		{
+			name: "leading zeros compared as strings",
+			ops: []porcupine.Operation{
+				op(1, 0, 1, put("007"), val("007")),
+				op(2, 2, 3, get(), val("7")),
+			},
+			want: porcupine.Illegal,
+		},
+		{
+			name: "leading zeros compared as numbers",
+			ops: []porcupine.Operation{
+				op(1, 0, 1, put("007"), val("007")),
+				op(2, 2, 3, get(), val("7")),
+			},
+			numeric: []string{"*"},
+			want:    porcupine.Ok,
+		},
+		{
+			name: "surrounding spaces and a fraction",
+			ops: []porcupine.Operation{
+				op(1, 0, 1, put(" 7 "), val(" 7 ")),
+				op(2, 2, 3, get(), val("7.0")),
+				op(2, 4, 5, cas("7", "8"), val("08")),
+			},
+			numeric: []string{"k"},
+			want:    porcupine.Ok,
+		},
+		{
+			name: "a different number",
+			ops: []porcupine.Operation{
+				op(1, 0, 1, put("007"), val("007")),
+				op(2, 2, 3, get(), val("70")),
+			},
+			numeric: []string{"*"},
+			want:    porcupine.Illegal,
+		},
+		{
+			name: "other values compared as strings",
+			ops: []porcupine.Operation{
+				op(1, 0, 1, put("seven"), val("seven")),
+				op(2, 2, 3, get(), val("Seven")),
+			},
+			numeric: []string{"*"},
+			want:    porcupine.Illegal,
+		},
+		{
+			name:    "initial value",
+			ops:     []porcupine.Operation{op(1, 0, 1, get(), val("5"))},
+			init:    "05",
+			numeric: []string{"k*"},
+			want:    porcupine.Ok,
+		},
+		{
+			name: "key not matching the patterns",
+			ops: []porcupine.Operation{
+				op(1, 0, 1, put("007"), val("007")),
+				op(2, 2, 3, get(), val("7")),
+			},
+			numeric: []string{"x"},
+			want:    porcupine.Illegal,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := Options{NumericKeys: tt.numeric}
+			if tt.init != "" {
+				opts.InitValues = map[string]string{"k": tt.init}
+			}
+			evs := events(tt.ops)
+			res, err := CheckEvents(evs, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Status != tt.want {
+				t.Errorf("status = %v, want %v", res.Status, tt.want)
+			}
+			if evs[0].Value.(InputOutput).Value != tt.ops[0].Input.(InputOutput).Value {
+				t.Error("CheckEvents modified the events it was passed")
+			}
+		})
+	}
+
+	if _, err := CheckEvents(events([]porcupine.Operation{op(1, 0, 1, get(), none())}), Options{NumericKeys: []string{"["}}); err == nil {
+		t.Error("CheckEvents accepted an invalid numeric key pattern")
+	}
+}
+
+// TestKeyOrder checks that the keys of a log with numeric suffixes are
+// checked and indexed in numeric order, whatever order they were logged in.
+func TestKeyOrder(t *testing.T) {
+	var want []string
+	for i := 1; i <= 200; i++ {
+		want = append(want, fmt.Sprintf("key_%d", i))
+	}
+	logged := append([]string(nil), want...)
+	rand.New(rand.NewSource(1)).Shuffle(len(logged), func(i, j int) { logged[i], logged[j] = logged[j], logged[i] })
+	var log strings.Builder
+	for i, key := range logged {
+		fmt.Fprintf(&log, "Client_1 [Req:%d] Setting %s = v\nClient_1 [Req:%d] Set %s = v\n", i, key, i, key)
+	}
+	path := filepath.Join(t.TempDir(), "keys.log")
+	if err := os.WriteFile(path, []byte(log.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	evs, _, err := ParseLogFormat(strings.NewReader(log.String()), DefaultFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := SortedKeys(SplitEventsByKey(evs)); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("SortedKeys = %v", got)
+	}
+	res, err := CheckEvents(evs, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var checked []string
+	for _, r := range res.Keys {
+		checked = append(checked, r.Key)
+	}
+	if strings.Join(checked, " ") != strings.Join(want, " ") {
+		t.Errorf("CheckEvents checked %v", checked)
+	}
+	index, err := IndexLog(path, DefaultFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := index.Keys(); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Index.Keys = %v", got)
+	}
+
+	// Keys told apart only by leading zeros are still ordered the same
+	// way every time
+	for i := 0; i < 10; i++ {
+		keys := []string{"key_1", "key_01", "key_001", "key_2"}
+		rand.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+		SortKeys(keys)
+		if got := strings.Join(keys, " "); got != "key_001 key_01 key_1 key_2" {
+			t.Fatalf("SortKeys = %s", got)
+		}
+	}
+}
+
+// TestCheckEventsMultiGet checks a multi-get that saw x unwritten and y
+// written, although y was only written after x: each key on its own can
+// explain its read, but no single point of the store can.
+func TestCheckEventsMultiGet(t *testing.T) {
+	log := `Client_1 [Req:1] MultiGetting x,y
+Client_2 [Req:1] Setting x = 1
+Client_2 [Req:1] Set x = 1
+Client_2 [Req:2] Setting y = 1
+Client_2 [Req:2] Set y = 1
+Client_1 [Req:1] MultiGet x=%s,y=1
+`
+	tests := []struct {
+		x            string
+		whole, multi porcupine.CheckResult
+	}{
+		{"NONE", porcupine.Ok, porcupine.Illegal},
+		{"1", porcupine.Ok, porcupine.Ok},
+	}
+	for _, tt := range tests {
+		evs, _, err := ParseLogFormat(strings.NewReader(fmt.Sprintf(log, tt.x)), DefaultFormat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := CheckEvents(evs, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Status != tt.whole {
+			t.Errorf("x=%s per key: %v, want %v", tt.x, res.Status, tt.whole)
+		}
+		for _, seq := range []bool{false, true} {
+			res, err = CheckEvents(evs, Options{WholeHistory: true, Sequential: seq})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Status != tt.multi {
+				t.Errorf("x=%s whole history (sequential %t): %v, want %v", tt.x, seq, res.Status, tt.multi)
+			}
+		}
+	}
+}
+
+// TestCheckEventsInMemory checks a history built in memory rather than
+// parsed, as the package doc shows, and draws its result.
+func TestCheckEventsInMemory(t *testing.T) {
+	events := []porcupine.Event{
+		{Kind: porcupine.CallEvent, Value: InputOutput{Op: OpPut, Key: "k", Value: "v"}, Id: 0, ClientId: 1},
+		{Kind: porcupine.CallEvent, Value: InputOutput{Op: OpGet, Key: "k"}, Id: 1, ClientId: 2},
+		{Kind: porcupine.ReturnEvent, Value: InputOutput{Key: "k", Value: "v"}, Id: 0, ClientId: 1},
+		{Kind: porcupine.ReturnEvent, Value: InputOutput{Key: "k", Value: "v"}, Id: 1, ClientId: 2},
+		{Kind: porcupine.CallEvent, Value: InputOutput{Op: OpGet, Key: "j"}, Id: 2, ClientId: 2},
+		{Kind: porcupine.ReturnEvent, Value: InputOutput{Key: "j", Value: "x"}, Id: 2, ClientId: 2},
+	}
+	res, err := CheckEvents(events, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != porcupine.Illegal {
+		t.Errorf("status = %v, want Illegal", res.Status)
+	}
+	want := map[string]porcupine.CheckResult{"k": porcupine.Ok, "j": porcupine.Illegal}
+	for key, status := range want {
+		r, ok := res.Key(key)
+		if !ok || r.Result != status {
+			t.Errorf("key %s: %v (checked %t), want %v", key, r.Result, ok, status)
+		}
+	}
+	if _, ok := res.Key("other"); ok {
+		t.Error("found the result of a key not in the history")
+	}
+
+	r, _ := res.Key("k")
+	var page strings.Builder
+	if err := r.Visualize(&page); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(page.String(), "<html") {
+		t.Error("the visualization is not an HTML page")
+	}
+	r.Cached = true
+	if err := r.Visualize(&page); err != ErrNotVisualizable {
+		t.Errorf("visualizing a cached result: err = %v, want ErrNotVisualizable", err)
+	}
+}
+
+func TestExcludeKeys(t *testing.T) {
+	var ops []porcupine.Operation
+	for i, key := range []string{"key_1", "key_temp_1", "key_2", "other"} {
+		o := op(1, int64(2*i), int64(2*i+1), put("v"), val("v"))
+		in, out := o.Input.(InputOutput), o.Output.(InputOutput)
+		in.Key, out.Key = key, key
+		o.Input, o.Output = in, out
+		ops = append(ops, o)
+	}
+	res, err := CheckEvents(events(ops), Options{Keys: []string{"key_*"}, ExcludeKeys: []string{"key_temp_*", "key_2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var checked []string
+	for _, r := range res.Keys {
+		checked = append(checked, r.Key)
+	}
+	if strings.Join(checked, ",") != "key_1" || strings.Join(res.ExcludedKeys, ",") != "key_2,key_temp_1" {
+		t.Errorf("checked %v, excluded %v; want key_1, and key_2 and key_temp_1", checked, res.ExcludedKeys)
+	}
+	if res.Selected != 1 || res.Total != 4 {
+		t.Errorf("selected %d of %d keys, want 1 of 4", res.Selected, res.Total)
+	}
+	if _, err := CheckEvents(events(ops), Options{ExcludeKeys: []string{"["}}); err == nil {
+		t.Error("an invalid exclude pattern was accepted")
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	tests := []struct {
+		ops  []porcupine.Operation
+		want int
+	}{
+		{nil, 0},
+		{[]porcupine.Operation{op(1, 0, 1, put("a"), val("a")), op(2, 2, 3, get(), val("a"))}, 1},
+		// The put overlaps both gets, which don't overlap each other
+		{[]porcupine.Operation{op(1, 0, 10, put("a"), val("a")), op(2, 1, 2, get(), none()), op(3, 3, 4, get(), val("a"))}, 2},
+		{[]porcupine.Operation{op(1, 0, 10, put("a"), val("a")), op(2, 1, 9, get(), none()), op(3, 2, 8, get(), val("a"))}, 3},
+	}
+	for i, tt := range tests {
+		if got := (KeyResult{Events: events(tt.ops)}).Concurrency(); got != tt.want {
+			t.Errorf("history %d: concurrency %d, want %d", i, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package checker
+
+import (
+	"time"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// ================= Minimal counterexamples =================
+
+// maxShrinkChecks caps the checks Counterexample runs while shrinking
+const maxShrinkChecks = 1000
+
+// Counterexample returns a slice of an Illegal key's history, in order, that
+// is still not linearizable (or not sequentially consistent) and from which
+// no single operation can be removed without that changing: a minimal
+// replay of the failure. The search starts from the operations called
+// before the first operation left out of the longest partial
+// linearization returned, and then drops operations one at a time, as long
+// as the rest still fails. It stops shrinking once timeout has elapsed (0
+// means no timeout), or after maxShrinkChecks checks, returning the
+// smallest failing slice found so far. It returns nil for a key that is not
+// Illegal. The slice is stored with the key's result in Options.Cache, and
+// restored from there.
+func (r KeyResult) Counterexample(timeout time.Duration) []porcupine.Event {
+	if r.Result != porcupine.Illegal {
+		return nil
+	}
+	if r.shrunk != nil {
+		return r.shrunk
+	}
+	deadline := time.Now().Add(timeout)
+	checks := 0
+	fails := func(keep []bool) bool {
+		left := time.Until(deadline)
+		if timeout == 0 {
+			left = 0 // no timeout
+		} else if left <= 0 {
+			return false
+		}
+		if checks >= maxShrinkChecks {
+			return false
+		}
+		checks++
+		return r.recheck(opEvents(r.Events, keep), left) == porcupine.Illegal
+	}
+
+	order := opOrder(r.Events)
+	n := len(order)
+	keep := make([]bool, n)
+	for i := range keep {
+		keep[i] = true
+	}
+	if cut := r.failureCut(order); cut < n {
+		prefix := make([]bool, n)
+		copy(prefix, keep[:cut])
+		if fails(prefix) {
+			keep = prefix
+		}
+	}
+	// Later operations are dropped first: they are the likeliest to be
+	// unrelated to a failure found early in the history
+	for i := n - 1; i >= 0; i-- {
+		if !keep[i] {
+			continue
+		}
+		keep[i] = false
+		if !fails(keep) {
+			keep[i] = true
+		}
+	}
+	slice := opEvents(r.Events, keep)
+	if r.cache != nil {
+		r.cache.Put(r.cacheId, r.CacheEntry(slice))
+	}
+	return slice
+}
+
+// failureCut returns how many operations, in order of their calls,
+// precede the earliest return of an operation missing from the longest
+// partial linearization, or the number of operations if that is unknown.
+// The history up to there is where the check got stuck.
+func (r KeyResult) failureCut(order []int) int {
+	if r.searched() || r.ReadYourWrites || r.Eventual {
+		return len(order)
+	}
+	partitions := r.partialLinearizations()
+	if len(partitions) == 0 {
+		return len(order)
+	}
+	var longest []int
+	for _, partial := range partitions[0] {
+		if len(partial) > len(longest) {
+			longest = partial
+		}
+	}
+	linearized := make(map[int]bool)
+	for _, id := range longest {
+		linearized[order[id]] = true
+	}
+	// The operations are numbered by first appearance, so the events up to
+	// the first such return hold exactly the calls before it
+	called := 0
+	seen := make(map[int]bool)
+	for _, ev := range r.Events {
+		if ev.Kind == porcupine.CallEvent {
+			seen[ev.Id] = true
+			called++
+			continue
+		}
+		if !linearized[ev.Id] && seen[ev.Id] {
+			return called
+		}
+	}
+	return len(order)
+}
+
+// recheck checks a slice of the key's history the way CheckKeys checked
+// the whole of it.
+func (r KeyResult) recheck(evs []porcupine.Event, timeout time.Duration) porcupine.CheckResult {
+	if len(evs) == 0 {
+		return porcupine.Ok
+	}
+	if r.Sequential {
+		res, _ := CheckSequential(r.Model, evs, timeout)
+		return res
+	}
+	if r.ReadYourWrites {
+		return CheckReadYourWrites(evs)
+	}
+	if r.Eventual {
+		return CheckEventual(r.Model, evs)
+	}
+	if r.ClientOrder {
+		res, _ := CheckClientOrder(r.Model, evs, timeout)
+		return res
+	}
+	if ops, timed := timedOperations(evs); timed {
+		return porcupine.CheckOperationsTimeout(r.Model, ops, timeout)
+	}
+	return porcupine.CheckEventsTimeout(r.Model, evs, timeout)
+}
+
+// Recheck checks evs, a slice of the key's history such as Counterexample
+// returns, the way CheckKeys checked the whole of it, so that the slice can
+// be visualized on its own.
+func (r KeyResult) Recheck(evs []porcupine.Event, timeout time.Duration) KeyResult {
+	s := KeyResult{Key: r.Key, Events: evs, Model: r.Model, Sequential: r.Sequential, ReadYourWrites: r.ReadYourWrites, Eventual: r.Eventual, ClientOrder: r.ClientOrder}
+	start := time.Now()
+	if r.Sequential {
+		s.Result, s.order = CheckSequential(r.Model, evs, timeout)
+	} else if r.ReadYourWrites {
+		s.Result, s.stale = checkReadYourWrites(evs)
+	} else if r.Eventual {
+		s.Result, s.unwritten = checkEventual(r.Model, evs)
+	} else if r.ClientOrder {
+		s.Result, s.order = CheckClientOrder(r.Model, evs, timeout)
+	} else if ops, timed := timedOperations(evs); timed {
+		s.Timed = true
+		s.Result, s.Info = porcupine.CheckOperationsVerbose(r.Model, ops, timeout)
+	} else {
+		s.Result, s.Info = porcupine.CheckEventsVerbose(r.Model, evs, timeout)
+	}
+	s.Elapsed = time.Since(start)
+	return s
+}
+
+// opOrder lists the event ids of a history's operations in order of first
+// appearance, which is how porcupine numbers them.
+func opOrder(evs []porcupine.Event) []int {
+	var order []int
+	seen := make(map[int]bool)
+	for _, ev := range evs {
+		if !seen[ev.Id] {
+			seen[ev.Id] = true
+			order = append(order, ev.Id)
+		}
+	}
+	return order
+}
+
+// opEvents returns the events of the operations marked in keep, indexed in
+// order of first appearance, keeping their order in evs.
+func opEvents(evs []porcupine.Event, keep []bool) []porcupine.Event {
+	index := make(map[int]int)
+	var kept []porcupine.Event
+	for _, ev := range evs {
+		i, ok := index[ev.Id]
+		if !ok {
+			i = len(index)
+			index[ev.Id] = i
+		}
+		if keep[i] {
+			kept = append(kept, ev)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,48 @@
+package checker
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+)
+
+func TestCounterexample(t *testing.T) {
+	// The read of 1 after 2 was written is stale; every other operation is
+	// unrelated to it
+	evs := events([]porcupine.Operation{
+		op(1, 0, 1, put("1"), val("1")),
+		op(2, 2, 3, get(), val("1")),
+		op(1, 4, 5, put("2"), val("2")),
+		op(2, 6, 7, get(), val("2")),
+		op(2, 8, 9, get(), val("1")),
+		op(1, 10, 11, put("3"), val("3")),
+		op(2, 12, 13, get(), val("3")),
+	})
+	res := CheckKeys([]string{"k"}, map[string][]porcupine.Event{"k": evs}, Options{})[0]
+	if res.Result != porcupine.Illegal {
+		t.Fatalf("result = %v, want Illegal", res.Result)
+	}
+
+	slice := res.Counterexample(0)
+	if got := porcupine.CheckEvents(res.Model, slice); got {
+		t.Fatalf("counterexample %v is linearizable", eventStrings(slice))
+	}
+	// Removing the put of 1 makes the read a phantom, so the stale read
+	// comes down to the latest write before it
+	want := []string{
+		"call c1 #2 put k 2",
+		"ret c1 #2 get k 2", // val() leaves the op unset
+		"call c2 #4 get k",
+		"ret c2 #4 get k 1",
+	}
+	if got := eventStrings(slice); !reflect.DeepEqual(got, want) {
+		t.Errorf("counterexample\n\t%s\nwant\n\t%s", strings.Join(got, "\n\t"), strings.Join(want, "\n\t"))
+	}
+
+	ok := CheckKeys([]string{"k"}, map[string][]porcupine.Event{"k": evs[:4]}, Options{})[0]
+	if slice := ok.Counterexample(0); slice != nil {
+		t.Errorf("linearizable key has counterexample %v", eventStrings(slice))
+	}
+}
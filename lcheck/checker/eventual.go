@@ -0,0 +1,110 @@
+package checker
+
+import (
+	"github.com/anishathalye/porcupine"
+)
+
+// ================= Eventual consistency =================
+
+// A history is eventually consistent, in the sense checked here, if every
+// read returns the key's initial value or a value that some write had set,
+// or may have set, by the time the read returned: the value of any write to
+// the key called before then, however stale. Nothing is said about the order
+// the values are seen in, so this only catches reads of values that were
+// never written, or written too late; like the read-your-writes check it is
+// a single pass over the history rather than a search.
+
+// CheckEventual checks whether every read of a history returned a value
+// written before it returned, or the initial value of model. The result is
+// Ok or Illegal; the check has no search to time out.
+func CheckEventual(model porcupine.Model, evs []porcupine.Event) porcupine.CheckResult {
+	res, _ := checkEventual(model, evs)
+	return res
+}
+
+// checkEventual is CheckEventual, also returning the operation ids, in
+// historyOps order, of the reads of an Illegal history that returned a
+// value not written yet.
+func checkEventual(model porcupine.Model, evs []porcupine.Event) (porcupine.CheckResult, []int) {
+	if unwritten := unwrittenReads(model, evs); len(unwritten) > 0 {
+		return porcupine.Illegal, unwritten
+	}
+	return porcupine.Ok, nil
+}
+
+// unwrittenReads returns the completed reads of a history, in order of
+// their calls, whose value is neither the key's initial value nor that of
+// a write called before the read returned.
+func unwrittenReads(model porcupine.Model, evs []porcupine.Event) []int {
+	ops := rywOps(evs)
+	type keyVal struct {
+		key   string
+		value keyValue
+	}
+	// The earliest call of a write of each value, and of a write of each
+	// key whose value is unknown, which may have set any value
+	first := make(map[keyVal]int64)
+	unknown := make(map[string]int64)
+	for _, op := range ops {
+		if !op.write {
+			continue
+		}
+		if op.known {
+			kv := keyVal{op.key, op.value}
+			if call, ok := first[kv]; !ok || op.call < call {
+				first[kv] = op.call
+			}
+		} else if call, ok := unknown[op.key]; !ok || op.call < call {
+			unknown[op.key] = op.call
+		}
+	}
+
+	var unwritten []int
+	for _, op := range ops {
+		if !op.read {
+			continue
+		}
+		if call, ok := first[keyVal{op.key, op.value}]; ok && call < op.ret {
+			continue
+		}
+		if call, ok := unknown[op.key]; ok && call < op.ret {
+			continue
+		}
+		// The initial value is the one a read in the initial state may return
+		in := InputOutput{Op: OpGet, Key: op.key}
+		out := InputOutput{Key: op.key, Value: op.value.s, None: op.value.none, Deleted: op.value.deleted}
+		if initial, _ := model.Step(model.Init(), in, out); initial {
+			continue
+		}
+		unwritten = append(unwritten, op.id)
+	}
+	return unwritten
+}
+
+// eventualViolation lists the reads of a key's history that returned a
+// value not written yet, noting whether the value was written later.
+func eventualViolation(evs []porcupine.Event, model porcupine.Model, unwritten []int) Violation {
+	ops := historyOps(evs, model)
+	v := Violation{total: len(ops), eventual: true}
+	later := make(map[string]map[keyValue]bool)
+	for _, op := range rywOps(evs) {
+		if op.read {
+			v.reads++
+		}
+		if op.write && op.known {
+			if later[op.key] == nil {
+				later[op.key] = make(map[keyValue]bool)
+			}
+			later[op.key][op.value] = true
+		}
+	}
+	for _, id := range unwritten {
+		op := ops[id]
+		op.note = notePhantom
+		if later[op.input.Key][op.output.observed()] {
+			op.note = "value was only written after the read returned"
+		}
+		v.culprits = append(v.culprits, op)
+	}
+	return v
+}
@@ -0,0 +1,120 @@
+package checker
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+)
+
+func TestCheckEventual(t *testing.T) {
+	tests := []struct {
+		name  string
+		model porcupine.Model
+		ops   []porcupine.Operation
+		want  porcupine.CheckResult
+	}{
+		{
+			name: "stale value",
+			ops: []porcupine.Operation{
+				op(1, 0, 1, put("a"), val("a")),
+				op(1, 2, 3, put("b"), val("b")),
+				op(2, 4, 5, get(), val("a")),
+			},
+			want: porcupine.Ok,
+		},
+		{
+			name: "initial value after writes",
+			ops: []porcupine.Operation{
+				op(1, 0, 1, put("a"), val("a")),
+				op(2, 2, 3, get(), none()),
+			},
+			want: porcupine.Ok,
+		},
+		{
+			name:  "configured initial value",
+			model: NewKeyModel("x"),
+			ops: []porcupine.Operation{
+				op(1, 0, 1, put("a"), val("a")),
+				op(2, 2, 3, get(), val("x")),
+			},
+			want: porcupine.Ok,
+		},
+		{
+			name: "never written",
+			ops: []porcupine.Operation{
+				op(1, 0, 1, put("a"), val("a")),
+				op(2, 2, 3, get(), val("x")),
+			},
+			want: porcupine.Illegal,
+		},
+		{
+			name: "written after the read returned",
+			ops: []porcupine.Operation{
+				op(2, 0, 1, get(), val("a")),
+				op(1, 2, 3, put("a"), val("a")),
+			},
+			want: porcupine.Illegal,
+		},
+		{
+			name: "concurrent write",
+			ops: []porcupine.Operation{
+				op(2, 0, 3, get(), val("a")),
+				op(1, 1, 4, put("a"), val("a")),
+			},
+			want: porcupine.Ok,
+		},
+		{
+			name: "failed cas writes nothing",
+			ops: []porcupine.Operation{
+				op(1, 0, 1, put("a"), val("a")),
+				op(2, 2, 3, cas("x", "b"), val("a")),
+				op(1, 4, 5, get(), val("b")),
+			},
+			want: porcupine.Illegal,
+		},
+		{
+			name: "pending append may set anything",
+			ops: []porcupine.Operation{
+				op(2, 0, 100, appendOp("b"), InputOutput{Key: "k", Pending: true}),
+				op(1, 4, 5, get(), val("b")),
+			},
+			want: porcupine.Ok,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := tt.model
+			if model.Init == nil {
+				model = singleKeyModel
+			}
+			if got := CheckEventual(model, events(tt.ops)); got != tt.want {
+				t.Errorf("CheckEventual = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventualViolation(t *testing.T) {
+	evs := events([]porcupine.Operation{
+		op(2, 0, 1, get(), val("a")),
+		op(1, 2, 3, put("a"), val("a")),
+		op(2, 4, 5, get(), val("z")),
+		op(2, 6, 7, get(), val("a")),
+	})
+	res := CheckKeys([]string{"k"}, map[string][]porcupine.Event{"k": evs}, Options{Eventual: true})
+	if res[0].Result != porcupine.Illegal {
+		t.Fatalf("result = %v, want Illegal", res[0].Result)
+	}
+	want := []string{
+		"unwritten reads: 2 of 3 reads returned a value not written before they returned",
+		"  unwritten read: client 2: get()=a (value was only written after the read returned)",
+		"  unwritten read: client 2: get()=z (phantom value: never written)",
+	}
+	if got := res[0].Violation().Lines(); !reflect.DeepEqual(got, want) {
+		t.Errorf("violation = %q, want %q", got, want)
+	}
+	if slice := res[0].Counterexample(0); len(slice) != 2 {
+		t.Errorf("counterexample has %d events, want the 2 of one unwritten read", len(slice))
+	}
+}
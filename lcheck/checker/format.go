@@ -0,0 +1,350 @@
+package checker
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// ================= Log line formats =================
+
+// Building blocks of the default log line regexes
+const (
+	// opPrefix captures the client id and request id: "Client_1 [Req:55] ".
+	// Older logs name clients "Node 3" or "Proc_3"; the id is the number
+	// either way. Legacy logs leave out the request id altogether. Request
+	// ids are only matched up, not numbers, so newer clients' ids like
+	// "a1f3-22" are fine.
+	opPrefix = `(?:Client|Node|Proc)[_ ]?(\d+)\s+(?:\[Req:\s*([[:alnum:]-]+)\]\s+)?`
+	// keyPattern captures a key, which runs up to the next whitespace or '='
+	// so that keys like "user:42/profile" are kept whole
+	keyPattern = `([^\s=]+)`
+	// valuePattern captures either a double-quoted value, which may contain
+	// spaces and backslash escapes, or a bare token
+	valuePattern = `("(?:[^"\\]|\\.)*"|\S*)`
+	// fragmentPattern captures an appended fragment, which may also be
+	// single-quoted since leading spaces are common: "Appending ' world'"
+	fragmentPattern = `('(?:[^'\\]|\\.)*'|"(?:[^"\\]|\\.)*"|\S+)`
+	// restPattern captures a quoted value or, unquoted, the rest of the line,
+	// since an accumulated append value may contain spaces
+	restPattern = `("(?:[^"\\]|\\.)*"|.*?)\s*$`
+	// multiKeysPattern captures the comma-separated keys a multi-get reads
+	multiKeysPattern = `([^\s=,]+(?:,[^\s=,]+)*)`
+	// multiValuesPattern captures the comma-separated key=value pairs a
+	// multi-get returns, each value quoted or a bare token without commas
+	multiValuesPattern = `(` + multiPair + `(?:,` + multiPair + `)*)`
+	multiPair          = `[^\s=,]+=(?:"(?:[^"\\]|\\.)*"|[^\s,"]*)`
+)
+
+// reMultiPair splits the pairs of a multi-get return into their keys and
+// values
+var reMultiPair = regexp.MustCompile(`([^\s=,]+)=("(?:[^"\\]|\\.)*"|[^\s,"]*)`)
+
+// linePattern describes one kind of log line: the operation it belongs to,
+// whether it starts or ends the operation, and which capture groups hold
+// each field. A group index of 0 means the field is not captured.
+type linePattern struct {
+	name string
+	re   *regexp.Regexp
+	kind porcupine.EventKind
+	op   OpType
+
+	client, req, key, value, old, delta int
+	// session, if captured, scopes req to a connection or session of the
+	// client, for clients whose connections number requests independently
+	session int
+	// multi marks the lines of a multi-get, whose key group holds the
+	// comma-separated keys of a call, or the key=value pairs of a return
+	multi bool
+}
+
+// Format is the ordered set of line patterns a log is parsed with. The
+// first pattern that matches a line wins.
+type Format struct {
+	patterns []linePattern
+	// keyFromClient takes the client id as the key of a line that captures
+	// none, see KeyFromClient
+	keyFromClient bool
+	// dedup drops repeated lines, see Dedup
+	dedup bool
+}
+
+// KeyFromClient returns a copy of the format that takes the client id as
+// the key of every line that captures no key, for workloads where each
+// client only writes a register of its own. Patterns of a format config may
+// then leave out the key group.
+func (f *Format) KeyFromClient() *Format {
+	c := *f
+	c.keyFromClient = true
+	return &c
+}
+
+// Dedup returns a copy of the format that drops a line repeating an earlier
+// one: the same kind of line of the same request of a client, on the same
+// key with the same values, as when log collection delivered a line twice.
+// Lines without a request id are never dropped, as nothing tells a repeated
+// line from another operation with the same values. The lines dropped are
+// counted in MatchStats.
+func (f *Format) Dedup() *Format {
+	c := *f
+	c.dedup = true
+	return &c
+}
+
+// Keyless reports whether some pattern of the format captures no key, so
+// that it only parses with KeyFromClient.
+func (f *Format) Keyless() bool {
+	for _, p := range f.patterns {
+		if p.key == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultFormat matches the EPaxos client logs, whose clients may also be
+// named Node or Proc (e.g. "Node 3 [Req:10]"), with or without the request
+// id (see logParser.add):
+//
+//	Client_1 [Req:55] Setting key_1 = val     / Set key_1 = val
+//	Client_1 [Req:56] Getting key_1           / Get key_1 = val
+//	Client_1 [Req:57] CASing key_1 old=a new=b / CAS key_1 = b
+//	Client_2 [Req:9] Deleting key_3           / Deleted key_3
+//	Client_1 [Req:7] Incrementing ctr_1 by 3  / Incremented ctr_1 = 10
+//	Client_1 [Req:3] Appending ' world' to key_1 / Appended key_1 = hello world
+//	Client_1 [Req:8] MultiGetting key_1,key_2 / MultiGet key_1=a,key_2=b
+var DefaultFormat = defaultFormat(valuePattern)
+
+// RestOfLineFormat is DefaultFormat with every value that ends its line
+// captured up to the end of the line, trailing spaces trimmed, so that an
+// unquoted value may contain spaces: "Setting k = a=1 b=2" writes "a=1 b=2".
+// Anything a server logs after the value becomes part of it, hence it is a
+// separate format rather than the default.
+var RestOfLineFormat = defaultFormat(restPattern)
+
+// EtcdFormat matches logfmt operation logs of etcd clients, as a test
+// harness of etcd or raftexample writes them around its client calls, with
+// optional timestamps. Each line names the client, the request, the
+// operation and its phase: invoke when the call is made, ok once it
+// succeeded. A get without a value read a key that has none, and a cas
+// returns the key's value after it, as in the default format. Lines of any
+// other phase, such as fail, are not matched, so their calls are unfinished.
+//
+//	client=1 req=55 op=put phase=invoke key=k value=v / phase=ok key=k value=v
+//	client=1 req=56 op=get phase=invoke key=k         / phase=ok key=k value=v
+//	client=1 req=57 op=cas phase=invoke key=k old=a value=b / phase=ok key=k value=b
+//	client=1 req=58 op=delete phase=invoke key=k      / phase=ok key=k
+var EtcdFormat = etcdFormat()
+
+// etcdFormat builds the patterns of EtcdFormat.
+func etcdFormat() *Format {
+	op := func(name, phase string) string {
+		return `\bclient=(\d+)\s+(?:req=([[:alnum:]-]+)\s+)?op=` + verb(name) + `\s+phase=` + phase + `\s+key=` + keyPattern
+	}
+	return &Format{patterns: []linePattern{
+		{name: "setterStart", re: regexp.MustCompile(op("put", "invoke") + `\s+value=` + valuePattern),
+			kind: porcupine.CallEvent, op: OpPut, client: 1, req: 2, key: 3, value: 4},
+		{name: "setterEnd", re: regexp.MustCompile(op("put", "ok") + `\s+value=` + valuePattern),
+			kind: porcupine.ReturnEvent, op: OpPut, client: 1, req: 2, key: 3, value: 4},
+		{name: "getterStart", re: regexp.MustCompile(op("get", "invoke")),
+			kind: porcupine.CallEvent, op: OpGet, client: 1, req: 2, key: 3},
+		{name: "getterEnd", re: regexp.MustCompile(op("get", "ok") + `(?:\s+value=` + valuePattern + `)?`),
+			kind: porcupine.ReturnEvent, op: OpGet, client: 1, req: 2, key: 3, value: 4},
+		{name: "casStart", re: regexp.MustCompile(op("cas", "invoke") + `\s+old=` + valuePattern + `\s+value=` + valuePattern),
+			kind: porcupine.CallEvent, op: OpCAS, client: 1, req: 2, key: 3, old: 4, value: 5},
+		{name: "casEnd", re: regexp.MustCompile(op("cas", "ok") + `\s+value=` + valuePattern),
+			kind: porcupine.ReturnEvent, op: OpCAS, client: 1, req: 2, key: 3, value: 4},
+		{name: "deleteStart", re: regexp.MustCompile(op("delete", "invoke")),
+			kind: porcupine.CallEvent, op: OpDelete, client: 1, req: 2, key: 3},
+		{name: "deleteEnd", re: regexp.MustCompile(op("delete", "ok")),
+			kind: porcupine.ReturnEvent, op: OpDelete, client: 1, req: 2, key: 3},
+	}}
+}
+
+// verb matches one of the fixed words of the default format, such as
+// "Setting", in any case. Keys and values are data and stay case-sensitive.
+func verb(word string) string {
+	return "(?i:" + word + ")"
+}
+
+// defaultFormat builds the EPaxos client patterns, capturing the values that
+// end their line with last.
+func defaultFormat(last string) *Format {
+	return &Format{patterns: []linePattern{
+		{name: "setterStart", re: regexp.MustCompile(opPrefix + verb("Setting") + `\s+` + keyPattern + `\s+=\s+` + last),
+			kind: porcupine.CallEvent, op: OpPut, client: 1, req: 2, key: 3, value: 4},
+		{name: "setterEnd", re: regexp.MustCompile(opPrefix + verb("Set") + `\s+` + keyPattern + `\s+=\s+` + last),
+			kind: porcupine.ReturnEvent, op: OpPut, client: 1, req: 2, key: 3, value: 4},
+		{name: "getterStart", re: regexp.MustCompile(opPrefix + verb("Getting") + `\s+` + keyPattern),
+			kind: porcupine.CallEvent, op: OpGet, client: 1, req: 2, key: 3},
+		// A read of an unset key may log nothing after the '='
+		{name: "getterEnd", re: regexp.MustCompile(opPrefix + verb("Get") + `\s+` + keyPattern + `\s+=\s*` + last),
+			kind: porcupine.ReturnEvent, op: OpGet, client: 1, req: 2, key: 3, value: 4},
+		{name: "casStart", re: regexp.MustCompile(opPrefix + verb("CASing") + `\s+` + keyPattern + `\s+` + verb("old=") + valuePattern + `\s+` + verb("new=") + last),
+			kind: porcupine.CallEvent, op: OpCAS, client: 1, req: 2, key: 3, old: 4, value: 5},
+		{name: "casEnd", re: regexp.MustCompile(opPrefix + verb("CAS") + `\s+` + keyPattern + `\s+=\s+` + last),
+			kind: porcupine.ReturnEvent, op: OpCAS, client: 1, req: 2, key: 3, value: 4},
+		{name: "deleteStart", re: regexp.MustCompile(opPrefix + verb("Deleting") + `\s+` + keyPattern),
+			kind: porcupine.CallEvent, op: OpDelete, client: 1, req: 2, key: 3},
+		{name: "deleteEnd", re: regexp.MustCompile(opPrefix + verb("Deleted") + `\s+` + keyPattern),
+			kind: porcupine.ReturnEvent, op: OpDelete, client: 1, req: 2, key: 3},
+		{name: "incrementStart", re: regexp.MustCompile(opPrefix + verb("Incrementing") + `\s+` + keyPattern + `\s+` + verb("by") + `\s+([+-]?\d+)`),
+			kind: porcupine.CallEvent, op: OpIncrement, client: 1, req: 2, key: 3, delta: 4},
+		{name: "incrementEnd", re: regexp.MustCompile(opPrefix + verb("Incremented") + `\s+` + keyPattern + `\s+=\s+` + valuePattern),
+			kind: porcupine.ReturnEvent, op: OpIncrement, client: 1, req: 2, key: 3, value: 4},
+		{name: "appendStart", re: regexp.MustCompile(opPrefix + verb("Appending") + `\s+` + fragmentPattern + `\s+` + verb("to") + `\s+` + keyPattern),
+			kind: porcupine.CallEvent, op: OpAppend, client: 1, req: 2, value: 3, key: 4},
+		{name: "appendEnd", re: regexp.MustCompile(opPrefix + verb("Appended") + `\s+` + keyPattern + `\s+=\s+` + restPattern),
+			kind: porcupine.ReturnEvent, op: OpAppend, client: 1, req: 2, key: 3, value: 4},
+		{name: "multiGetStart", re: regexp.MustCompile(opPrefix + verb("MultiGetting") + `\s+` + multiKeysPattern),
+			kind: porcupine.CallEvent, op: OpGet, client: 1, req: 2, key: 3, multi: true},
+		{name: "multiGetEnd", re: regexp.MustCompile(opPrefix + verb("MultiGet") + `\s+` + multiValuesPattern),
+			kind: porcupine.ReturnEvent, op: OpGet, client: 1, req: 2, key: 3, multi: true},
+	}}
+}
+
+// unquoteValue strips the surrounding quotes and escapes from a quoted
+// value. Single quotes only escape themselves and backslashes. Bare values
+// are returned unchanged.
+func unquoteValue(s string) string {
+	if len(s) >= 2 && strings.HasPrefix(s, `"`) && strings.HasSuffix(s, `"`) {
+		if v, err := strconv.Unquote(s); err == nil {
+			return v
+		}
+	}
+	if len(s) >= 2 && strings.HasPrefix(s, "'") && strings.HasSuffix(s, "'") {
+		return singleQuoteEscapes.Replace(s[1 : len(s)-1])
+	}
+	return s
+}
+
+var singleQuoteEscapes = strings.NewReplacer(`\'`, "'", `\\`, `\`)
+
+// observedValue parses a value a key was observed or expected to have: a
+// bare NONE, or nothing at all, means the key has no value, the same as
+// the initial value of a key never written; anything else, including a
+// quoted "NONE" or "", is a value as unquoteValue returns it.
+func observedValue(s string) (value string, none bool) {
+	if s == NoneValue || s == "" {
+		return "", true
+	}
+	return unquoteValue(s), false
+}
+
+// patternConfig is one line pattern in a --format-config file
+type patternConfig struct {
+	Regex  string `json:"regex"`
+	Client int    `json:"client"`
+	Req    int    `json:"req"`
+	Key    int    `json:"key"`
+	Value  int    `json:"value"`
+	Old    int    `json:"old"`
+	Delta  int    `json:"delta"`
+	// Session is optional in every pattern
+	Session int `json:"session"`
+}
+
+// patternSpec lists, in matching order, the patterns a format config may
+// define and which fields each one must capture.
+var patternSpecs = []struct {
+	name     string
+	required bool
+	kind     porcupine.EventKind
+	op       OpType
+	value    bool // value group required
+	old      bool // old group required
+	delta    bool // delta group required
+	multi    bool // a multi-get line, whose key group is required
+}{
+	{"setterStart", true, porcupine.CallEvent, OpPut, true, false, false, false},
+	{"setterEnd", true, porcupine.ReturnEvent, OpPut, true, false, false, false},
+	{"getterStart", true, porcupine.CallEvent, OpGet, false, false, false, false},
+	{"getterEnd", true, porcupine.ReturnEvent, OpGet, true, false, false, false},
+	{"casStart", false, porcupine.CallEvent, OpCAS, true, true, false, false},
+	{"casEnd", false, porcupine.ReturnEvent, OpCAS, true, false, false, false},
+	{"deleteStart", false, porcupine.CallEvent, OpDelete, false, false, false, false},
+	{"deleteEnd", false, porcupine.ReturnEvent, OpDelete, false, false, false, false},
+	{"incrementStart", false, porcupine.CallEvent, OpIncrement, false, false, true, false},
+	{"incrementEnd", false, porcupine.ReturnEvent, OpIncrement, true, false, false, false},
+	{"appendStart", false, porcupine.CallEvent, OpAppend, true, false, false, false},
+	{"appendEnd", false, porcupine.ReturnEvent, OpAppend, true, false, false, false},
+	{"multiGetStart", false, porcupine.CallEvent, OpGet, false, false, false, true},
+	{"multiGetEnd", false, porcupine.ReturnEvent, OpGet, false, false, false, true},
+}
+
+// LoadFormat reads a JSON format config mapping pattern names (setterStart,
+// setterEnd, getterStart, getterEnd, and optionally the cas, delete,
+// increment, append and multi-get patterns) to a regex and the capture group
+// indices of its fields. The key group of a multi-get pattern captures the
+// comma-separated keys of a call, or the key=value pairs of a return. Any
+// pattern may also capture a session that scopes the request id, for clients
+// whose connections number requests independently. A pattern without a
+// request id group pairs by client and key instead, and one without a key
+// group needs KeyFromClient.
+func LoadFormat(path string) (*Format, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg map[string]patternConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	known := make(map[string]bool)
+	format := &Format{}
+	for _, spec := range patternSpecs {
+		known[spec.name] = true
+		pc, ok := cfg[spec.name]
+		if !ok {
+			if spec.required {
+				return nil, fmt.Errorf("%s: missing required pattern %s", path, spec.name)
+			}
+			continue
+		}
+
+		re, err := regexp.Compile(pc.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("%s: pattern %s: %v", path, spec.name, err)
+		}
+		groups := []struct {
+			field    string
+			index    int
+			required bool
+		}{
+			{"client", pc.Client, true},
+			{"req", pc.Req, false},
+			{"key", pc.Key, spec.multi},
+			{"value", pc.Value, spec.value},
+			{"old", pc.Old, spec.old},
+			{"delta", pc.Delta, spec.delta},
+			{"session", pc.Session, false},
+		}
+		for _, g := range groups {
+			if g.index < 0 || g.index > re.NumSubexp() {
+				return nil, fmt.Errorf("%s: pattern %s: %s group %d out of range (regex has %d groups)",
+					path, spec.name, g.field, g.index, re.NumSubexp())
+			}
+			if g.required && g.index == 0 {
+				return nil, fmt.Errorf("%s: pattern %s: missing %s group index", path, spec.name, g.field)
+			}
+		}
+
+		format.patterns = append(format.patterns, linePattern{
+			name: spec.name, re: re, kind: spec.kind, op: spec.op,
+			client: pc.Client, req: pc.Req, key: pc.Key, value: pc.Value, old: pc.Old, delta: pc.Delta,
+			session: pc.Session, multi: spec.multi,
+		})
+	}
+	for name := range cfg {
+		if !known[name] {
+			return nil, fmt.Errorf("%s: unknown pattern %s", path, name)
+		}
+	}
+	return format, nil
+}
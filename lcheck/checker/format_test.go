@@ -0,0 +1,221 @@
+package checker
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// Call and return lines of each default pattern pair, with KEY standing for
+// the key under test
+var callReturnLines = []struct {
+	call, ret string
+}{
+	{"Client_1 [Req:1] Setting KEY = v", "Client_1 [Req:1] Set KEY = v"},
+	{"Client_1 [Req:2] Getting KEY", "Client_1 [Req:2] Get KEY = v"},
+	{"Client_1 [Req:3] CASing KEY old=a new=b", "Client_1 [Req:3] CAS KEY = b"},
+	{"Client_1 [Req:4] Deleting KEY", "Client_1 [Req:4] Deleted KEY"},
+	{"Client_1 [Req:5] Incrementing KEY by 3", "Client_1 [Req:5] Incremented KEY = 3"},
+	{"Client_1 [Req:6] Appending 'x' to KEY", "Client_1 [Req:6] Appended KEY = x"},
+}
+
+// TestDefaultFormatKeys guards against a call pattern capturing a different
+// key than its return pattern (the getter-start regex used to match only
+// \w+ and drop the rest of the key into a stray group), which would leave
+// the operation dangling.
+func TestDefaultFormatKeys(t *testing.T) {
+	keys := []string{"key_1", "key_10", "user:42/profile", "a.b-c", "k"}
+	for _, key := range keys {
+		for _, lines := range callReturnLines {
+			call := strings.ReplaceAll(lines.call, "KEY", key)
+			ret := strings.ReplaceAll(lines.ret, "KEY", key)
+			for _, line := range []string{call, ret} {
+				p, m := DefaultFormat.match(line)
+				if p == nil {
+					t.Errorf("%q matches no pattern", line)
+					continue
+				}
+				if got := m[p.key]; got != key {
+					t.Errorf("%s captured key %q from %q, want %q", p.name, got, line, key)
+				}
+			}
+		}
+	}
+}
+
+// TestDefaultFormatGroups checks that every capture group of the default
+// patterns is used for a field, so no part of a line is silently discarded.
+func TestDefaultFormatGroups(t *testing.T) {
+	for _, format := range []*Format{DefaultFormat, RestOfLineFormat, EtcdFormat} {
+		for _, p := range format.patterns {
+			used := make(map[int]bool)
+			for _, g := range []int{p.client, p.req, p.key, p.value, p.old, p.delta} {
+				if g != 0 {
+					used[g] = true
+				}
+			}
+			if n := p.re.NumSubexp(); n != len(used) {
+				t.Errorf("%s has %d capture groups but uses %d", p.name, n, len(used))
+			}
+		}
+	}
+}
+
+func TestRestOfLineFormat(t *testing.T) {
+	tests := []struct {
+		line       string
+		value, old string
+	}{
+		{"Client_1 [Req:1] Setting k = a=1 b=2", "a=1 b=2", ""},
+		{"Client_1 [Req:1] Set k = a=1 b=2  ", "a=1 b=2", ""},
+		{"Client_1 [Req:2] Get k = hello world", "hello world", ""},
+		{"Client_1 [Req:3] CASing k old=a new=x = y", "x = y", "a"},
+		{"Client_1 [Req:3] CAS k = x = y", "x = y", ""},
+		{`Client_1 [Req:4] Setting k = "quoted  value"`, `"quoted  value"`, ""},
+		{"Client_1 [Req:5] Setting k = plain", "plain", ""},
+	}
+	for _, tt := range tests {
+		p, m := RestOfLineFormat.match(tt.line)
+		if p == nil {
+			t.Errorf("%q matches no pattern", tt.line)
+			continue
+		}
+		if got := m[p.value]; got != tt.value {
+			t.Errorf("%s captured value %q from %q, want %q", p.name, got, tt.line, tt.value)
+		}
+		if p.old != 0 && m[p.old] != tt.old {
+			t.Errorf("%s captured old %q from %q, want %q", p.name, m[p.old], tt.line, tt.old)
+		}
+	}
+
+	// The default format stops at the first space
+	if p, m := DefaultFormat.match("Client_1 [Req:1] Setting k = a=1 b=2"); p == nil {
+		t.Error("default format matches no pattern")
+	} else if m[p.value] != "a=1" {
+		t.Errorf("default format captured %q, want a=1", m[p.value])
+	}
+}
+
+func TestRestOfLineFormatParse(t *testing.T) {
+	log := `Client_1 [Req:1] Setting k = a=1 b=2
+Client_1 [Req:1] Set k = a=1 b=2
+Client_2 [Req:1] Getting k
+Client_2 [Req:1] Get k = a=1 b=2
+`
+	events, _, err := ParseLogFormat(strings.NewReader(log), RestOfLineFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := CheckEvents(events, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != porcupine.Ok {
+		t.Errorf("status = %v, want Ok", res.Status)
+	}
+	if got := events[3].Value.(InputOutput).Value; got != "a=1 b=2" {
+		t.Errorf("get returned %q, want %q", got, "a=1 b=2")
+	}
+}
+
+func TestEtcdFormat(t *testing.T) {
+	log := `2025-01-02T15:04:05.1Z client=1 req=1 op=put phase=invoke key=k value=v
+2025-01-02T15:04:05.2Z client=2 req=1 op=get phase=invoke key=k
+2025-01-02T15:04:05.3Z client=1 req=1 op=put phase=ok key=k value=v
+2025-01-02T15:04:05.4Z client=2 req=1 op=get phase=ok key=k
+2025-01-02T15:04:05.5Z client=1 req=2 op=cas phase=invoke key=k old=v value="w x"
+2025-01-02T15:04:05.6Z client=1 req=2 op=cas phase=ok key=k value="w x"
+2025-01-02T15:04:05.7Z client=2 req=a-2 op=DELETE phase=invoke key=k
+2025-01-02T15:04:05.8Z client=2 req=a-2 op=DELETE phase=ok key=k
+2025-01-02T15:04:05.9Z client=3 req=1 op=put phase=invoke key=k value=y
+2025-01-02T15:04:06.0Z client=3 req=1 op=put phase=fail key=k value=y
+`
+	events, stats, err := ParseLogFormat(strings.NewReader(log), EtcdFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"call c1 #0 put k v",
+		"call c2 #1 get k",
+		"ret c1 #0 put k v",
+		"ret c2 #1 get k NONE",
+		"call c1 #2 cas k v->w x",
+		"ret c1 #2 cas k w x",
+		"call c2 #3 delete k",
+		"ret c2 #3 delete k",
+		// The failed put never returns, so its call is unfinished
+		"call c3 #4 put k y",
+	}
+	if got := eventStrings(events); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("events:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if stats.Matched() != 9 {
+		t.Errorf("matched %d lines, want 9", stats.Matched())
+	}
+	res, err := CheckEvents(events, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != porcupine.Ok {
+		t.Errorf("status = %v, want Ok", res.Status)
+	}
+}
+
+func TestDefaultFormatClientPrefixes(t *testing.T) {
+	for _, prefix := range []string{"Client_3", "Client3", "Client 3", "Node 3", "Node_3", "Proc 3", "Proc3"} {
+		line := prefix + " [Req:10] Setting k = v"
+		p, m := DefaultFormat.match(line)
+		if p == nil {
+			t.Errorf("%q matches no pattern", line)
+			continue
+		}
+		if m[p.client] != "3" || m[p.req] != "10" {
+			t.Errorf("%q: client %q, req %q; want 3, 10", line, m[p.client], m[p.req])
+		}
+	}
+	if p, _ := DefaultFormat.match("Server 3 [Req:10] Setting k = v"); p != nil {
+		t.Errorf("unknown client prefix matched %s", p.name)
+	}
+}
+
+func TestDefaultFormatVerbCase(t *testing.T) {
+	// Each pattern matches its words in any case
+	for _, l := range callReturnLines {
+		for _, line := range []string{l.call, l.ret} {
+			line = strings.Replace(line, "KEY", "k", 1)
+			want, _ := DefaultFormat.match(line)
+			// The client prefix keeps its case
+			i := strings.Index(line, "] ") + 2
+			for _, c := range []func(string) string{strings.ToUpper, strings.ToLower} {
+				mixed := line[:i] + c(line[i:])
+				if got, _ := DefaultFormat.match(mixed); got == nil || got.name != want.name {
+					t.Errorf("%q: matched %v, want %s", mixed, got, want.name)
+				}
+			}
+		}
+	}
+
+	// while keys and values keep their case
+	log := `Client_1 [Req:1] SETTING Key_A = Val
+Client_1 [Req:1] set Key_A = Val
+Client_2 [Req:1] getting Key_A
+Client_2 [Req:1] GET Key_A = Val
+Client_2 [Req:2] casing Key_A OLD=Val NEW=B
+Client_2 [Req:2] Cas Key_A = B`
+	events, _, err := ParseLogFormat(strings.NewReader(log), DefaultFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"call c1 #0 put Key_A Val",
+		"ret c1 #0 put Key_A Val",
+		"call c2 #1 get Key_A",
+		"ret c2 #1 get Key_A Val",
+		"call c2 #2 cas Key_A Val->B",
+		"ret c2 #2 cas Key_A B",
+	}
+	if got := eventStrings(events); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got events\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,218 @@
+package checker
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// jsonRecord is one line of a JSON-lines log, e.g.
+//
+//	{"client":1,"req":55,"op":"put","key":"k","value":"v","phase":"call","ts":"..."}
+type jsonRecord struct {
+	Client jsonID `json:"client"`
+	Req    jsonID `json:"req"`
+	// Session optionally scopes Req, for clients whose connections number
+	// their requests independently
+	Session jsonID  `json:"session,omitempty"`
+	Op      string  `json:"op"`
+	Key     *string `json:"key"`
+	Value   *string `json:"value,omitempty"`
+	Old     *string `json:"old,omitempty"`
+	Delta   int64   `json:"delta,omitempty"`
+	Phase   string  `json:"phase"`
+	Ts      string  `json:"ts,omitempty"`
+	// Multi, in the call of a get, is the id shared by the parts of a
+	// multi-get (see InputOutput.Multi)
+	Multi int `json:"multi,omitempty"`
+}
+
+// jsonID is a client or request id, written as a JSON number or string
+type jsonID string
+
+func (id *jsonID) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*id = jsonID(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("id %s is neither a number nor a string", data)
+	}
+	*id = jsonID(n.String())
+	return nil
+}
+
+// MarshalJSON writes an integer id as a number and any other id as a string
+func (id jsonID) MarshalJSON() ([]byte, error) {
+	if _, err := strconv.ParseInt(string(id), 10, 64); err == nil {
+		return []byte(id), nil
+	}
+	return json.Marshal(string(id))
+}
+
+// jsonOps maps the "op" field to an operation, by the names OpType prints
+var jsonOps = map[string]OpType{}
+
+func init() {
+	for _, op := range []OpType{OpGet, OpPut, OpCAS, OpDelete, OpIncrement, OpAppend} {
+		jsonOps[op.String()] = op
+	}
+}
+
+// event converts the record to the event fields parseLine extracts from a
+// log line.
+func (rec jsonRecord) event() (porcupine.EventKind, InputOutput, error) {
+	var kind porcupine.EventKind
+	switch rec.Phase {
+	case "call":
+		kind = porcupine.CallEvent
+	case "return":
+		kind = porcupine.ReturnEvent
+	default:
+		return kind, InputOutput{}, fmt.Errorf("phase %q is not call or return", rec.Phase)
+	}
+	op, ok := jsonOps[rec.Op]
+	if !ok {
+		return kind, InputOutput{}, fmt.Errorf("unknown op %q", rec.Op)
+	}
+	if rec.Client == "" || rec.Req == "" || rec.Key == nil {
+		return kind, InputOutput{}, errors.New("missing client, req or key")
+	}
+	if *rec.Key == "" {
+		return kind, InputOutput{}, errors.New("empty key")
+	}
+
+	v := InputOutput{Op: op, Key: *rec.Key, Delta: rec.Delta}
+	if op == OpGet && kind == porcupine.CallEvent {
+		v.Multi = rec.Multi
+	}
+	// A null or missing value in a return, or old value of a cas, means the
+	// key has no value; "NONE" is just a string
+	if rec.Value != nil {
+		v.Value = *rec.Value
+	} else if kind == porcupine.ReturnEvent {
+		v.None = true
+	}
+	if op == OpCAS && kind == porcupine.CallEvent {
+		if rec.Old != nil {
+			v.Old = *rec.Old
+		} else {
+			v.OldNone = true
+		}
+	}
+	if rec.Ts != "" {
+		ts, err := parseTime(rec.Ts)
+		if err != nil {
+			return kind, InputOutput{}, fmt.Errorf("invalid ts %q", rec.Ts)
+		}
+		v.Time = ts
+	}
+	return kind, v, nil
+}
+
+// ParseJSONL parses a log with one JSON object per line, such as
+//
+//	{"client":1,"req":55,"op":"put","key":"k","value":"v","phase":"call"}
+//
+// into porcupine events. op is one of get, put, cas, delete, incr and append;
+// phase is call or return. A cas call also has "old", an incr call "delta".
+// The get calls of the parts of a multi-get share a "multi" id.
+// Returns are linked to their calls by client and req, as in ParseLog, and
+// events are ordered by their "ts" timestamps if every record has one. Blank
+// lines are skipped, and lines that are not valid records are warned about
+// in the MatchStats and counted as unmatched.
+func ParseJSONL(r io.Reader) ([]porcupine.Event, MatchStats, error) {
+	lp := newLogParser(nil)
+	scanner := newLineScanner(r)
+	n := 1
+	for ; scanner.Scan(); n++ {
+		lp.parseJSONLine(n, scanner.Bytes())
+	}
+	return lp.finish(), lp.stats, scanError(scanner.Err(), n)
+}
+
+// parseJSONLine adds the event of line n of a JSON-lines log. Blank lines
+// are skipped.
+func (lp *logParser) parseJSONLine(n int, line []byte) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return
+	}
+	var rec jsonRecord
+	err := json.Unmarshal(line, &rec)
+	var kind porcupine.EventKind
+	var v InputOutput
+	if err == nil {
+		kind, v, err = rec.event()
+	}
+	if err != nil {
+		lp.stats.addName("")
+		lp.stats.warn(WarnInvalidRecord, "line %d: %v", n, strings.TrimPrefix(err.Error(), "json: "))
+		return
+	}
+	lp.stats.addName(rec.Phase)
+	lp.add(kind, string(rec.Client), string(rec.Session), string(rec.Req), v)
+}
+
+// WriteJSONL writes a history as JSON lines that ParseJSONL reads back as
+// the same history. Operations are numbered as requests in order of first
+// appearance. The synthesized return of an operation that never finished is
+// left out, so the operation is only logged as its call again.
+func WriteJSONL(w io.Writer, events []porcupine.Event) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	reqs := make(map[int]int)
+	for _, ev := range events {
+		v := ev.Value.(InputOutput)
+		if v.Pending {
+			continue
+		}
+		req, ok := reqs[ev.Id]
+		if !ok {
+			req = len(reqs) + 1
+			reqs[ev.Id] = req
+		}
+		key := v.Key
+		rec := jsonRecord{
+			Client: jsonID(strconv.Itoa(ev.ClientId)),
+			Req:    jsonID(strconv.Itoa(req)),
+			Op:     v.Op.String(),
+			Key:    &key,
+			Phase:  "call",
+		}
+		value := v.Value
+		if ev.Kind == porcupine.ReturnEvent {
+			rec.Phase = "return"
+			if !v.None {
+				rec.Value = &value
+			}
+		} else {
+			if v.Op == OpPut || v.Op == OpCAS || v.Op == OpAppend {
+				rec.Value = &value
+			}
+			if v.Op == OpCAS && !v.OldNone {
+				old := v.Old
+				rec.Old = &old
+			}
+			rec.Delta = v.Delta
+			rec.Multi = v.Multi
+		}
+		if !v.Time.IsZero() {
+			rec.Ts = v.Time.Format(time.RFC3339Nano)
+		}
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,160 @@
+package checker
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseJSONL(t *testing.T) {
+	tests := []struct {
+		name string
+		log  string
+		want []string
+	}{
+		{
+			name: "put then get",
+			log: `{"client":1,"req":1,"op":"put","key":"key_1","value":"a","phase":"call"}
+{"client":1,"req":1,"op":"put","key":"key_1","value":"a","phase":"return"}
+{"client":1,"req":2,"op":"get","key":"key_1","phase":"call"}
+{"client":1,"req":2,"op":"get","key":"key_1","value":"a","phase":"return"}`,
+			want: []string{
+				"call c1 #0 put key_1 a",
+				"ret c1 #0 put key_1 a",
+				"call c1 #1 get key_1",
+				"ret c1 #1 get key_1 a",
+			},
+		},
+		{
+			name: "values with arbitrary characters",
+			log: `{"client":"2","req":"7","op":"put","key":"user:42 profile","value":"say \"hi\" = ok\n","phase":"call"}
+{"client":"2","req":"7","op":"put","key":"user:42 profile","value":"say \"hi\" = ok\n","phase":"return"}`,
+			want: []string{
+				"call c2 #0 put user:42 profile say \"hi\" = ok\n",
+				"ret c2 #0 put user:42 profile say \"hi\" = ok\n",
+			},
+		},
+		{
+			name: "read of an unwritten key without a value",
+			log: `{"client":1,"req":1,"op":"get","key":"k","phase":"call"}
+{"client":1,"req":1,"op":"get","key":"k","value":null,"phase":"return"}`,
+			want: []string{
+				"call c1 #0 get k",
+				"ret c1 #0 get k NONE",
+			},
+		},
+		{
+			name: "the string NONE is a value",
+			log: `{"client":1,"req":1,"op":"put","key":"k","value":"NONE","phase":"call"}
+{"client":1,"req":1,"op":"put","key":"k","value":"NONE","phase":"return"}
+{"client":1,"req":2,"op":"get","key":"k","phase":"call"}
+{"client":1,"req":2,"op":"get","key":"k","value":"NONE","phase":"return"}`,
+			want: []string{
+				"call c1 #0 put k \"NONE\"",
+				"ret c1 #0 put k \"NONE\"",
+				"call c1 #1 get k",
+				"ret c1 #1 get k \"NONE\"",
+			},
+		},
+		{
+			name: "cas and incr",
+			log: `{"client":1,"req":1,"op":"cas","key":"k","old":"a","value":"b","phase":"call"}
+{"client":1,"req":1,"op":"cas","key":"k","value":"b","phase":"return"}
+{"client":1,"req":2,"op":"incr","key":"ctr","delta":-2,"phase":"call"}
+{"client":1,"req":2,"op":"incr","key":"ctr","value":"-2","phase":"return"}`,
+			want: []string{
+				"call c1 #0 cas k a->b",
+				"ret c1 #0 cas k b",
+				"call c1 #1 incr ctr -2",
+				"ret c1 #1 incr ctr -2",
+			},
+		},
+		{
+			name: "ordered by timestamp",
+			log: `{"client":1,"req":1,"op":"put","key":"k","value":"a","phase":"call","ts":"2025-01-02T15:04:05.100Z"}
+{"client":2,"req":1,"op":"get","key":"k","phase":"call","ts":"2025-01-02T15:04:05.300Z"}
+{"client":1,"req":1,"op":"put","key":"k","value":"a","phase":"return","ts":"2025-01-02T15:04:05.200Z"}
+{"client":2,"req":1,"op":"get","key":"k","value":"a","phase":"return","ts":"2025-01-02T15:04:05.400Z"}`,
+			want: []string{
+				"call c1 #0 put k a",
+				"ret c1 #0 put k a",
+				"call c2 #1 get k",
+				"ret c2 #1 get k a",
+			},
+		},
+		{
+			name: "sessions scope request ids",
+			log: `{"client":1,"session":"a","req":1,"op":"put","key":"k","value":"x","phase":"call"}
+{"client":1,"session":"b","req":1,"op":"get","key":"k","phase":"call"}
+{"client":1,"session":"a","req":1,"op":"put","key":"k","value":"x","phase":"return"}
+{"client":1,"session":"b","req":1,"op":"get","key":"k","value":"x","phase":"return"}`,
+			want: []string{
+				"call c1 #0 put k x",
+				"call c1 #1 get k",
+				"ret c1 #0 put k x",
+				"ret c1 #1 get k x",
+			},
+		},
+		{
+			name: "invalid records are skipped",
+			log: `not json
+{"client":1,"req":1,"op":"scan","key":"k","phase":"call"}
+{"client":1,"req":1,"op":"get","key":"k","phase":"start"}
+{"client":1,"req":1,"op":"get","phase":"call"}
+{"client":1,"req":1,"op":"get","key":"","phase":"call"}
+
+{"client":1,"req":1,"op":"get","key":"k","phase":"call"}
+{"client":1,"req":1,"op":"get","key":"k","value":null,"phase":"return"}`,
+			want: []string{
+				"call c1 #0 get k",
+				"ret c1 #0 get k NONE",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, stats, err := ParseJSONL(strings.NewReader(tt.log))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := eventStrings(events); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got events\n\t%s\nwant\n\t%s", strings.Join(got, "\n\t"), strings.Join(tt.want, "\n\t"))
+			}
+			if stats.Matched() != len(tt.want) {
+				t.Errorf("matched %d lines, want %d", stats.Matched(), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestWriteJSONL(t *testing.T) {
+	log := `{"client":1,"req":1,"op":"put","key":"k","value":"NONE","phase":"call","ts":"2025-01-02T15:04:05.100Z"}
+{"client":1,"req":1,"op":"put","key":"k","value":"NONE","phase":"return","ts":"2025-01-02T15:04:05.200Z"}
+{"client":2,"req":9,"op":"get","key":"k","phase":"call","ts":"2025-01-02T15:04:05.300Z"}
+{"client":2,"req":9,"op":"get","key":"k","value":null,"phase":"return","ts":"2025-01-02T15:04:05.400Z"}
+{"client":1,"req":2,"op":"cas","key":"k","old":null,"value":"b","phase":"call","ts":"2025-01-02T15:04:05.500Z"}
+{"client":1,"req":2,"op":"cas","key":"k","value":"b","phase":"return","ts":"2025-01-02T15:04:05.600Z"}
+{"client":1,"req":3,"op":"incr","key":"ctr","delta":-2,"phase":"call","ts":"2025-01-02T15:04:05.700Z"}
+{"client":1,"req":3,"op":"incr","key":"ctr","value":"-2","phase":"return","ts":"2025-01-02T15:04:05.800Z"}`
+	events, _, err := ParseJSONL(strings.NewReader(log))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf strings.Builder
+	if err := WriteJSONL(&buf, events); err != nil {
+		t.Fatal(err)
+	}
+	replayed, _, err := ParseJSONL(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, want := eventStrings(replayed), eventStrings(events)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("replayed events\n\t%s\nwant\n\t%s\nfrom\n%s", strings.Join(got, "\n\t"), strings.Join(want, "\n\t"), buf.String())
+	}
+	for i := range events {
+		if a, b := events[i].Value.(InputOutput), replayed[i].Value.(InputOutput); a.OldNone != b.OldNone || !a.Time.Equal(b.Time) {
+			t.Errorf("event %d: replayed %+v, want %+v", i, b, a)
+		}
+	}
+}
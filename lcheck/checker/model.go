@@ -0,0 +1,570 @@
+package checker
+
+import (
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anishathalye/porcupine"
+	"github.com/maruel/natural"
+)
+
+// OpType identifies the kind of operation an event belongs to
+type OpType int
+
+const (
+	OpGet OpType = iota
+	OpPut
+	OpCAS       // compare-and-swap: value becomes new only if it currently equals old
+	OpDelete    // resets the key to its initial value, or marks it deleted
+	OpIncrement // adds delta to a numeric counter
+	OpAppend    // concatenates value to the current string
+)
+
+func (o OpType) String() string {
+	switch o {
+	case OpGet:
+		return "get"
+	case OpPut:
+		return "put"
+	case OpCAS:
+		return "cas"
+	case OpDelete:
+		return "delete"
+	case OpIncrement:
+		return "incr"
+	case OpAppend:
+		return "append"
+	}
+	return fmt.Sprintf("OpType(%d)", int(o))
+}
+
+// NoneValue is how logs show a key that has not been written (or was
+// deleted). The models keep such a key apart from one holding the string
+// "NONE", which logs must quote to be told apart.
+const NoneValue = "NONE"
+
+// With Options.Tombstone set, a deleted key is kept apart from one never
+// written: a delete leaves the key deleted rather than unwritten, reads of a
+// deleted key return the tombstone, and reads of NONE are only legal while
+// the key was never written.
+
+// markTombstones returns a copy of a history with its deletes, its cas
+// calls expecting tombstone and its get and cas returns of tombstone marked
+// Deleted (or OldDeleted). The events of evs are not modified.
+func markTombstones(evs []porcupine.Event, tombstone string) []porcupine.Event {
+	marked := make([]porcupine.Event, len(evs))
+	for i, ev := range evs {
+		v := ev.Value.(InputOutput)
+		switch {
+		case ev.Kind == porcupine.CallEvent && v.Op == OpDelete:
+			v.Value, v.Deleted = tombstone, true
+		case ev.Kind == porcupine.CallEvent && v.Op == OpCAS:
+			v.OldDeleted = !v.OldNone && v.Old == tombstone
+		case ev.Kind == porcupine.ReturnEvent && (v.Op == OpGet || v.Op == OpCAS):
+			v.Deleted = !v.None && !v.Pending && v.Value == tombstone
+		}
+		ev.Value = v
+		marked[i] = ev
+	}
+	return marked
+}
+
+// InputOutput is the Value of every porcupine event of a parsed log, the
+// input of a call or the output of a return.
+type InputOutput struct {
+	Op    OpType
+	Key   string
+	Value string // put/append: written value; returns: value observed after the op
+	// None marks a return that observed no value, as the key was unwritten
+	// or deleted; Value is then empty
+	None    bool
+	Old     string    // cas call only: expected current value
+	OldNone bool      // cas call only: the key is expected to have no value
+	Delta   int64     // increment call only: amount added
+	Time    time.Time // log timestamp of the event, zero if the line had none
+	// Pending marks the synthesized return of an operation that never
+	// finished; its output is unknown, so any output is accepted
+	Pending bool
+	// Deleted marks a delete call that leaves the key deleted, and a get or
+	// cas return that observed a deleted key; Value is then the tombstone.
+	// OldDeleted marks a cas call that expects the key deleted, and Old is
+	// the tombstone. Both are only set with Options.Tombstone.
+	Deleted    bool
+	OldDeleted bool
+	// Multi is the id shared by the calls of the parts of a multi-get, a
+	// get of each key it reads, and 0 for any other operation
+	Multi int
+}
+
+// ValueString renders the observed value for display: NONE when there is
+// none, and a value that is the string "NONE" quoted.
+func (io InputOutput) ValueString() string {
+	return io.observed().String()
+}
+
+// observed returns the value of a return, or the value a put or cas call
+// writes, as a key state.
+func (io InputOutput) observed() keyValue {
+	if io.Deleted {
+		return keyValue{s: io.Value, deleted: true}
+	}
+	return keyValue{s: io.Value, none: io.None}
+}
+
+// expected returns the value a cas call expects the key to have.
+func (io InputOutput) expected() keyValue {
+	if io.OldDeleted {
+		return keyValue{s: io.Old, deleted: true}
+	}
+	return keyValue{s: io.Old, none: io.OldNone}
+}
+
+// deletedValue returns the state a delete call leaves its key in.
+func (io InputOutput) deletedValue() keyValue {
+	if io.Deleted {
+		return io.observed()
+	}
+	return noValue
+}
+
+// Values of numeric keys (see Options.NumericKeys) are compared as numbers:
+// every value that is a decimal number is replaced by its canonical form
+// before the key is checked, so that "007", " 7" and "7.0" all read back as
+// a write of 7. Other values, and appends, are left as they are.
+
+// reDecimal matches a decimal number, with an exponent small enough to
+// compute with exactly
+var reDecimal = regexp.MustCompile(`^[+-]?(?:\d+\.?\d*|\.\d+)(?:[eE][+-]?\d{1,3})?$`)
+
+// canonicalNumber returns the canonical form of a decimal number, which
+// may be surrounded by spaces: the shortest decimal of the same value,
+// without leading zeros. ok is false if s is not a decimal number.
+func canonicalNumber(s string) (canonical string, ok bool) {
+	t := strings.TrimSpace(s)
+	if !reDecimal.MatchString(t) {
+		return s, false
+	}
+	r, ok := new(big.Rat).SetString(t)
+	if !ok {
+		return s, false
+	}
+	if r.IsInt() {
+		return r.Num().String(), true
+	}
+	// A decimal's denominator is 2^a * 5^b, which max(a, b) places after
+	// the point represent exactly
+	n := 0
+	for _, p := range []int64{2, 5} {
+		d, q, m := new(big.Int).Set(r.Denom()), new(big.Int), new(big.Int)
+		bp := big.NewInt(p)
+		k := 0
+		for q.DivMod(d, bp, m); m.Sign() == 0; q.DivMod(d, bp, m) {
+			d.Set(q)
+			k++
+		}
+		if k > n {
+			n = k
+		}
+	}
+	return r.FloatString(n), true
+}
+
+// canonicalNumbers returns a copy of a history with the values of the keys
+// matching one of the patterns in canonical form (see canonicalNumber), and
+// the initial values likewise. The events of evs are not modified.
+func canonicalNumbers(evs []porcupine.Event, initValues map[string]string, patterns []string) ([]porcupine.Event, map[string]string) {
+	numeric := make(map[string]bool)
+	isNumeric := func(key string) bool {
+		n, ok := numeric[key]
+		if !ok {
+			for _, p := range patterns {
+				if ok, _ := filepath.Match(p, key); ok || p == key {
+					n = true
+					break
+				}
+			}
+			numeric[key] = n
+		}
+		return n
+	}
+	canonical := make([]porcupine.Event, len(evs))
+	for i, ev := range evs {
+		if v := ev.Value.(InputOutput); v.Op != OpAppend && isNumeric(v.Key) {
+			v.Value, _ = canonicalNumber(v.Value)
+			v.Old, _ = canonicalNumber(v.Old)
+			ev.Value = v
+		}
+		canonical[i] = ev
+	}
+	inits := make(map[string]string, len(initValues))
+	for k, v := range initValues {
+		if isNumeric(k) {
+			v, _ = canonicalNumber(v)
+		}
+		inits[k] = v
+	}
+	return canonical, inits
+}
+
+// keyValue is the state of one key in the models: a string, no value at
+// all, or deleted. It is a struct rather than a string so that no written
+// string can be mistaken for an unwritten or deleted key.
+type keyValue struct {
+	s    string
+	none bool // unwritten, or deleted without a tombstone; s is empty
+	// deleted marks a key deleted with Options.Tombstone set; s is the
+	// tombstone
+	deleted bool
+}
+
+// noValue is the state of a key that has not been written
+var noValue = keyValue{none: true}
+
+func (v keyValue) String() string {
+	switch {
+	case v.none:
+		return NoneValue
+	case v.deleted:
+		return v.s
+	case v.s == NoneValue, v.s == "":
+		// Bare, both would read back as no value
+		return strconv.Quote(v.s)
+	}
+	return v.s
+}
+
+// CounterInit is the initial value of a counter key
+const CounterInit = "0"
+
+// ================= Per-key model =================
+
+// singleKeyModel is the model of a plain key-value key
+var singleKeyModel = newKeyModel(noValue)
+
+// counterModel is the model of a key that is incremented
+var counterModel = NewKeyModel(CounterInit)
+
+// ModelFor picks the model for one key's events. A key with a configured
+// initial value starts there; otherwise keys that are ever incremented are
+// counters starting at 0, and all others start unwritten.
+func ModelFor(key string, evs []porcupine.Event, initValues map[string]string) porcupine.Model {
+	if init, ok := initValues[key]; ok {
+		return NewKeyModel(init)
+	}
+	for _, ev := range evs {
+		if ev.Value.(InputOutput).Op == OpIncrement {
+			return counterModel
+		}
+	}
+	return singleKeyModel
+}
+
+// ParseInitValues parses "key=value" assignments separated by commas or
+// newlines; blank lines and lines starting with '#' are ignored.
+func ParseInitValues(spec string, into map[string]string) error {
+	for _, item := range strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == '\n' }) {
+		item = strings.TrimSpace(item)
+		if item == "" || strings.HasPrefix(item, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(item, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return fmt.Errorf("invalid initial value %q (want key=value)", item)
+		}
+		into[strings.TrimSpace(key)] = unquoteValue(strings.TrimSpace(value))
+	}
+	return nil
+}
+
+// NewKeyModel returns the porcupine model of a single key starting at init.
+func NewKeyModel(init string) porcupine.Model {
+	return newKeyModel(keyValue{s: init})
+}
+
+// newKeyModel returns the porcupine model of a single key starting at init,
+// which may be noValue.
+func newKeyModel(init keyValue) porcupine.Model {
+	return porcupine.Model{
+		Init: func() interface{} {
+			// initial value for one key
+			return init
+		},
+		Step: func(state, input, output interface{}) (bool, interface{}) {
+			ok, next := stepKey(state.(keyValue), input.(InputOutput), output.(InputOutput))
+			return ok, next
+		},
+		Equal: func(a, b interface{}) bool {
+			return a.(keyValue) == b.(keyValue)
+		},
+		DescribeOperation: func(input, output interface{}) string {
+			return describeOp(input.(InputOutput), output.(InputOutput))
+		},
+	}
+}
+
+// stepKey applies one operation to a key whose value is curr. It reports
+// whether the operation's output is consistent with curr, and the key's
+// value afterwards.
+func stepKey(curr keyValue, in, out InputOutput) (bool, keyValue) {
+	observed := out.observed()
+	switch in.Op {
+	case OpPut:
+		return true, keyValue{s: in.Value}
+	case OpDelete:
+		return true, in.deletedValue()
+	case OpIncrement:
+		// The return carries the counter's total after the increment; a
+		// deleted counter starts again from 0
+		n := int64(0)
+		if !curr.none && !curr.deleted {
+			var err error
+			if n, err = strconv.ParseInt(curr.s, 10, 64); err != nil {
+				return false, curr // not a counter
+			}
+		}
+		next := keyValue{s: strconv.FormatInt(n+in.Delta, 10)}
+		return out.Pending || observed == next, next
+	case OpAppend:
+		// The return carries the accumulated value; appending to an
+		// unwritten or deleted key starts from the empty string
+		base := curr.s
+		if curr.deleted {
+			base = ""
+		}
+		next := keyValue{s: base + in.Value}
+		return out.Pending || observed == next, next
+	case OpCAS:
+		// The return carries the value after the CAS. A matching CAS must
+		// report the new value; a failed one is a no-op that reports the
+		// unchanged current value.
+		if curr == in.expected() {
+			next := keyValue{s: in.Value}
+			return out.Pending || observed == next, next
+		}
+		return out.Pending || observed == curr, curr
+	default: // get
+		return out.Pending || observed == curr, curr
+	}
+}
+
+// describeOp renders an operation for the visualization and violation
+// reports, e.g. "put(v)" or "get()=v".
+func describeOp(in, out InputOutput) string {
+	result := out.ValueString()
+	if out.Pending {
+		result = "?"
+	}
+	switch in.Op {
+	case OpPut:
+		return fmt.Sprintf("put(%v)", keyValue{s: in.Value})
+	case OpDelete:
+		return "delete()"
+	case OpIncrement:
+		return fmt.Sprintf("incr(%d)=%v", in.Delta, result)
+	case OpAppend:
+		if !out.Pending && !out.None {
+			result = strconv.Quote(out.Value)
+		}
+		return fmt.Sprintf("append(%q)=%s", in.Value, result)
+	case OpCAS:
+		return fmt.Sprintf("cas(%v, %v)=%v", in.expected(), keyValue{s: in.Value}, result)
+	default:
+		return fmt.Sprintf("get()=%v", result)
+	}
+}
+
+// ================= Model registry =================
+
+// DefaultModel names the built-in model of a key-value store, which picks
+// each key's model with ModelFor
+const DefaultModel = "kv"
+
+// registry holds the models added with RegisterModel, by name
+var registry = struct {
+	sync.RWMutex
+	models map[string]porcupine.Model
+}{models: make(map[string]porcupine.Model)}
+
+// RegisterModel makes a model available to Options.Model under name, for
+// workloads the key-value model does not describe, such as a set of values.
+// The model is stepped with the InputOutput values of a key's events; with
+// Options.WholeHistory it is stepped with those of every key. Without an
+// Equal states are compared with ==, and without a DescribeOperation
+// operations are described the way the key-value model describes them.
+// RegisterModel is meant to be called from an init function; it panics if
+// the name is empty or already taken, or the model has no Init or Step.
+func RegisterModel(name string, model porcupine.Model) {
+	if name == "" || name == DefaultModel {
+		panic(fmt.Sprintf("checker: cannot register a model named %q", name))
+	}
+	if model.Init == nil || model.Step == nil {
+		panic(fmt.Sprintf("checker: model %s needs Init and Step", name))
+	}
+	if model.Equal == nil {
+		model.Equal = func(a, b interface{}) bool { return a == b }
+	}
+	if model.DescribeOperation == nil {
+		model.DescribeOperation = func(input, output interface{}) string {
+			return describeOp(input.(InputOutput), output.(InputOutput))
+		}
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	if _, dup := registry.models[name]; dup {
+		panic(fmt.Sprintf("checker: model %s registered twice", name))
+	}
+	registry.models[name] = model
+}
+
+// Models returns the names Options.Model accepts, DefaultModel first and
+// the registered models after it in natural order.
+func Models() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+	names := make([]string, 0, len(registry.models))
+	for name := range registry.models {
+		names = append(names, name)
+	}
+	sort.Sort(natural.StringSlice(names))
+	return append([]string{DefaultModel}, names...)
+}
+
+// registeredModel returns the model registered under name, or false for
+// DefaultModel and unknown names.
+func registeredModel(name string) (porcupine.Model, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	model, ok := registry.models[name]
+	return model, ok
+}
+
+// ================= Whole-history model =================
+
+// HistoryKey labels the single combined history checked with
+// Options.WholeHistory
+const HistoryKey = "all-keys"
+
+// historyState is the state of the whole-history model: the value of each
+// key that has been touched, and the multi-gets being or done being read
+type historyState struct {
+	values map[string]keyValue
+	// open is the multi-get whose parts are being linearized, if any, and
+	// closed those an operation of its own came after. No part of a
+	// multi-get may come after its close, so that its parts read the store
+	// at one point.
+	open   int
+	closed map[int]bool
+}
+
+// NewHistoryModel returns a model of the whole store, for checking all keys'
+// operations as one history. Its state maps each key that has been touched to
+// its value; keys missing from it have the initial value of their per-key
+// model. The parts of a multi-get read the keys atomically: they are
+// linearized one right after the other.
+// This validates invariants across keys, at the price of one much larger
+// search than checking keys independently.
+func NewHistoryModel(evs []porcupine.Event, initValues map[string]string) porcupine.Model {
+	byKey := make(map[string][]porcupine.Event)
+	for _, ev := range evs {
+		key := ev.Value.(InputOutput).Key
+		byKey[key] = append(byKey[key], ev)
+	}
+	inits := make(map[string]keyValue, len(byKey))
+	for key, kevs := range byKey {
+		inits[key] = ModelFor(key, kevs, initValues).Init().(keyValue)
+	}
+
+	return porcupine.Model{
+		Init: func() interface{} {
+			return historyState{values: map[string]keyValue{}}
+		},
+		Step: func(state, input, output interface{}) (bool, interface{}) {
+			in := input.(InputOutput)
+			st := state.(historyState)
+			if in.Multi != 0 && st.closed[in.Multi] {
+				return false, state
+			}
+			curr, touched := st.values[in.Key]
+			if !touched {
+				curr = inits[in.Key]
+			}
+			legal, next := stepKey(curr, in, output.(InputOutput))
+			if !legal {
+				return false, state
+			}
+			// States are shared between search branches, so copy on write
+			if st.open != in.Multi {
+				if st.open != 0 {
+					closed := make(map[int]bool, len(st.closed)+1)
+					for m := range st.closed {
+						closed[m] = true
+					}
+					closed[st.open] = true
+					st.closed = closed
+				}
+				st.open = in.Multi
+			}
+			if next == curr {
+				return true, st
+			}
+			// Keys back at their initial value are dropped, so that equal
+			// stores have equal maps
+			updated := make(map[string]keyValue, len(st.values)+1)
+			for k, v := range st.values {
+				updated[k] = v
+			}
+			if next == inits[in.Key] {
+				delete(updated, in.Key)
+			} else {
+				updated[in.Key] = next
+			}
+			st.values = updated
+			return true, st
+		},
+		Equal: func(a, b interface{}) bool {
+			sa, sb := a.(historyState), b.(historyState)
+			if sa.open != sb.open || len(sa.values) != len(sb.values) || len(sa.closed) != len(sb.closed) {
+				return false
+			}
+			for k, v := range sa.values {
+				if w, ok := sb.values[k]; !ok || w != v {
+					return false
+				}
+			}
+			for m := range sa.closed {
+				if !sb.closed[m] {
+					return false
+				}
+			}
+			return true
+		},
+		DescribeOperation: func(input, output interface{}) string {
+			in := input.(InputOutput)
+			desc := in.Key + ": " + describeOp(in, output.(InputOutput))
+			if in.Multi != 0 {
+				desc += fmt.Sprintf(" (multi-get %d)", in.Multi)
+			}
+			return desc
+		},
+		DescribeState: func(state interface{}) string {
+			st := state.(historyState).values
+			keys := make([]string, 0, len(st))
+			for k := range st {
+				keys = append(keys, k)
+			}
+			SortKeys(keys)
+			parts := make([]string, len(keys))
+			for i, k := range keys {
+				parts[i] = k + "=" + st[k].String()
+			}
+			return "{" + strings.Join(parts, ", ") + "}"
+		},
+	}
+}
@@ -0,0 +1,308 @@
+package checker
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// op builds a porcupine operation of one client between call and ret.
+func op(client int, call, ret int64, in, out InputOutput) porcupine.Operation {
+	return porcupine.Operation{ClientId: client, Input: in, Call: call, Output: out, Return: ret}
+}
+
+func put(v string) InputOutput { return InputOutput{Op: OpPut, Key: "k", Value: v} }
+func get() InputOutput         { return InputOutput{Op: OpGet, Key: "k"} }
+func val(v string) InputOutput { return InputOutput{Key: "k", Value: v} }
+func none() InputOutput        { return InputOutput{Key: "k", None: true} }
+
+func cas(old, new string) InputOutput {
+	return InputOutput{Op: OpCAS, Key: "k", Old: old, Value: new}
+}
+
+func appendOp(v string) InputOutput { return InputOutput{Op: OpAppend, Key: "k", Value: v} }
+
+func incr(d int64) InputOutput { return InputOutput{Op: OpIncrement, Key: "k", Delta: d} }
+
+func TestSingleKeyModel(t *testing.T) {
+	tests := []struct {
+		name  string
+		model porcupine.Model
+		ops   []porcupine.Operation
+		want  bool
+	}{
+		{
+			name:  "read of unwritten key",
+			model: singleKeyModel,
+			ops:   []porcupine.Operation{op(1, 0, 1, get(), none())},
+			want:  true,
+		},
+		{
+			name:  "sequential put then get",
+			model: singleKeyModel,
+			ops: []porcupine.Operation{
+				op(1, 0, 1, put("a"), val("a")),
+				op(1, 2, 3, get(), val("a")),
+			},
+			want: true,
+		},
+		{
+			name:  "stale read after put completed",
+			model: singleKeyModel,
+			ops: []porcupine.Operation{
+				op(1, 0, 1, put("a"), val("a")),
+				op(2, 2, 3, get(), none()),
+			},
+			want: false,
+		},
+		{
+			name:  "concurrent read may see either value",
+			model: singleKeyModel,
+			ops: []porcupine.Operation{
+				op(1, 0, 10, put("a"), val("a")),
+				op(2, 1, 2, get(), none()),
+				op(3, 3, 4, get(), val("a")),
+			},
+			want: true,
+		},
+		{
+			name:  "reads going back in time",
+			model: singleKeyModel,
+			ops: []porcupine.Operation{
+				op(1, 0, 10, put("a"), val("a")),
+				op(2, 1, 2, get(), val("a")),
+				op(3, 3, 4, get(), none()),
+			},
+			want: false,
+		},
+		{
+			name:  "successful and failed cas",
+			model: singleKeyModel,
+			ops: []porcupine.Operation{
+				op(1, 0, 1, put("a"), val("a")),
+				op(1, 2, 3, cas("a", "b"), val("b")),
+				op(2, 4, 5, cas("a", "c"), val("b")),
+				op(2, 6, 7, get(), val("b")),
+			},
+			want: true,
+		},
+		{
+			name:  "cas reporting a value it could not have written",
+			model: singleKeyModel,
+			ops: []porcupine.Operation{
+				op(1, 0, 1, put("a"), val("a")),
+				op(1, 2, 3, cas("x", "b"), val("b")),
+			},
+			want: false,
+		},
+		{
+			name:  "delete resets the key",
+			model: singleKeyModel,
+			ops: []porcupine.Operation{
+				op(1, 0, 1, put("a"), val("a")),
+				op(1, 2, 3, InputOutput{Op: OpDelete, Key: "k"}, val("")),
+				op(2, 4, 5, get(), none()),
+			},
+			want: true,
+		},
+		{
+			name:  "the string NONE is not an unwritten key",
+			model: singleKeyModel,
+			ops: []porcupine.Operation{
+				op(1, 0, 1, put(NoneValue), val(NoneValue)),
+				op(1, 2, 3, get(), val(NoneValue)),
+				op(2, 4, 5, get(), none()),
+			},
+			want: false,
+		},
+		{
+			name:  "read of the string NONE",
+			model: singleKeyModel,
+			ops: []porcupine.Operation{
+				op(1, 0, 1, put(NoneValue), val(NoneValue)),
+				op(2, 2, 3, get(), val(NoneValue)),
+			},
+			want: true,
+		},
+		{
+			name:  "cas on an unwritten key",
+			model: singleKeyModel,
+			ops: []porcupine.Operation{
+				op(1, 0, 1, InputOutput{Op: OpCAS, Key: "k", OldNone: true, Value: "a"}, val("a")),
+				op(2, 2, 3, cas(NoneValue, "b"), val("a")),
+				op(2, 4, 5, get(), val("a")),
+			},
+			want: true,
+		},
+		{
+			name:  "pending operation may take effect late",
+			model: singleKeyModel,
+			ops: []porcupine.Operation{
+				op(1, 0, 100, put("a"), InputOutput{Key: "k", Pending: true}),
+				op(2, 1, 2, get(), none()),
+				op(2, 3, 4, get(), val("a")),
+			},
+			want: true,
+		},
+		{
+			name:  "appends accumulate from an unwritten key",
+			model: singleKeyModel,
+			ops: []porcupine.Operation{
+				op(1, 0, 1, appendOp("hello"), val("hello")),
+				op(1, 2, 3, appendOp(" world"), val("hello world")),
+				op(2, 4, 5, get(), val("hello world")),
+			},
+			want: true,
+		},
+		{
+			name:  "concurrent appends in either order",
+			model: singleKeyModel,
+			ops: []porcupine.Operation{
+				op(0, 0, 1, put("x"), val("x")),
+				op(1, 2, 5, appendOp("a"), val("xba")),
+				op(2, 3, 4, appendOp("b"), val("xb")),
+			},
+			want: true,
+		},
+		{
+			name:  "lost append",
+			model: singleKeyModel,
+			ops: []porcupine.Operation{
+				op(1, 0, 1, appendOp("a"), val("a")),
+				op(2, 2, 3, appendOp("b"), val("b")),
+			},
+			want: false,
+		},
+		{
+			name:  "concurrent increments",
+			model: counterModel,
+			ops: []porcupine.Operation{
+				op(1, 0, 3, incr(3), val("10")),
+				op(2, 1, 2, incr(7), val("7")),
+				op(1, 4, 5, get(), val("10")),
+			},
+			want: true,
+		},
+		{
+			name:  "lost increment",
+			model: counterModel,
+			ops: []porcupine.Operation{
+				op(1, 0, 1, incr(3), val("3")),
+				op(2, 2, 3, incr(7), val("7")),
+			},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := porcupine.CheckOperations(tt.model, tt.ops); got != tt.want {
+				t.Errorf("CheckOperations = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInitValues(t *testing.T) {
+	init := make(map[string]string)
+	if err := ParseInitValues("k=hello, ctr=5\n# comment", init); err != nil {
+		t.Fatal(err)
+	}
+	if init["k"] != "hello" || init["ctr"] != "5" || len(init) != 2 {
+		t.Fatalf("ParseInitValues = %v", init)
+	}
+	ops := []porcupine.Operation{op(1, 0, 1, get(), val("hello"))}
+	if !porcupine.CheckOperations(NewKeyModel(init["k"]), ops) {
+		t.Error("read of the initial value is not linearizable")
+	}
+	if err := ParseInitValues("novalue", init); err == nil {
+		t.Error("ParseInitValues accepted an item without '='")
+	}
+}
+
+func TestCanonicalNumber(t *testing.T) {
+	tests := []struct {
+		in, want string
+		ok       bool
+	}{
+		{"7", "7", true},
+		{"007", "7", true},
+		{" 7 ", "7", true},
+		{"+7", "7", true},
+		{"-0", "0", true},
+		{"7.0", "7", true},
+		{"7.50", "7.5", true},
+		{".25", "0.25", true},
+		{"1e3", "1000", true},
+		{"-1.5E-2", "-0.015", true},
+		{"123456789012345678901234567890", "123456789012345678901234567890", true},
+		{"0x10", "0x10", false},
+		{"1_000", "1_000", false},
+		{"1/2", "1/2", false},
+		{"1e9999", "1e9999", false},
+		{"seven", "seven", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := canonicalNumber(tt.in); got != tt.want || ok != tt.ok {
+			t.Errorf("canonicalNumber(%q) = %q, %t, want %q, %t", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// TestRegisterModel checks a key against a registered model of a set of
+// values, whose reads may return any value written so far.
+func TestRegisterModel(t *testing.T) {
+	RegisterModel("test-set", porcupine.Model{
+		Init: func() interface{} { return "" },
+		Step: func(state, input, output interface{}) (bool, interface{}) {
+			written := state.(string)
+			in, out := input.(InputOutput), output.(InputOutput)
+			if in.Op == OpPut {
+				return true, written + "," + in.Value
+			}
+			return out.None || strings.Contains(written+",", ","+out.Value+","), written
+		},
+	})
+	defer func() {
+		registry.Lock()
+		delete(registry.models, "test-set")
+		registry.Unlock()
+	}()
+	evs := events([]porcupine.Operation{
+		op(1, 0, 1, put("a"), val("a")),
+		op(1, 2, 3, put("b"), val("b")),
+		op(2, 4, 5, get(), val("a")),
+	})
+	grouped := map[string][]porcupine.Event{"k": evs}
+	if r := CheckKeys([]string{"k"}, grouped, Options{})[0]; r.Result != porcupine.Illegal {
+		t.Errorf("kv model: result = %v, want Illegal", r.Result)
+	}
+	r := CheckKeys([]string{"k"}, grouped, Options{Model: "test-set"})[0]
+	if r.Result != porcupine.Ok {
+		t.Errorf("set model: result = %v, want Ok", r.Result)
+	}
+	if got := r.Model.DescribeOperation(get(), val("a")); got != "get()=a" {
+		t.Errorf("default description = %q", got)
+	}
+
+	if got := strings.Join(Models(), " "); got != "kv test-set" {
+		t.Errorf("Models() = %s", got)
+	}
+	if _, err := CheckEvents(evs, Options{Model: "nope"}); err == nil || !strings.Contains(err.Error(), `unknown model "nope"`) {
+		t.Errorf("unknown model: err = %v", err)
+	}
+	if _, err := CheckEvents(evs, Options{Model: "test-set", InitValues: map[string]string{"k": "x"}}); err == nil {
+		t.Error("initial values accepted with a registered model")
+	}
+	for _, name := range []string{"", DefaultModel, "test-set"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("registering %q did not panic", name)
+				}
+			}()
+			RegisterModel(name, singleKeyModel)
+		}()
+	}
+}
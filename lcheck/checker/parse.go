@@ -0,0 +1,870 @@
+package checker
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// match returns the first pattern matching the line, without its trailing
+// blanks, and its submatches, or nil if no pattern matches.
+func (f *Format) match(line string) (*linePattern, []string) {
+	// A line of a log written on Windows, or passed through a tool that
+	// doubled its line ending, may still end in a \r that a pattern
+	// anchored at $ wouldn't match
+	line = strings.TrimRight(line, " \t\r")
+	for i := range f.patterns {
+		if m := f.patterns[i].re.FindStringSubmatch(line); m != nil {
+			return &f.patterns[i], m
+		}
+	}
+	return nil, nil
+}
+
+// MatchStats counts how many lines matched each pattern of a format, to tell
+// a log in the wrong format from one with a real violation, and collects the
+// warnings about the lines that were not parsed as they read.
+type MatchStats struct {
+	lines  int
+	counts map[string]int // lines matched, by pattern name
+	// duplicates counts the matched lines dropped as repeats of an earlier
+	// line (see Format.Dedup); they are in no pattern's count
+	duplicates int
+	warnings   []ParseWarning
+}
+
+// A ParseWarning is an anomaly found while parsing a log, such as a return
+// without a call. Message says what was done about it.
+type ParseWarning struct {
+	Category string `json:"category"`
+	Message  string `json:"message"`
+}
+
+// Categories of parse warnings
+const (
+	WarnEmptyKey         = "empty key"          // a matched line without a key, dropped
+	WarnInvalidRecord    = "invalid record"     // a JSON line that is not a record, dropped
+	WarnInvalidIncrement = "invalid increment"  // an increment by a non-number, dropped
+	WarnReusedRequest    = "reused request id"  // a call reusing the id of one in flight
+	WarnDuplicateReturn  = "duplicate return"   // a second return of a request, dropped
+	WarnUnmatchedReturn  = "unmatched return"   // a return without a call, dropped
+	WarnPutMismatch      = "put value mismatch" // a put return echoing another value
+	WarnNegativeDuration = "negative duration"  // a return timestamped before its call
+	WarnClientOverlap    = "client overlap"     // a call timestamped before its client's last return
+	WarnInvalidTimestamp = "invalid timestamp"  // a leading timestamp that does not parse, ignored
+)
+
+// minMatchRate is the share of matched lines below which the format is
+// suspected to be wrong for the log
+const minMatchRate = 0.01
+
+// add records one line and the pattern it matched, if any.
+func (s *MatchStats) add(p *linePattern) {
+	name := ""
+	if p != nil {
+		name = p.name
+	}
+	s.addName(name)
+}
+
+// addName records one line and the name of the kind of line it is, or "" if
+// it was not understood.
+func (s *MatchStats) addName(name string) {
+	s.lines++
+	if name == "" {
+		return
+	}
+	if s.counts == nil {
+		s.counts = make(map[string]int)
+	}
+	s.counts[name]++
+}
+
+// addDuplicate records one line dropped as a repeat.
+func (s *MatchStats) addDuplicate() {
+	s.lines++
+	s.duplicates++
+}
+
+// Lines returns the number of lines read.
+func (s *MatchStats) Lines() int {
+	return s.lines
+}
+
+// Matched returns the number of lines that matched a pattern.
+func (s *MatchStats) Matched() int {
+	n := s.duplicates
+	for _, c := range s.counts {
+		n += c
+	}
+	return n
+}
+
+// Duplicates returns the number of lines dropped as repeats of an earlier
+// line.
+func (s *MatchStats) Duplicates() int {
+	return s.duplicates
+}
+
+// warn records a warning of the given category.
+func (s *MatchStats) warn(category, format string, args ...interface{}) {
+	s.warnings = append(s.warnings, ParseWarning{Category: category, Message: fmt.Sprintf(format, args...)})
+}
+
+// Warnings returns the warnings about the lines parsed, in log order.
+func (s *MatchStats) Warnings() []ParseWarning {
+	return s.warnings
+}
+
+// AddWarnings records warnings collected elsewhere, such as while parsing
+// another log of a merged history.
+func (s *MatchStats) AddWarnings(warnings []ParseWarning) {
+	s.warnings = append(s.warnings, warnings...)
+}
+
+// PrintWarnings writes the warnings as a section grouped by category, in
+// order of each category's first warning, with the count of each. It
+// writes nothing if there are none.
+func (s *MatchStats) PrintWarnings(w io.Writer) {
+	if len(s.warnings) == 0 {
+		return
+	}
+	var categories []string
+	byCategory := make(map[string][]string)
+	for _, pw := range s.warnings {
+		if byCategory[pw.Category] == nil {
+			categories = append(categories, pw.Category)
+		}
+		byCategory[pw.Category] = append(byCategory[pw.Category], pw.Message)
+	}
+	fmt.Fprintf(w, "=== %d parse warnings ===\n", len(s.warnings))
+	for _, c := range categories {
+		fmt.Fprintf(w, "%s: %d\n", c, len(byCategory[c]))
+		for _, msg := range byCategory[c] {
+			fmt.Fprintf(w, "  %s\n", msg)
+		}
+	}
+}
+
+// Print writes a one-line summary of the matches, listing the patterns of
+// format in order (or every kind of line in name order if format is nil, as
+// for ParseJSONL), and a warning if hardly any line matched.
+func (s *MatchStats) Print(w io.Writer, format *Format) {
+	matched := s.Matched()
+	rate := 0.0
+	if s.lines > 0 {
+		rate = float64(matched) / float64(s.lines)
+	}
+	var names []string
+	if format != nil {
+		for _, p := range format.patterns {
+			names = append(names, p.name)
+		}
+	} else {
+		for name := range s.counts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	var parts []string
+	for _, name := range names {
+		if c := s.counts[name]; c > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d", name, c))
+		}
+	}
+	summary := fmt.Sprintf("Matched %d of %d lines (%.1f%%)", matched, s.lines, 100*rate)
+	if len(parts) > 0 {
+		summary += ": " + strings.Join(parts, ", ")
+	}
+	summary += fmt.Sprintf("; %d unmatched", s.lines-matched)
+	if s.duplicates > 0 {
+		summary += fmt.Sprintf("; %d duplicate lines dropped", s.duplicates)
+	}
+	fmt.Fprintln(w, summary)
+	if s.lines > 0 && rate < minMatchRate {
+		fmt.Fprintf(w, "WARNING: only %.1f%% of lines matched a log pattern; the log may not be in the expected format (see -format-config and -parse-only)\n", 100*rate)
+	}
+}
+
+// logParser turns matched log lines into porcupine events, linking each
+// return event to its call.
+type logParser struct {
+	format *Format
+	events []porcupine.Event
+	id     int
+	stats  MatchStats
+
+	// Maps "ClientID:ReqID" -> calls awaiting their return, oldest first.
+	// Request ids are assumed unique per client, or per client session if
+	// the format captures one ("ClientID/Session:ReqID"). There is more than
+	// one only if a client reused a request id (e.g. after its counter
+	// reset) before the earlier call returned, or if lines without a
+	// request id are stacked by client and key (see noReqKey).
+	pendingOps map[string][]pendingCall
+	// "ClientID:ReqID" of operations whose return has been seen, to tell a
+	// repeated return (e.g. a retried write logged twice) from a stray one
+	completedOps map[string]bool
+	// Returns seen before any call they could belong to, by
+	// "ClientID:ReqID". Buffered concurrent logging can write a return
+	// before its call, so they wait for a later call to claim them.
+	orphans map[string][]orphanReturn
+	// seen holds the lines parsed so far, to drop repeats with Format.Dedup
+	seen lineSet
+	// multi is the id of the latest multi-get call
+	multi int
+	// only, if set, is the one key whose parts of multi-gets are added, for
+	// a parser of a single key's lines (see Index.Load)
+	only string
+}
+
+// orphanReturn is a return event that was logged before its call
+type orphanReturn struct {
+	event    porcupine.Event
+	clientId string
+	reqId    string
+	pos      int // index in events where it was seen
+	// duplicate marks a return of a request that already returned: a
+	// repeat, unless a call reusing the request id is logged after it
+	duplicate bool
+}
+
+func newLogParser(format *Format) *logParser {
+	return &logParser{
+		format:       format,
+		pendingOps:   make(map[string][]pendingCall),
+		completedOps: make(map[string]bool),
+		orphans:      make(map[string][]orphanReturn),
+		seen:         make(lineSet),
+	}
+}
+
+// pendingCall is a call event whose return has not been seen yet
+type pendingCall struct {
+	id    int
+	op    OpType
+	key   string
+	value string // the value a put writes, to compare with its return's
+}
+
+// Helper to create a unique key for the map (e.g., "1:55", or "1/b:55" in
+// session b of client 1)
+func makeKey(clientId, session, reqId string) string {
+	if session != "" {
+		return clientId + "/" + session + ":" + reqId
+	}
+	return clientId + ":" + reqId
+}
+
+// noReqKey is the map key of the calls of a client on a key, for lines
+// without a request id. It cannot clash with makeKey's, as no captured
+// request id is empty.
+func noReqKey(clientId, session, key string) string {
+	return makeKey(clientId, session, "") + "\x00" + key
+}
+
+// field returns submatch i of a line, or "" if i is 0. Trailing whitespace,
+// such as a \r a greedy group took in, is no part of a key or value; a
+// quoted value keeps it inside its quotes.
+func field(m []string, i int) string {
+	if i == 0 {
+		return ""
+	}
+	return strings.TrimRightFunc(m[i], unicode.IsSpace)
+}
+
+// key returns the key of a line matching p: the one it captured, or with
+// keyFromClient, the client id if it captured none.
+func (f *Format) key(p *linePattern, m []string) string {
+	key := field(m, p.key)
+	if key == "" && f.keyFromClient {
+		key = field(m, p.client)
+	}
+	return key
+}
+
+// keys returns the keys of a line matching p: those a multi-get reads, or
+// the one key of any other line.
+func (f *Format) keys(p *linePattern, m []string) []string {
+	if !p.multi {
+		return []string{f.key(p, m)}
+	}
+	if p.kind == porcupine.ReturnEvent {
+		var keys []string
+		for _, pair := range reMultiPair.FindAllStringSubmatch(field(m, p.key), -1) {
+			keys = append(keys, pair[1])
+		}
+		return keys
+	}
+	var keys []string
+	seen := make(map[string]bool)
+	for _, key := range strings.Split(field(m, p.key), ",") {
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// emptyKey reports, and warns in stats, if a line matching p has an empty
+// key. A malformed line would otherwise make an operation on a key without
+// a name, so it is counted as unmatched instead.
+func (f *Format) emptyKey(p *linePattern, m []string, line string, stats *MatchStats) bool {
+	if p == nil || f.key(p, m) != "" {
+		return false
+	}
+	stats.warn(WarnEmptyKey, "skipping %s line with an empty key: %s", p.name, strings.TrimSpace(line))
+	return true
+}
+
+// lineSet records matched lines by the fields that make an operation's line,
+// to tell a repeated line with Format.Dedup
+type lineSet map[string]bool
+
+// repeat reports whether a line matching p repeats one seen before, and
+// records it otherwise. It is always false unless format dedups.
+func (seen lineSet) repeat(format *Format, p *linePattern, m []string) bool {
+	if p == nil || !format.dedup || field(m, p.req) == "" {
+		return false
+	}
+	fields := []string{p.name, field(m, p.client), field(m, p.session), field(m, p.req),
+		format.key(p, m), field(m, p.value), field(m, p.old), field(m, p.delta)}
+	line := strings.Join(fields, "\x00")
+	if seen[line] {
+		return true
+	}
+	seen[line] = true
+	return false
+}
+
+// parseLine adds the event of one log line, if it matches a pattern.
+func (lp *logParser) parseLine(line string) {
+	p, m := lp.format.match(line)
+	if lp.format.emptyKey(p, m, line, &lp.stats) {
+		p = nil
+	}
+	if lp.seen.repeat(lp.format, p, m) {
+		lp.stats.addDuplicate()
+		return
+	}
+	lp.stats.add(p)
+	if p == nil {
+		return
+	}
+
+	// group returns a captured field, or "" if the pattern doesn't capture it
+	group := func(i int) string { return field(m, i) }
+	clientId, reqId := group(p.client), group(p.req)
+	if p.multi {
+		lp.addMultiGet(p, m, clientId, group(p.session), reqId, lp.timestamp(line))
+		return
+	}
+	v := InputOutput{
+		Op:   p.op,
+		Key:  lp.format.key(p, m),
+		Time: lp.timestamp(line),
+	}
+	if p.kind == porcupine.CallEvent || p.op == OpPut {
+		// A written value, also as a put's return echoes it, is always a
+		// value, even if it reads NONE
+		v.Value = unquoteValue(group(p.value))
+	} else if p.value != 0 {
+		v.Value, v.None = observedValue(group(p.value))
+	}
+	if p.old != 0 {
+		v.Old, v.OldNone = observedValue(group(p.old))
+	}
+	if p.delta != 0 {
+		delta, err := strconv.ParseInt(group(p.delta), 10, 64)
+		if err != nil {
+			lp.stats.warn(WarnInvalidIncrement, "invalid increment %q for Client %s Req %s", group(p.delta), clientId, reqId)
+			return
+		}
+		v.Delta = delta
+	}
+	lp.add(p.kind, clientId, group(p.session), reqId, v)
+}
+
+// addMultiGet records the call or return of a multi-get, a line matching p,
+// as a get of each key it reads. The parts share the line's place in the
+// history and its timestamp, so that each key on its own sees independent
+// reads over the same interval. The calls of the parts share a Multi id, by
+// which the whole-history model reads them atomically. Each part is paired
+// with its return by the request id and its key.
+func (lp *logParser) addMultiGet(p *linePattern, m []string, clientId, session, reqId string, t time.Time) {
+	part := func(key string) string {
+		if reqId == "" {
+			return "" // paired by client and key anyway
+		}
+		return reqId + "/" + key
+	}
+	if p.kind == porcupine.CallEvent {
+		lp.multi++
+		for _, key := range lp.format.keys(p, m) {
+			if lp.only == "" || key == lp.only {
+				lp.add(p.kind, clientId, session, part(key), InputOutput{Op: OpGet, Key: key, Time: t, Multi: lp.multi})
+			}
+		}
+		return
+	}
+	for _, pair := range reMultiPair.FindAllStringSubmatch(field(m, p.key), -1) {
+		if lp.only != "" && pair[1] != lp.only {
+			continue
+		}
+		v := InputOutput{Op: OpGet, Key: pair[1], Time: t}
+		v.Value, v.None = observedValue(pair[2])
+		lp.add(p.kind, clientId, session, part(pair[1]), v)
+	}
+}
+
+// add records a call or return of request reqId of a client, linking a
+// return to its call. session, if not empty, is the client's connection or
+// session the request id is scoped to. Without a request id, a return is
+// linked to the latest unreturned call of the client on the same key with
+// the same operation, so a client with more than one such call in flight
+// may have its returns paired with the wrong calls.
+func (lp *logParser) add(kind porcupine.EventKind, clientId, session, reqId string, v InputOutput) {
+	cid, _ := strconv.Atoi(clientId)
+
+	lookupKey := makeKey(clientId, session, reqId)
+	noReq := reqId == ""
+	if noReq {
+		lookupKey = noReqKey(clientId, session, v.Key)
+		reqId = "(none)"
+	}
+	if session != "" {
+		reqId += " (session " + session + ")" // as the warnings name it
+	}
+	if kind == porcupine.CallEvent && lp.claimOrphan(lookupKey, cid, v) {
+		return
+	}
+	if kind == porcupine.CallEvent {
+		if prev := lp.pendingOps[lookupKey]; len(prev) > 0 && !noReq {
+			lp.stats.warn(WarnReusedRequest, "Client %s reused Req %s while an earlier call with it had not returned; pairing returns by key and operation", clientId, reqId)
+		}
+		// Store the porcupine ID in the map
+		lp.pendingOps[lookupKey] = append(lp.pendingOps[lookupKey], pendingCall{lp.id, v.Op, v.Key, v.Value})
+		lp.events = append(lp.events, porcupine.Event{
+			ClientId: cid,
+			Kind:     porcupine.CallEvent,
+			Value:    v,
+			Id:       lp.id,
+		})
+		lp.id++
+		return
+	}
+
+	calls := lp.pendingOps[lookupKey]
+	if len(calls) == 0 {
+		// A call logged after the return may still claim it, even one
+		// reusing the id of a request that already returned. Without
+		// request ids a return can't be told to repeat an earlier one.
+		v.Old, v.OldNone, v.Delta = "", false, 0
+		lp.orphans[lookupKey] = append(lp.orphans[lookupKey], orphanReturn{
+			event:     porcupine.Event{ClientId: cid, Kind: porcupine.ReturnEvent, Value: v},
+			clientId:  clientId,
+			reqId:     reqId,
+			pos:       len(lp.events),
+			duplicate: lp.completedOps[lookupKey] && !noReq,
+		})
+		return
+	}
+	i := matchCall(calls, v)
+	callId := calls[i].id
+	if calls[i].op == OpPut {
+		lp.warnPutMismatch(clientId, reqId, calls[i].value, v)
+	}
+	calls = append(calls[:i], calls[i+1:]...)
+	if len(calls) == 0 {
+		delete(lp.pendingOps, lookupKey) // Remove from map to keep it clean
+	} else {
+		lp.pendingOps[lookupKey] = calls
+	}
+	lp.completedOps[lookupKey] = true
+
+	v.Old, v.OldNone, v.Delta = "", false, 0
+	lp.events = append(lp.events, porcupine.Event{
+		ClientId: cid,
+		Kind:     porcupine.ReturnEvent,
+		Value:    v,
+		Id:       callId, // Links correctly to the specific start event
+	})
+}
+
+// claimOrphan links a call to a return of the same request, key and
+// operation that was logged before it, if there is one. The operation then
+// spans from the first of its two lines to the last: the call takes the
+// return's place and the return is appended, so that the interval covers
+// wherever either line lands. With timestamps, finish orders both by their
+// own time anyway.
+func (lp *logParser) claimOrphan(lookupKey string, cid int, call InputOutput) bool {
+	orphans := lp.orphans[lookupKey]
+	for i, o := range orphans {
+		ret := o.event.Value.(InputOutput)
+		if ret.Key != call.Key || ret.Op != call.Op {
+			continue
+		}
+		if call.Op == OpPut {
+			lp.warnPutMismatch(o.clientId, o.reqId, call.Value, ret)
+		}
+		if len(orphans) == 1 {
+			delete(lp.orphans, lookupKey)
+		} else {
+			lp.orphans[lookupKey] = append(orphans[:i:i], orphans[i+1:]...)
+		}
+		lp.completedOps[lookupKey] = true
+
+		callEvent := porcupine.Event{ClientId: cid, Kind: porcupine.CallEvent, Value: call, Id: lp.id}
+		lp.events = append(lp.events, porcupine.Event{})
+		copy(lp.events[o.pos+1:], lp.events[o.pos:])
+		lp.events[o.pos] = callEvent
+		for _, waiting := range lp.orphans {
+			for j := range waiting {
+				if waiting[j].pos >= o.pos {
+					waiting[j].pos++
+				}
+			}
+		}
+		o.event.Id = lp.id
+		lp.events = append(lp.events, o.event)
+		lp.id++
+		return true
+	}
+	return false
+}
+
+// warnPutMismatch warns if the return of a put logged a different value
+// than its call wrote, which points at a logging bug or reordered lines. The
+// call's value is the one checked. A return without a value, as a JSON
+// record may leave it, echoes nothing to compare.
+func (lp *logParser) warnPutMismatch(clientId, reqId, written string, ret InputOutput) {
+	if ret.Op != OpPut || ret.None || ret.Value == written {
+		return
+	}
+	lp.stats.warn(WarnPutMismatch, "put start/end value mismatch for Client %s Req %s: started with %q, ended with %q; checking the start value",
+		clientId, reqId, written, ret.Value)
+}
+
+// matchCall picks which of the pending calls sharing a request id a return
+// belongs to: the latest one on the same key with the same operation, else the
+// latest one on the same key, else the latest one.
+func matchCall(calls []pendingCall, ret InputOutput) int {
+	for i := len(calls) - 1; i >= 0; i-- {
+		if calls[i].key == ret.Key && calls[i].op == ret.Op {
+			return i
+		}
+	}
+	for i := len(calls) - 1; i >= 0; i-- {
+		if calls[i].key == ret.Key {
+			return i
+		}
+	}
+	return len(calls) - 1
+}
+
+// finish returns the parsed events in real-time order, and warns about the
+// returns no call claimed: repeats of a return, or returns without a call.
+func (lp *logParser) finish() []porcupine.Event {
+	var unclaimed []orphanReturn
+	for _, orphans := range lp.orphans {
+		unclaimed = append(unclaimed, orphans...)
+	}
+	sort.Slice(unclaimed, func(i, j int) bool { return unclaimed[i].pos < unclaimed[j].pos })
+	for _, o := range unclaimed {
+		if o.duplicate {
+			// The first return is the one the operation is linked to
+			lp.stats.warn(WarnDuplicateReturn, "duplicate return for Client %s Req %s, keeping the first", o.clientId, o.reqId)
+		} else {
+			lp.stats.warn(WarnUnmatchedReturn, "no matching start event for Client %s Req %s", o.clientId, o.reqId)
+		}
+	}
+	sortByTimestamp(lp.events)
+	return lp.events
+}
+
+// ==================================================
+// Revised log parsing (Handles out of order events)
+// ==================================================
+
+// ParseLog parses a log in the default EPaxos client format into porcupine
+// events, ordered by their timestamps if every matched line has one. The
+// parse warnings are written to Warnings, standard error by default. A test
+// harness should rather call ParseLogFormat with DefaultFormat, which
+// returns the warnings in its MatchStats.
+func ParseLog(r io.Reader) ([]porcupine.Event, error) {
+	events, stats, err := ParseLogFormat(r, DefaultFormat)
+	stats.PrintWarnings(Warnings)
+	return events, err
+}
+
+// ParseLogFormat is like ParseLog for logs in the given format, but returns
+// the parse warnings, and how many lines matched each pattern, in its
+// MatchStats instead of writing them anywhere.
+func ParseLogFormat(r io.Reader, format *Format) ([]porcupine.Event, MatchStats, error) {
+	lp := newLogParser(format)
+	scanner := newLineScanner(r)
+	n := 0
+	for ; scanner.Scan(); n++ {
+		lp.parseLine(scanner.Text())
+	}
+	return lp.finish(), lp.stats, scanError(scanner.Err(), n+1)
+}
+
+// newLineScanner returns a scanner of the lines of r, with a buffer growing
+// up to MaxLineSize.
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxLineSize)
+	return scanner
+}
+
+// scanError is the error a line scanner stopped with at line n, saying which
+// line was too long.
+func scanError(err error, n int) error {
+	if err == bufio.ErrTooLong {
+		return fmt.Errorf("line %d is longer than %d bytes", n, MaxLineSize)
+	}
+	return err
+}
+
+// reTimestamp matches an optional RFC3339-style timestamp at the start of a
+// line, e.g. "2025-01-02T15:04:05.123456Z  INFO ..."
+var reTimestamp = regexp.MustCompile(`^\s*(\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:?\d{2})?)`)
+
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999Z0700",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999Z0700",
+	"2006-01-02 15:04:05.999999999",
+}
+
+// timestamp returns the line's leading timestamp, or the zero time if it has
+// none or it does not parse, which is warned about: without a timestamp on
+// every line the log is kept in line order.
+func (lp *logParser) timestamp(line string) time.Time {
+	m := reTimestamp.FindStringSubmatch(line)
+	if m == nil {
+		return time.Time{}
+	}
+	ts, err := parseTime(m[1])
+	if err != nil {
+		lp.stats.warn(WarnInvalidTimestamp, "cannot parse timestamp %q, so the log is ordered by its lines: %v", m[1], err)
+	}
+	return ts
+}
+
+// parseTime parses a timestamp in one of timestampLayouts.
+func parseTime(s string) (time.Time, error) {
+	var err error
+	for _, layout := range timestampLayouts {
+		var ts time.Time
+		if ts, err = time.Parse(layout, s); err == nil {
+			return ts, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// hasTimestamps reports whether every event has a log timestamp.
+func hasTimestamps(events []porcupine.Event) bool {
+	for _, ev := range events {
+		if ev.Value.(InputOutput).Time.IsZero() {
+			return false
+		}
+	}
+	return true
+}
+
+// MergeHistories combines histories parsed from separate logs, such as one per
+// server, into one history. Each log numbers its operations and clients on
+// its own, so the event ids and client ids of every history are offset past
+// those of the histories before it. If every event has a timestamp the merged
+// events are in timestamp order and ordered is true; otherwise the histories
+// are concatenated, as if each log ran after the one before it.
+func MergeHistories(histories ...[]porcupine.Event) (events []porcupine.Event, ordered bool) {
+	idBase, clientBase, multiBase := 0, 0, 0
+	for _, h := range histories {
+		nextId, nextClient, nextMulti := idBase, clientBase, multiBase
+		for _, ev := range h {
+			ev.Id += idBase
+			ev.ClientId += clientBase
+			if v := ev.Value.(InputOutput); v.Multi != 0 {
+				v.Multi += multiBase
+				nextMulti = max(nextMulti, v.Multi)
+				ev.Value = v
+			}
+			nextId = max(nextId, ev.Id+1)
+			nextClient = max(nextClient, ev.ClientId+1)
+			events = append(events, ev)
+		}
+		idBase, clientBase, multiBase = nextId, nextClient, nextMulti
+	}
+	if !hasTimestamps(events) {
+		return events, false
+	}
+	sortByTimestamp(events)
+	return events, true
+}
+
+// sortByTimestamp orders the events by their log timestamps, so that lines
+// interleaved by concurrent writers reflect real-time order. Events with
+// equal timestamps keep their file order. If any event lacks a timestamp the
+// file order is kept as is.
+func sortByTimestamp(events []porcupine.Event) {
+	if !hasTimestamps(events) {
+		return
+	}
+	callTimes := make(map[int]time.Time)
+	for _, ev := range events {
+		if ev.Kind == porcupine.CallEvent {
+			callTimes[ev.Id] = ev.Value.(InputOutput).Time
+		}
+	}
+
+	// A return must never be ordered before its own call
+	at := func(ev porcupine.Event) time.Time {
+		ts := ev.Value.(InputOutput).Time
+		if call, ok := callTimes[ev.Id]; ok && ev.Kind == porcupine.ReturnEvent && ts.Before(call) {
+			return call
+		}
+		return ts
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return at(events[i]).Before(at(events[j]))
+	})
+}
+
+// CheckClocks looks for timestamps that only a bad clock can explain, and
+// returns a warning for each: a return timestamped before its call, which
+// is taken as returning at its call, and a call timestamped before the
+// previous operation of its client returned. A client that waits for each
+// operation before calling the next cannot overlap its own operations, so
+// with clamp such a call is moved to that return, and the events are
+// ordered by their timestamps again. Without clamp the call is kept, as a
+// client that pipelines its requests does overlap them. An operation that
+// never returned overlaps nothing, as its client may have given up on it.
+// A history without a timestamp on every event is left alone.
+func CheckClocks(events []porcupine.Event, clamp bool) []ParseWarning {
+	if !hasTimestamps(events) {
+		return nil
+	}
+	type timedOp struct {
+		call, ret int // event indices, ret -1 if the operation never returned
+		v         InputOutput
+	}
+	var ops []*timedOp
+	byId := make(map[int]*timedOp)
+	for i, ev := range events {
+		v := ev.Value.(InputOutput)
+		switch {
+		case ev.Kind == porcupine.CallEvent:
+			op := &timedOp{call: i, ret: -1, v: v}
+			ops = append(ops, op)
+			byId[ev.Id] = op
+		case !v.Pending && byId[ev.Id] != nil:
+			byId[ev.Id].ret = i
+		}
+	}
+	at := func(i int) time.Time { return events[i].Value.(InputOutput).Time }
+	describe := func(op *timedOp) string {
+		return fmt.Sprintf("%s %s", op.v.Op, op.v.Key)
+	}
+
+	var stats MatchStats
+	for _, op := range ops {
+		if op.ret >= 0 && at(op.ret).Before(at(op.call)) {
+			stats.warn(WarnNegativeDuration, "client %d: %s returned %v before its call; taken as returning at its call",
+				events[op.call].ClientId, describe(op), at(op.call).Sub(at(op.ret)))
+		}
+	}
+	// The operations of each client in order of their calls, each against
+	// the latest return of the client's operations called before it
+	sort.SliceStable(ops, func(i, j int) bool { return at(ops[i].call).Before(at(ops[j].call)) })
+	last := make(map[int]*timedOp)
+	moved := false
+	for _, op := range ops {
+		client := events[op.call].ClientId
+		prev := last[client]
+		if prev != nil && !(op.v.Multi != 0 && op.v.Multi == prev.v.Multi) {
+			call, returned := at(op.call), at(prev.ret)
+			if r := at(prev.call); returned.Before(r) {
+				returned = r
+			}
+			if call.Before(returned) {
+				done := "kept"
+				if clamp {
+					done = "moved to that return"
+					setTime(events, op.call, returned)
+					if op.ret >= 0 && at(op.ret).Before(returned) {
+						setTime(events, op.ret, returned)
+					}
+					moved = true
+				}
+				stats.warn(WarnClientOverlap, "client %d: %s called %v before its %s returned; %s",
+					client, describe(op), returned.Sub(call), describe(prev), done)
+			}
+		}
+		if op.ret >= 0 && (prev == nil || !at(op.ret).Before(at(prev.ret))) {
+			last[client] = op
+		}
+	}
+	if moved {
+		sortByTimestamp(events)
+	}
+	return stats.Warnings()
+}
+
+// setTime sets the timestamp of the event at index i.
+func setTime(events []porcupine.Event, i int, t time.Time) {
+	v := events[i].Value.(InputOutput)
+	v.Time = t
+	events[i].Value = v
+}
+
+// gzipMagic starts every gzip stream
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// OpenLog opens the log at filename, or standard input for "-". A
+// gzip-compressed log, recognized by its header rather than its extension,
+// is decompressed transparently.
+func OpenLog(filename string) (io.ReadCloser, error) {
+	var f io.ReadCloser = io.NopCloser(os.Stdin)
+	if filename != "-" {
+		file, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		f = file
+	}
+
+	br := bufio.NewReader(f)
+	if magic, _ := br.Peek(len(gzipMagic)); !bytes.Equal(magic, gzipMagic) {
+		return readCloser{br, f}, nil
+	}
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return readCloser{zr, f}, nil
+}
+
+// readCloser reads through a wrapper of the underlying file and closes the
+// file itself.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
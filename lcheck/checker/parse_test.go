@@ -0,0 +1,858 @@
+package checker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// eventStrings renders events compactly, e.g. "call c1 #0 put key_1 a",
+// so expected histories read like the log. An absent value shows as NONE,
+// the strings "NONE" and "" quoted.
+func eventStrings(events []porcupine.Event) []string {
+	var out []string
+	for _, e := range events {
+		v := e.Value.(InputOutput)
+		kind := "call"
+		if e.Kind == porcupine.ReturnEvent {
+			kind = "ret"
+		}
+		s := fmt.Sprintf("%s c%d #%d %s %s", kind, e.ClientId, e.Id, v.Op, v.Key)
+		switch {
+		case v.Op == OpCAS && e.Kind == porcupine.CallEvent:
+			s += " " + InputOutput{Value: v.Old, None: v.OldNone}.ValueString() + "->" + v.Value
+		case v.Op == OpIncrement && e.Kind == porcupine.CallEvent:
+			s += fmt.Sprintf(" %+d", v.Delta)
+		case v.Value != "" || v.None || (v.Op == OpGet && e.Kind == porcupine.ReturnEvent):
+			s += " " + v.ValueString()
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func TestParseLog(t *testing.T) {
+	tests := []struct {
+		name string
+		log  string
+		want []string
+	}{
+		{
+			name: "put then get",
+			log: `Client_1 [Req:1] Setting key_1 = a
+Client_1 [Req:1] Set key_1 = a
+Client_1 [Req:2] Getting key_1
+Client_1 [Req:2] Get key_1 = a`,
+			want: []string{
+				"call c1 #0 put key_1 a",
+				"ret c1 #0 put key_1 a",
+				"call c1 #1 get key_1",
+				"ret c1 #1 get key_1 a",
+			},
+		},
+		{
+			name: "non-numeric request ids",
+			log: `Client_1 [Req:a1f3-22] Setting key_1 = a
+Client_2 [Req: 9c0e-7b41-0d2f] Getting key_1
+Client_1 [Req:a1f3-22] Set key_1 = a
+Client_2 [Req: 9c0e-7b41-0d2f] Get key_1 = a`,
+			want: []string{
+				"call c1 #0 put key_1 a",
+				"call c2 #1 get key_1",
+				"ret c1 #0 put key_1 a",
+				"ret c2 #1 get key_1 a",
+			},
+		},
+		{
+			name: "interleaved clients",
+			log: `Client_1 [Req:1] Setting key_1 = a
+Client_2 [Req:1] Getting key_1
+Client_2 [Req:1] Get key_1 = NONE
+Client_1 [Req:1] Set key_1 = a`,
+			want: []string{
+				"call c1 #0 put key_1 a",
+				"call c2 #1 get key_1",
+				"ret c2 #1 get key_1 NONE",
+				"ret c1 #0 put key_1 a",
+			},
+		},
+		{
+			name: "dangling call",
+			log: `Client_1 [Req:1] Setting key_1 = a
+Client_2 [Req:7] Getting key_1
+Client_1 [Req:1] Set key_1 = a`,
+			want: []string{
+				"call c1 #0 put key_1 a",
+				"call c2 #1 get key_1",
+				"ret c1 #0 put key_1 a",
+			},
+		},
+		{
+			name: "return without call is dropped",
+			log: `Client_1 [Req:9] Set key_1 = a
+Client_1 [Req:1] Getting key_1
+Client_1 [Req:1] Get key_1 = NONE`,
+			want: []string{
+				"call c1 #0 get key_1",
+				"ret c1 #0 get key_1 NONE",
+			},
+		},
+		{
+			name: "duplicate return keeps the first",
+			log: `Client_1 [Req:1] Setting key_1 = a
+Client_1 [Req:1] Set key_1 = a
+Client_1 [Req:1] Set key_1 = a`,
+			want: []string{
+				"call c1 #0 put key_1 a",
+				"ret c1 #0 put key_1 a",
+			},
+		},
+		{
+			name: "reused request id returning before its call",
+			log: `Client_1 [Req:1] Setting key_1 = a
+Client_1 [Req:1] Set key_1 = a
+Client_1 [Req:1] Get key_1 = a
+Client_1 [Req:1] Getting key_1`,
+			want: []string{
+				"call c1 #0 put key_1 a",
+				"ret c1 #0 put key_1 a",
+				"call c1 #1 get key_1",
+				"ret c1 #1 get key_1 a",
+			},
+		},
+		{
+			name: "returns in a different order than their calls",
+			log: `Client_1 [Req:1] Setting key_1 = a
+Client_2 [Req:4] Setting key_1 = b
+Client_3 [Req:2] Getting key_1
+Client_3 [Req:2] Get key_1 = b
+Client_2 [Req:4] Set key_1 = b
+Client_1 [Req:1] Set key_1 = a`,
+			want: []string{
+				"call c1 #0 put key_1 a",
+				"call c2 #1 put key_1 b",
+				"call c3 #2 get key_1",
+				"ret c3 #2 get key_1 b",
+				"ret c2 #1 put key_1 b",
+				"ret c1 #0 put key_1 a",
+			},
+		},
+		{
+			name: "interleaved writers are ordered by timestamp",
+			log: `2025-01-02T15:04:05.100Z Client_1 [Req:1] Setting key_1 = a
+2025-01-02T15:04:05.300Z Client_2 [Req:1] Getting key_1
+2025-01-02T15:04:05.200Z Client_1 [Req:1] Set key_1 = a
+2025-01-02T15:04:05.400Z Client_2 [Req:1] Get key_1 = a`,
+			want: []string{
+				"call c1 #0 put key_1 a",
+				"ret c1 #0 put key_1 a",
+				"call c2 #1 get key_1",
+				"ret c2 #1 get key_1 a",
+			},
+		},
+		{
+			name: "timestamps with a space and a zone without a colon",
+			log: `2025-01-02 15:04:05.100+0100 Client_1 [Req:1] Setting key_1 = a
+2025-01-02 15:04:05.300+0100 Client_2 [Req:1] Getting key_1
+2025-01-02 15:04:05.200+0100 Client_1 [Req:1] Set key_1 = a
+2025-01-02 15:04:05.400+0100 Client_2 [Req:1] Get key_1 = a`,
+			want: []string{
+				"call c1 #0 put key_1 a",
+				"ret c1 #0 put key_1 a",
+				"call c2 #1 get key_1",
+				"ret c2 #1 get key_1 a",
+			},
+		},
+		{
+			name: "cas, delete and increment",
+			log: `Client_1 [Req:1] CASing key_1 old=a new=b
+Client_1 [Req:1] CAS key_1 = b
+Client_1 [Req:2] Deleting key_1
+Client_1 [Req:2] Deleted key_1
+Client_1 [Req:3] Incrementing ctr by -2
+Client_1 [Req:3] Incremented ctr = -2`,
+			want: []string{
+				"call c1 #0 cas key_1 a->b",
+				"ret c1 #0 cas key_1 b",
+				"call c1 #1 delete key_1",
+				"ret c1 #1 delete key_1",
+				"call c1 #2 incr ctr -2",
+				"ret c1 #2 incr ctr -2",
+			},
+		},
+		{
+			name: "append",
+			log: `Client_1 [Req:3] Appending ' world' to key_1
+Client_1 [Req:3] Appended key_1 = hello world
+Client_1 [Req:4] Appending 'it\'s' to key_1
+Client_1 [Req:4] Appended key_1 = "hello worldit's"`,
+			want: []string{
+				"call c1 #0 append key_1  world",
+				"ret c1 #0 append key_1 hello world",
+				"call c1 #1 append key_1 it's",
+				"ret c1 #1 append key_1 hello worldit's",
+			},
+		},
+		{
+			name: "quoted values and punctuated keys",
+			log: `Client_1 [Req:1] Setting user:42/profile = "hello world"
+Client_1 [Req:1] Set user:42/profile = "hello world"`,
+			want: []string{
+				"call c1 #0 put user:42/profile hello world",
+				"ret c1 #0 put user:42/profile hello world",
+			},
+		},
+		{
+			name: "bare NONE is no value, quoted NONE a string",
+			log: `Client_1 [Req:1] Getting key_1
+Client_1 [Req:1] Get key_1 = NONE
+Client_1 [Req:2] Setting key_1 = NONE
+Client_1 [Req:2] Set key_1 = NONE
+Client_1 [Req:3] Getting key_1
+Client_1 [Req:3] Get key_1 = "NONE"
+Client_1 [Req:4] CASing key_1 old=NONE new=a
+Client_1 [Req:4] CAS key_1 = "NONE"`,
+			want: []string{
+				"call c1 #0 get key_1",
+				"ret c1 #0 get key_1 NONE",
+				"call c1 #1 put key_1 \"NONE\"",
+				"ret c1 #1 put key_1 \"NONE\"",
+				"call c1 #2 get key_1",
+				"ret c1 #2 get key_1 \"NONE\"",
+				"call c1 #3 cas key_1 NONE->a",
+				"ret c1 #3 cas key_1 \"NONE\"",
+			},
+		},
+		{
+			name: "empty read is no value, quoted empty a string",
+			log: `Client_1 [Req:1] Getting key_1
+Client_1 [Req:1] Get key_1 =
+Client_1 [Req:2] Getting key_1
+Client_1 [Req:2] Get key_1 = ` + "\t" + `
+Client_1 [Req:3] Getting key_1
+Client_1 [Req:3] Get key_1 = ""`,
+			want: []string{
+				"call c1 #0 get key_1",
+				"ret c1 #0 get key_1 NONE",
+				"call c1 #1 get key_1",
+				"ret c1 #1 get key_1 NONE",
+				"call c1 #2 get key_1",
+				"ret c1 #2 get key_1 \"\"",
+			},
+		},
+		{
+			name: "return logged before its call",
+			log: `Client_1 [Req:1] Setting key_1 = a
+Client_2 [Req:1] Get key_1 = a
+Client_1 [Req:1] Set key_1 = a
+Client_2 [Req:1] Getting key_1`,
+			want: []string{
+				"call c1 #0 put key_1 a",
+				"call c2 #1 get key_1",
+				"ret c1 #0 put key_1 a",
+				"ret c2 #1 get key_1 a",
+			},
+		},
+		{
+			name: "return logged before its call, with timestamps",
+			log: `2025-01-01T00:00:03Z Client_2 [Req:1] Get key_1 = a
+2025-01-01T00:00:00Z Client_1 [Req:1] Setting key_1 = a
+2025-01-01T00:00:01Z Client_2 [Req:1] Getting key_1
+2025-01-01T00:00:02Z Client_1 [Req:1] Set key_1 = a`,
+			want: []string{
+				"call c1 #0 put key_1 a",
+				"call c2 #1 get key_1",
+				"ret c1 #0 put key_1 a",
+				"ret c2 #1 get key_1 a",
+			},
+		},
+		{
+			name: "early return of another operation is not claimed",
+			log: `Client_2 [Req:1] Get key_1 = a
+Client_2 [Req:1] Setting key_2 = b
+Client_2 [Req:1] Set key_2 = b`,
+			want: []string{
+				"call c2 #0 put key_2 b",
+				"ret c2 #0 put key_2 b",
+			},
+		},
+		{
+			name: "unrelated lines are ignored",
+			log: `starting replica 3
+Client_1 [Req:1] Getting key_1
+commit 12 ok
+Client_1 [Req:1] Get key_1 = NONE`,
+			want: []string{
+				"call c1 #0 get key_1",
+				"ret c1 #0 get key_1 NONE",
+			},
+		},
+		{
+			name: "multi-get as a get of each key",
+			log:  "Client_1 [Req:8] MultiGetting key_1,key_2,key_1\nClient_2 [Req:1] Setting key_2 = b\nClient_1 [Req:8] MultiGet key_1=NONE,key_2=\"b c\"\nClient_2 [Req:1] Set key_2 = b\n",
+			want: []string{
+				"call c1 #0 get key_1",
+				"call c1 #1 get key_2",
+				"call c2 #2 put key_2 b",
+				"ret c1 #0 get key_1 NONE",
+				"ret c1 #1 get key_2 b c",
+				"ret c2 #2 put key_2 b",
+			},
+		},
+		{
+			name: "CRLF line endings and trailing whitespace",
+			log:  "Client_1 [Req:1] Setting key_1 = a\r\r\nClient_1 [Req:1] Set key_1 = a \t\r\nClient_1 [Req:2] Getting key_1\r\nClient_1 [Req:2] Get key_1 = a\r\n",
+			want: []string{
+				"call c1 #0 put key_1 a",
+				"ret c1 #0 put key_1 a",
+				"call c1 #1 get key_1",
+				"ret c1 #1 get key_1 a",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, _, err := ParseLogFormat(strings.NewReader(tt.log), DefaultFormat)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := eventStrings(events); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got events\n\t%s\nwant\n\t%s", strings.Join(got, "\n\t"), strings.Join(tt.want, "\n\t"))
+			}
+		})
+	}
+}
+
+// loadTestFormat loads a format config given as JSON.
+func loadTestFormat(t *testing.T, config string) *Format {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "format.json")
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	format, err := LoadFormat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return format
+}
+
+// TestParseLogFormatCRLF checks a custom format whose groups take the rest
+// of the line: with a CRLF log they used to capture the \r, and the read
+// seemed to return a value different from the one written.
+func TestParseLogFormatCRLF(t *testing.T) {
+	config := `{
+	"setterStart": {"regex": "C(\\d+) R(\\d+) put (\\w+) (.*)", "client": 1, "req": 2, "key": 3, "value": 4},
+	"setterEnd":   {"regex": "C(\\d+) R(\\d+) put-ok (\\w+) (.*)", "client": 1, "req": 2, "key": 3, "value": 4},
+	"getterStart": {"regex": "C(\\d+) R(\\d+) get (\\w+)$", "client": 1, "req": 2, "key": 3},
+	"getterEnd":   {"regex": "C(\\d+) R(\\d+) get-ok (\\w+) (.*)", "client": 1, "req": 2, "key": 3, "value": 4}
+}`
+	format := loadTestFormat(t, config)
+	log := "C1 R1 put k hello world\r\r\nC1 R1 put-ok k hello world\r\nC2 R1 get k\r\nC2 R1 get-ok k hello world \r\n"
+	events, stats, err := ParseLogFormat(strings.NewReader(log), format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Matched() != 4 {
+		t.Fatalf("matched %d of 4 lines", stats.Matched())
+	}
+	res, err := CheckEvents(events, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != porcupine.Ok {
+		t.Errorf("status = %v, want Ok; events %q", res.Status, eventStrings(events))
+	}
+}
+
+func TestParseLogFormatSessions(t *testing.T) {
+	config := `{
+	"setterStart": {"regex": "C(\\d+)(?: S(\\w+))? R(\\d+) put (\\w+) (\\S+)", "client": 1, "session": 2, "req": 3, "key": 4, "value": 5},
+	"setterEnd":   {"regex": "C(\\d+)(?: S(\\w+))? R(\\d+) put-ok (\\w+) (\\S+)", "client": 1, "session": 2, "req": 3, "key": 4, "value": 5},
+	"getterStart": {"regex": "C(\\d+)(?: S(\\w+))? R(\\d+) get (\\w+)$", "client": 1, "session": 2, "req": 3, "key": 4},
+	"getterEnd":   {"regex": "C(\\d+)(?: S(\\w+))? R(\\d+) get-ok (\\w+) (\\S+)", "client": 1, "session": 2, "req": 3, "key": 4, "value": 5}
+}`
+	format := loadTestFormat(t, config)
+	// Both connections of client 1 number their requests from 1. Unscoped,
+	// the first return would pair with the latest call, the put of y. The
+	// lines of client 2 have no session and pair by client and request.
+	log := `C1 Sa R1 put k x
+C1 Sb R1 put k y
+C1 Sa R1 put-ok k x
+C1 Sb R1 put-ok k y
+C2 R1 get k
+C2 R1 get-ok k y`
+	events, _, err := ParseLogFormat(strings.NewReader(log), format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"call c1 #0 put k x",
+		"call c1 #1 put k y",
+		"ret c1 #0 put k x",
+		"ret c1 #1 put k y",
+		"call c2 #2 get k",
+		"ret c2 #2 get k y",
+	}
+	if got := eventStrings(events); !reflect.DeepEqual(got, want) {
+		t.Errorf("got events\n\t%s\nwant\n\t%s", strings.Join(got, "\n\t"), strings.Join(want, "\n\t"))
+	}
+}
+
+func TestParseLogFormatEmptyKey(t *testing.T) {
+	format := loadTestFormat(t, `{
+	"setterStart": {"regex": "C(\\d+) R(\\d+) put (\\S*) = (\\S+)", "client": 1, "req": 2, "key": 3, "value": 4},
+	"setterEnd":   {"regex": "C(\\d+) R(\\d+) put-ok (\\S*) = (\\S+)", "client": 1, "req": 2, "key": 3, "value": 4},
+	"getterStart": {"regex": "C(\\d+) R(\\d+) get (\\S*)", "client": 1, "req": 2, "key": 3},
+	"getterEnd":   {"regex": "C(\\d+) R(\\d+) get-ok (\\S*) = (\\S+)", "client": 1, "req": 2, "key": 3, "value": 4}
+}`)
+	log := `C1 R1 put  = a
+C1 R1 put-ok  = a
+C1 R2 put k = b
+C1 R2 put-ok k = b`
+	events, stats, err := ParseLogFormat(strings.NewReader(log), format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"call c1 #0 put k b", "ret c1 #0 put k b"}
+	if got := eventStrings(events); !reflect.DeepEqual(got, want) {
+		t.Errorf("got events %q, want %q", got, want)
+	}
+	if stats.Matched() != 2 {
+		t.Errorf("matched %d lines, want 2", stats.Matched())
+	}
+	if got := stats.Warnings(); len(got) != 2 || got[0].Category != WarnEmptyKey || got[1].Category != WarnEmptyKey {
+		t.Errorf("got warnings %v, want 2 of empty keys", got)
+	}
+	if _, ok := SplitEventsByKey(events)[""]; ok {
+		t.Error("events grouped under an empty key")
+	}
+}
+
+func TestParseLogFormatKeyFromClient(t *testing.T) {
+	format := loadTestFormat(t, `{
+	"setterStart": {"regex": "C(\\d+) R(\\d+) write (\\S+)", "client": 1, "req": 2, "value": 3},
+	"setterEnd":   {"regex": "C(\\d+) R(\\d+) wrote (\\S+)", "client": 1, "req": 2, "value": 3},
+	"getterStart": {"regex": "C(\\d+) R(\\d+) read$", "client": 1, "req": 2},
+	"getterEnd":   {"regex": "C(\\d+) R(\\d+) read (\\S+)", "client": 1, "req": 2, "value": 3}
+}`)
+	if !format.Keyless() {
+		t.Fatal("format without key groups is not keyless")
+	}
+	log := `C1 R1 write a
+C2 R1 write b
+C1 R1 wrote a
+C2 R1 wrote b
+C1 R2 read
+C1 R2 read a`
+	events, _, err := ParseLogFormat(strings.NewReader(log), format.KeyFromClient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"call c1 #0 put 1 a",
+		"call c2 #1 put 2 b",
+		"ret c1 #0 put 1 a",
+		"ret c2 #1 put 2 b",
+		"call c1 #2 get 1",
+		"ret c1 #2 get 1 a",
+	}
+	if got := eventStrings(events); !reflect.DeepEqual(got, want) {
+		t.Errorf("got events %q, want %q", got, want)
+	}
+
+	// A key captured by the line is kept
+	events, _, err = ParseLogFormat(strings.NewReader("Client_1 [Req:1] Setting k = v"), DefaultFormat.KeyFromClient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := events[0].Value.(InputOutput).Key; got != "k" {
+		t.Errorf("key = %q, want k", got)
+	}
+}
+
+func TestParseLogFormatDedup(t *testing.T) {
+	// Both lines of the put and the get's return are delivered twice; the
+	// repeated get without a request id is kept
+	log := `Client_1 [Req:1] Setting k = a
+Client_1 [Req:1] Setting k = a
+Client_1 [Req:1] Set k = a
+Client_2 [Req:1] Getting k
+Client_1 [Req:1] Set k = a
+Client_2 [Req:1] Get k = a
+Client_2 [Req:1] Get k = a
+Client_2 Getting k
+Client_2 Get k = a
+Client_2 Getting k
+Client_2 Get k = a`
+	events, stats, err := ParseLogFormat(strings.NewReader(log), DefaultFormat.Dedup())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"call c1 #0 put k a",
+		"ret c1 #0 put k a",
+		"call c2 #1 get k",
+		"ret c2 #1 get k a",
+		"call c2 #2 get k",
+		"ret c2 #2 get k a",
+		"call c2 #3 get k",
+		"ret c2 #3 get k a",
+	}
+	if got := eventStrings(events); !reflect.DeepEqual(got, want) {
+		t.Errorf("got events %q, want %q", got, want)
+	}
+	if stats.Duplicates() != 3 || stats.Matched() != 11 {
+		t.Errorf("%d duplicates of %d matched lines, want 3 of 11", stats.Duplicates(), stats.Matched())
+	}
+
+	// Without Dedup the repeated put is a second operation
+	events, stats, _ = ParseLogFormat(strings.NewReader(log), DefaultFormat)
+	if len(events) != 10 || stats.Duplicates() != 0 {
+		t.Errorf("without dedup: %d events, %d duplicates; want 10 and 0", len(events), stats.Duplicates())
+	}
+}
+
+func TestParseLogDuplicateReturn(t *testing.T) {
+	log := `Client_1 [Req:1] Setting k = a
+Client_1 [Req:1] Set k = a
+Client_1 [Req:1] Set k = a
+Client_1 [Req:2] Get k = a
+Client_1 [Req:2] Getting k
+Client_1 [Req:2] Get k = a`
+	events, stats, err := ParseLogFormat(strings.NewReader(log), DefaultFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 4 {
+		t.Errorf("got events %q, want the put and the get", eventStrings(events))
+	}
+	want := []ParseWarning{
+		{WarnDuplicateReturn, "duplicate return for Client 1 Req 1, keeping the first"},
+		{WarnDuplicateReturn, "duplicate return for Client 1 Req 2, keeping the first"},
+	}
+	if got := stats.Warnings(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got warnings\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestParseLogPutMismatch(t *testing.T) {
+	log := `Client_1 [Req:1] Setting k = a
+Client_1 [Req:1] Set k = b
+Client_1 [Req:2] Setting k = c
+Client_1 [Req:2] Set k = c
+Client_2 [Req:1] Set k = d
+Client_2 [Req:1] Setting k = e`
+	_, stats, err := ParseLogFormat(strings.NewReader(log), DefaultFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ParseWarning{
+		{WarnPutMismatch, `put start/end value mismatch for Client 1 Req 1: started with "a", ended with "b"; checking the start value`},
+		{WarnPutMismatch, `put start/end value mismatch for Client 2 Req 1: started with "e", ended with "d"; checking the start value`},
+	}
+	if got := stats.Warnings(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got warnings\n%v\nwant\n%v", got, want)
+	}
+
+	// A JSON-lines put whose return has no value is not a mismatch
+	jsonl := `{"client":1,"req":1,"op":"put","key":"k","value":"a","phase":"call"}
+{"client":1,"req":1,"op":"put","key":"k","phase":"return"}`
+	_, stats, err = ParseJSONL(strings.NewReader(jsonl))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := stats.Warnings(); len(got) != 0 {
+		t.Errorf("got warnings %v for a return without a value", got)
+	}
+}
+
+func TestPrintWarnings(t *testing.T) {
+	log := `Client_1 [Req:1] Set k = a
+Client_1 [Req:2] Setting k = b
+Client_1 [Req:2] Set k = c
+Client_2 [Req:1] Get k = a`
+	_, stats, err := ParseLogFormat(strings.NewReader(log), DefaultFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got strings.Builder
+	stats.PrintWarnings(&got)
+	want := `=== 3 parse warnings ===
+put value mismatch: 1
+  put start/end value mismatch for Client 1 Req 2: started with "b", ended with "c"; checking the start value
+unmatched return: 2
+  no matching start event for Client 1 Req 1
+  no matching start event for Client 2 Req 1
+`
+	if got.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", got.String(), want)
+	}
+}
+
+func TestParseLogWithoutReqIds(t *testing.T) {
+	// Returns pair with their client's latest call on the key; the get of
+	// b is logged before its call
+	log := `Client_1 Setting a = 1
+Client_2 Getting a
+Client_1 Get b = NONE
+Client_1 Getting b
+Client_1 Set a = 1
+Client_2 Getting a
+Client_2 Get a = 1
+Client_2 Get a = 1
+Client_1 Setting a = 2
+Client_1 [Req: 9] Getting a
+Client_1 [Req: 9] Get a = 1
+Client_1 Set a = 2`
+	events, stats, err := ParseLogFormat(strings.NewReader(log), DefaultFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"call c1 #0 put a 1",
+		"call c2 #1 get a",
+		"call c1 #2 get b",
+		"ret c1 #2 get b NONE",
+		"ret c1 #0 put a 1",
+		"call c2 #3 get a",
+		"ret c2 #3 get a 1",
+		"ret c2 #1 get a 1",
+		"call c1 #4 put a 2",
+		"call c1 #5 get a",
+		"ret c1 #5 get a 1",
+		"ret c1 #4 put a 2",
+	}
+	if got := eventStrings(events); !reflect.DeepEqual(got, want) {
+		t.Errorf("got events\n%q\nwant\n%q", got, want)
+	}
+	if got := stats.Warnings(); len(got) != 0 {
+		t.Errorf("got warnings %v", got)
+	}
+}
+
+func TestParseLogFormatStats(t *testing.T) {
+	log := `Client_1 [Req:1] Setting key_1 = a
+noise
+Client_1 [Req:1] Set key_1 = a`
+	_, stats, err := ParseLogFormat(strings.NewReader(log), DefaultFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Lines() != 3 || stats.Matched() != 2 {
+		t.Errorf("got %d of %d lines matched, want 2 of 3", stats.Matched(), stats.Lines())
+	}
+}
+
+// TestParseMultiGet checks that the parts of a multi-get share its id, also
+// across merged logs, and that a key's lines loaded on their own hold only
+// its part.
+func TestParseMultiGet(t *testing.T) {
+	log := `Client_1 [Req:1] MultiGetting x,y
+Client_1 [Req:1] MultiGet x=1,y=2
+Client_1 [Req:2] MultiGetting x,y
+Client_1 [Req:2] MultiGet x=1,y=2
+`
+	events, _, err := ParseLogFormat(strings.NewReader(log), DefaultFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged, _ := MergeHistories(events, events)
+	var multis []int
+	for _, ev := range merged {
+		if ev.Kind == porcupine.CallEvent {
+			multis = append(multis, ev.Value.(InputOutput).Multi)
+		}
+	}
+	if want := []int{1, 1, 2, 2, 3, 3, 4, 4}; !reflect.DeepEqual(multis, want) {
+		t.Errorf("multi-get ids = %v, want %v", multis, want)
+	}
+
+	path := filepath.Join(t.TempDir(), "multi.log")
+	if err := os.WriteFile(path, []byte(log), 0644); err != nil {
+		t.Fatal(err)
+	}
+	index, err := IndexLog(path, DefaultFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := index.Keys(); !reflect.DeepEqual(got, []string{"x", "y"}) {
+		t.Fatalf("indexed keys = %v", got)
+	}
+	grouped, err := index.Load([]string{"y"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"call c1 #0 get y", "ret c1 #0 get y 2", "call c1 #1 get y", "ret c1 #1 get y 2"}
+	if got := eventStrings(grouped["y"]); !reflect.DeepEqual(got, want) {
+		t.Errorf("loaded y as %v, want %v", got, want)
+	}
+	stats := index.Stats()
+	if w := stats.Warnings(); len(w) > 0 {
+		t.Errorf("warnings = %v", w)
+	}
+}
+
+// TestParseLongLines checks that lines longer than a bufio.Scanner's default
+// buffer are parsed, and that a line longer than MaxLineSize fails the parse
+// rather than ending it.
+func TestParseLongLines(t *testing.T) {
+	long := strings.Repeat("v", 100*1024)
+	log := "Client_1 [Req:1] Setting k = " + long + "\nClient_1 [Req:1] Set k = " + long + "\n" +
+		"Client_2 [Req:1] Getting k\nClient_2 [Req:1] Get k = " + long + "\n"
+	jsonl := `{"client":1,"req":1,"op":"put","key":"k","value":"` + long + `","phase":"call"}` + "\n" +
+		`{"client":1,"req":1,"op":"put","key":"k","value":"` + long + `","phase":"return"}` + "\n"
+	parse := map[string]func() ([]porcupine.Event, error){
+		"text": func() ([]porcupine.Event, error) {
+			events, _, err := ParseLogFormat(strings.NewReader(log), DefaultFormat)
+			return events, err
+		},
+		"jsonl": func() ([]porcupine.Event, error) {
+			events, _, err := ParseJSONL(strings.NewReader(jsonl))
+			return events, err
+		},
+	}
+	for name, parse := range parse {
+		events, err := parse()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(events) == 0 || len(events)%2 != 0 || events[len(events)-1].Value.(InputOutput).Value != long {
+			t.Errorf("%s: the long lines were not parsed: %d events", name, len(events))
+		}
+	}
+
+	defer func(n int) { MaxLineSize = n }(MaxLineSize)
+	MaxLineSize = 1024
+	for name, parse := range parse {
+		if _, err := parse(); err == nil || !strings.Contains(err.Error(), "line 1 is longer than 1024 bytes") {
+			t.Errorf("%s: err = %v, want line 1 too long", name, err)
+		}
+	}
+}
+
+func TestCheckClocks(t *testing.T) {
+	log := `2025-01-01T00:00:01Z Client_1 [Req:1] Setting a = 1
+2025-01-01T00:00:00.5Z Client_1 [Req:1] Set a = 1
+2025-01-01T00:00:02Z Client_2 [Req:1] Setting a = 2
+2025-01-01T00:00:04Z Client_2 [Req:1] Set a = 2
+2025-01-01T00:00:03Z Client_2 [Req:2] Getting a
+2025-01-01T00:00:05Z Client_2 [Req:2] Get a = 2
+2025-01-01T00:00:06Z Client_3 [Req:1] Getting a
+2025-01-01T00:00:07Z Client_3 [Req:2] MultiGetting a,b
+2025-01-01T00:00:08Z Client_3 [Req:2] MultiGet a=2,b=NONE
+`
+	parse := func() []porcupine.Event {
+		events, _, err := ParseLogFormat(strings.NewReader(log), DefaultFormat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return events
+	}
+	// Client 3's unfinished get and the parts of its multi-get overlap
+	// nothing
+	want := []ParseWarning{
+		{WarnNegativeDuration, "client 1: put a returned 500ms before its call; taken as returning at its call"},
+		{WarnClientOverlap, "client 2: get a called 1s before its put a returned; kept"},
+	}
+	events := parse()
+	if got := CheckClocks(events, false); !reflect.DeepEqual(got, want) {
+		t.Errorf("warnings = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(eventStrings(events), eventStrings(parse())) {
+		t.Error("the events were changed without clamp")
+	}
+
+	want[1].Message = "client 2: get a called 1s before its put a returned; moved to that return"
+	if got := CheckClocks(events, true); !reflect.DeepEqual(got, want) {
+		t.Errorf("clamped warnings = %v, want %v", got, want)
+	}
+	for _, ev := range events {
+		if v := ev.Value.(InputOutput); ev.Id == 2 && ev.Kind == porcupine.CallEvent && v.Time.Second() != 4 {
+			t.Errorf("the clamped get is called at %v, want when the put returned", v.Time)
+		}
+	}
+	if got := CheckClocks(events, true); len(got) != 1 {
+		t.Errorf("clamped history still has warnings %v", got)
+	}
+}
+
+func TestSplitUnfinished(t *testing.T) {
+	log := `Client_1 [Req:1] Setting key_1 = a
+Client_2 [Req:1] Getting key_1
+Client_1 [Req:1] Set key_1 = a`
+	events, _, err := ParseLogFormat(strings.NewReader(log), DefaultFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	finished, pending := SplitUnfinished(events)
+	if got, want := eventStrings(finished), []string{"call c1 #0 put key_1 a", "ret c1 #0 put key_1 a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("finished = %v, want %v", got, want)
+	}
+	if got, want := eventStrings(pending), []string{"call c2 #1 get key_1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("pending = %v, want %v", got, want)
+	}
+}
+
+func TestParseInvalidTimestamp(t *testing.T) {
+	log := `2025-01-02T15:04:05.1Z Client_1 [Req:1] Setting key_1 = a
+2025-13-02T15:04:05.2Z Client_1 [Req:1] Set key_1 = a`
+	events, stats, err := ParseLogFormat(strings.NewReader(log), DefaultFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || !events[1].Value.(InputOutput).Time.IsZero() {
+		t.Fatalf("got events %v, want the return untimed", eventStrings(events))
+	}
+	warnings := stats.Warnings()
+	if len(warnings) != 1 || warnings[0].Category != WarnInvalidTimestamp || !strings.Contains(warnings[0].Message, "2025-13-02T15:04:05.2Z") {
+		t.Errorf("warnings = %v, want one invalid timestamp", warnings)
+	}
+}
+
+func TestMergeHistories(t *testing.T) {
+	parse := func(log string) []porcupine.Event {
+		events, _, err := ParseLogFormat(strings.NewReader(log), DefaultFormat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return events
+	}
+	server1 := parse(`2025-01-02T15:04:05.1Z Client_1 [Req:1] Setting key_1 = a
+2025-01-02T15:04:05.2Z Client_1 [Req:1] Set key_1 = a
+2025-01-02T15:04:05.5Z Client_1 [Req:2] Getting key_1
+2025-01-02T15:04:05.6Z Client_1 [Req:2] Get key_1 = b`)
+	server2 := parse(`2025-01-02T15:04:05.3Z Client_1 [Req:1] Setting key_1 = b
+2025-01-02T15:04:05.4Z Client_1 [Req:1] Set key_1 = b`)
+
+	merged, ordered := MergeHistories(server1, server2)
+	if !ordered {
+		t.Error("timestamped histories were not merged in timestamp order")
+	}
+	want := []string{
+		"call c1 #0 put key_1 a",
+		"ret c1 #0 put key_1 a",
+		"call c3 #2 put key_1 b",
+		"ret c3 #2 put key_1 b",
+		"call c1 #1 get key_1",
+		"ret c1 #1 get key_1 b",
+	}
+	if got := eventStrings(merged); !reflect.DeepEqual(got, want) {
+		t.Errorf("got events\n\t%s\nwant\n\t%s", strings.Join(got, "\n\t"), strings.Join(want, "\n\t"))
+	}
+
+	untimed := parse(`Client_1 [Req:1] Getting key_1
+Client_1 [Req:1] Get key_1 = NONE`)
+	merged, ordered = MergeHistories(server1, untimed)
+	if ordered {
+		t.Error("history without timestamps reported as ordered")
+	}
+	if got := eventStrings(merged); got[4] != "call c3 #2 get key_1" {
+		t.Errorf("untimed history not appended with offset ids: %v", got)
+	}
+}
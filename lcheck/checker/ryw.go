@@ -0,0 +1,207 @@
+package checker
+
+import (
+	"fmt"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// ================= Read-your-writes =================
+
+// A history has read-your-writes consistency if every read by a client
+// returns the value of the client's own latest write to the key, or a newer
+// one: the value of a write that did not return before the client's write
+// was called, and was called before the read returned. It says nothing about
+// reads of a key the client has not written, and is much weaker than
+// linearizability, but it takes a single pass over the history rather than a
+// search, so it stays fast on logs whose linearizability check times out.
+
+// rywOp is one operation of a key's history, as the read-your-writes check
+// sees it
+type rywOp struct {
+	id        int // index in historyOps order
+	clientId  int
+	call, ret int64 // positions in the history, or logged times
+	read      bool  // a completed get
+	write     bool  // an operation that set the key's value
+	value     keyValue
+	known     bool // value is known; unset for computed writes that never returned
+	pending   bool // never returned, or its return is synthesized
+	key       string
+}
+
+// staleRead is a read that missed its client's own latest write
+type staleRead struct {
+	read, write int // operation ids in historyOps order
+}
+
+// CheckReadYourWrites checks whether a history has read-your-writes
+// consistency. The result is Ok or Illegal; the check has no search to time
+// out.
+func CheckReadYourWrites(evs []porcupine.Event) porcupine.CheckResult {
+	res, _ := checkReadYourWrites(evs)
+	return res
+}
+
+// checkReadYourWrites is CheckReadYourWrites, also returning the stale
+// reads of an Illegal history.
+func checkReadYourWrites(evs []porcupine.Event) (porcupine.CheckResult, []staleRead) {
+	if stale := staleReads(evs); len(stale) > 0 {
+		return porcupine.Illegal, stale
+	}
+	return porcupine.Ok, nil
+}
+
+// staleReads returns the completed reads of a history that returned neither
+// their client's latest write to the key nor a newer value, in order of
+// their calls.
+func staleReads(evs []porcupine.Event) []staleRead {
+	ops := rywOps(evs)
+	// The writes of each value of each key, and each client's writes of each
+	// key in order of their calls
+	type clientKey struct {
+		clientId int
+		key      string
+	}
+	type keyVal struct {
+		key   string
+		value keyValue
+	}
+	byValue := make(map[keyVal][]*rywOp)
+	unknown := make(map[string][]*rywOp)
+	own := make(map[clientKey][]*rywOp)
+	for i := range ops {
+		op := &ops[i]
+		if !op.write {
+			continue
+		}
+		if op.known {
+			kv := keyVal{op.key, op.value}
+			byValue[kv] = append(byValue[kv], op)
+		} else {
+			unknown[op.key] = append(unknown[op.key], op)
+		}
+		if !op.pending {
+			ck := clientKey{op.clientId, op.key}
+			own[ck] = append(own[ck], op)
+		}
+	}
+
+	// newer reports whether w may have taken effect after last and before
+	// read returned
+	newer := func(w, last, read *rywOp) bool {
+		return w != last && (w.pending || w.ret >= last.call) && w.call < read.ret
+	}
+	var stale []staleRead
+	for i := range ops {
+		read := &ops[i]
+		if !read.read {
+			continue
+		}
+		// The client's latest write that returned before the read was called
+		var last *rywOp
+		writes := own[clientKey{read.clientId, read.key}]
+		for j := len(writes) - 1; j >= 0; j-- {
+			if writes[j].ret < read.call {
+				last = writes[j]
+				break
+			}
+		}
+		if last == nil || read.value == last.value {
+			continue
+		}
+		ok := false
+		for _, w := range byValue[keyVal{read.key, read.value}] {
+			if newer(w, last, read) {
+				ok = true
+				break
+			}
+		}
+		for _, w := range unknown[read.key] {
+			if ok {
+				break
+			}
+			ok = newer(w, last, read)
+		}
+		if !ok {
+			stale = append(stale, staleRead{read: read.id, write: last.id})
+		}
+	}
+	return stale
+}
+
+// rywOps reconstructs the operations of a history in order of their calls,
+// with the key's value each one read or wrote. Operations are placed by
+// their logged times if every event has one, and by their positions in the
+// history otherwise.
+func rywOps(evs []porcupine.Event) []rywOp {
+	timed, isTimed := timedOperations(evs)
+	ids := make(map[int]int)
+	var ops []rywOp
+	var in, out []InputOutput
+	for pos, ev := range evs {
+		id, ok := ids[ev.Id]
+		if !ok {
+			id = len(ops)
+			ids[ev.Id] = id
+			ops = append(ops, rywOp{id: id, clientId: ev.ClientId, call: int64(pos), pending: true})
+			in = append(in, InputOutput{})
+			out = append(out, InputOutput{})
+		}
+		v := ev.Value.(InputOutput)
+		if ev.Kind == porcupine.CallEvent {
+			in[id] = v
+		} else {
+			out[id] = v
+			ops[id].ret = int64(pos)
+			ops[id].pending = v.Pending
+		}
+	}
+	for id := range ops {
+		op := &ops[id]
+		if isTimed {
+			op.call, op.ret = timed[id].Call, timed[id].Return
+		}
+		op.key = in[id].Key
+		observed := out[id].observed()
+		switch in[id].Op {
+		case OpGet:
+			op.read = !op.pending
+			op.value, op.known = observed, true
+		case OpPut:
+			op.write = true
+			op.value, op.known = keyValue{s: in[id].Value}, true
+		case OpDelete:
+			op.write = true
+			op.value, op.known = in[id].deletedValue(), true
+		case OpCAS:
+			// A CAS that reported a value other than its new one failed and
+			// wrote nothing; one that never returned may have written it
+			next := keyValue{s: in[id].Value}
+			op.write = op.pending || observed == next
+			op.value, op.known = next, true
+		default: // increment and append: the return carries the result
+			op.write = true
+			op.value, op.known = observed, !op.pending
+		}
+	}
+	return ops
+}
+
+// rywViolation lists the stale reads of a key's history, with the write of
+// their own client each one missed.
+func rywViolation(evs []porcupine.Event, model porcupine.Model, stale []staleRead) Violation {
+	ops := historyOps(evs, model)
+	v := Violation{total: len(ops), readYourWrites: true}
+	for _, s := range stale {
+		op := ops[s.read]
+		op.note = fmt.Sprintf("after its own %s", ops[s.write].desc)
+		v.culprits = append(v.culprits, op)
+	}
+	for _, op := range rywOps(evs) {
+		if op.read {
+			v.reads++
+		}
+	}
+	return v
+}
@@ -0,0 +1,134 @@
+package checker
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+)
+
+func TestCheckReadYourWrites(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  []porcupine.Operation
+		want porcupine.CheckResult
+	}{
+		{
+			name: "own write read back",
+			ops: []porcupine.Operation{
+				op(1, 0, 1, put("a"), val("a")),
+				op(1, 2, 3, get(), val("a")),
+			},
+			want: porcupine.Ok,
+		},
+		{
+			name: "own write missed",
+			ops: []porcupine.Operation{
+				op(1, 0, 1, put("a"), val("a")),
+				op(1, 2, 3, get(), none()),
+			},
+			want: porcupine.Illegal,
+		},
+		{
+			name: "older write of another client",
+			ops: []porcupine.Operation{
+				op(2, 0, 1, put("b"), val("b")),
+				op(1, 2, 3, put("a"), val("a")),
+				op(1, 4, 5, get(), val("b")),
+			},
+			want: porcupine.Illegal,
+		},
+		{
+			name: "newer write of another client",
+			ops: []porcupine.Operation{
+				op(1, 0, 1, put("a"), val("a")),
+				op(2, 2, 3, put("b"), val("b")),
+				op(1, 4, 5, get(), val("b")),
+			},
+			want: porcupine.Ok,
+		},
+		{
+			name: "concurrent write of another client",
+			ops: []porcupine.Operation{
+				op(2, 0, 3, put("b"), val("b")),
+				op(1, 1, 2, put("a"), val("a")),
+				op(1, 4, 5, get(), val("b")),
+			},
+			want: porcupine.Ok,
+		},
+		{
+			name: "stale read by another client",
+			ops: []porcupine.Operation{
+				op(1, 0, 1, put("a"), val("a")),
+				op(2, 2, 3, get(), none()),
+			},
+			want: porcupine.Ok,
+		},
+		{
+			name: "read during the own write",
+			ops: []porcupine.Operation{
+				op(1, 0, 3, put("a"), val("a")),
+				op(1, 1, 2, get(), none()),
+			},
+			want: porcupine.Ok,
+		},
+		{
+			name: "failed cas writes nothing",
+			ops: []porcupine.Operation{
+				op(1, 0, 1, put("a"), val("a")),
+				op(2, 2, 3, cas("x", "b"), val("a")),
+				op(1, 4, 5, get(), val("b")),
+			},
+			want: porcupine.Illegal,
+		},
+		{
+			name: "counter below the own increment",
+			ops: []porcupine.Operation{
+				op(1, 0, 1, incr(2), val("2")),
+				op(2, 2, 3, incr(1), val("3")),
+				op(1, 4, 5, get(), val("2")),
+				op(1, 6, 7, get(), val("0")),
+			},
+			want: porcupine.Illegal,
+		},
+		{
+			name: "pending write of another client",
+			ops: []porcupine.Operation{
+				op(1, 0, 1, put("a"), val("a")),
+				op(2, 2, 100, appendOp("b"), InputOutput{Key: "k", Pending: true}),
+				op(1, 4, 5, get(), val("ab")),
+			},
+			want: porcupine.Ok,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CheckReadYourWrites(events(tt.ops)); got != tt.want {
+				t.Errorf("CheckReadYourWrites = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadYourWritesViolation(t *testing.T) {
+	evs := events([]porcupine.Operation{
+		op(1, 0, 1, put("a"), val("a")),
+		op(2, 2, 3, get(), none()),
+		op(1, 4, 5, put("b"), val("b")),
+		op(1, 6, 7, get(), val("a")),
+	})
+	res := CheckKeys([]string{"k"}, map[string][]porcupine.Event{"k": evs}, Options{ReadYourWrites: true})
+	if res[0].Result != porcupine.Illegal {
+		t.Fatalf("result = %v, want Illegal", res[0].Result)
+	}
+	want := []string{
+		"stale reads: 1 of 2 reads missed their client's own writes",
+		"  stale read: client 1: get()=a (after its own put(b))",
+	}
+	if got := res[0].Violation().Lines(); !reflect.DeepEqual(got, want) {
+		t.Errorf("violation = %q, want %q", got, want)
+	}
+	if slice := res[0].Counterexample(0); len(slice) != 4 {
+		t.Errorf("counterexample has %d events, want the 4 of the put and the stale read", len(slice))
+	}
+}
@@ -0,0 +1,246 @@
+package checker
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// ================= Sequential consistency =================
+
+// A history is sequentially consistent if its operations can be put in one
+// total order that is legal for the model and keeps each client's operations
+// in the order the client issued them. Unlike linearizability, an operation
+// may be ordered before another one that returned before it was called, as
+// long as the two come from different clients. That cannot be expressed as a
+// porcupine history, whose intervals impose real-time order between all
+// clients, so the orders are searched here directly.
+//
+// The same search, with real-time order between all operations on top of
+// program order, checks linearizability with each client as a single
+// process (see CheckClientOrder). Porcupine only orders operations by real
+// time: the ClientId of its events is only drawn in visualizations. A
+// client that waits for each operation to return before calling the next
+// is ordered by real time anyway, but the operations of a client that
+// pipelines its requests overlap, and porcupine may reorder them.
+
+// seqChecker searches for a sequentially consistent order of a history.
+type seqChecker struct {
+	model   porcupine.Model
+	ops     []opRecord
+	clients [][]int // each client's operation ids, in program order
+	pos     []int   // next operation of each client
+	order   []int   // operations placed so far
+	best    []int   // longest order found that could not be extended
+	// visited holds the (positions, state) pairs already explored, which
+	// lead to a dead end
+	visited  map[string]bool
+	deadline time.Time
+	steps    int
+	timedOut bool
+	// realTime also orders an operation after every operation that
+	// returned before it was called, by their calls and returns
+	realTime  bool
+	call, ret []int64
+	placed    []bool
+}
+
+// CheckSequential checks whether a key's history is sequentially
+// consistent for the model. Each client's operations are in program order by
+// their calls. An operation that never returned (see PendingReturns) may
+// take effect or not. A timeout of 0 means no timeout; when it expires the
+// result is Unknown. For an Illegal or Unknown result, order is the longest
+// prefix of a sequentially consistent order the search found, as ids of the
+// operations in order of their calls.
+func CheckSequential(model porcupine.Model, evs []porcupine.Event, timeout time.Duration) (result porcupine.CheckResult, order []int) {
+	return checkOrder(model, evs, timeout, false)
+}
+
+// CheckClientOrder checks whether a key's history is linearizable for the
+// model with each client's operations also taking effect in the order the
+// client called them, even where they overlap. Operations are placed in
+// real time by their logged times if every event has one, and by their
+// positions in the history otherwise. The timeout and order are those of
+// CheckSequential.
+func CheckClientOrder(model porcupine.Model, evs []porcupine.Event, timeout time.Duration) (result porcupine.CheckResult, order []int) {
+	return checkOrder(model, evs, timeout, true)
+}
+
+// checkOrder is CheckSequential, or CheckClientOrder with realTime set.
+func checkOrder(model porcupine.Model, evs []porcupine.Event, timeout time.Duration, realTime bool) (porcupine.CheckResult, []int) {
+	sc := &seqChecker{
+		model:    model,
+		ops:      historyOps(evs, model),
+		visited:  make(map[string]bool),
+		best:     []int{},
+		realTime: realTime,
+	}
+	if realTime {
+		// rywOps numbers operations the way historyOps does
+		for _, op := range rywOps(evs) {
+			sc.call = append(sc.call, op.call)
+			sc.ret = append(sc.ret, op.ret)
+		}
+		sc.placed = make([]bool, len(sc.ops))
+	}
+	if timeout > 0 {
+		sc.deadline = time.Now().Add(timeout)
+	}
+	// historyOps numbers operations by their calls, which is program order
+	index := make(map[int]int)
+	for id, op := range sc.ops {
+		c, ok := index[op.clientId]
+		if !ok {
+			c = len(sc.clients)
+			index[op.clientId] = c
+			sc.clients = append(sc.clients, nil)
+		}
+		sc.clients[c] = append(sc.clients[c], id)
+	}
+	sc.pos = make([]int, len(sc.clients))
+
+	switch {
+	case sc.search(model.Init()):
+		return porcupine.Ok, nil
+	case sc.timedOut:
+		return porcupine.Unknown, sc.best
+	}
+	return porcupine.Illegal, sc.best
+}
+
+// search extends the current order from state, reporting whether it can be
+// completed.
+func (sc *seqChecker) search(state interface{}) bool {
+	if len(sc.order) == len(sc.ops) {
+		return true
+	}
+	if sc.steps++; sc.steps%1024 == 0 && !sc.deadline.IsZero() && time.Now().After(sc.deadline) {
+		sc.timedOut = true
+	}
+	if sc.timedOut {
+		return false
+	}
+	key := sc.stateKey(state)
+	if sc.visited[key] {
+		return false
+	}
+
+	// Try the clients' next operations earliest call first, so a history
+	// that is also linearizable is ordered without backtracking
+	for _, c := range sc.byNextCall() {
+		id := sc.clients[c][sc.pos[c]]
+		if !sc.ready(id) {
+			continue
+		}
+		op := sc.ops[id]
+		ok, next := sc.model.Step(state, op.input, op.output)
+		if ok && sc.try(c, id, next) {
+			return true
+		}
+		// An operation that never returned may also never have taken
+		// effect
+		if op.output.Pending && sc.try(c, id, state) {
+			return true
+		}
+		if sc.timedOut {
+			return false
+		}
+	}
+	if len(sc.order) > len(sc.best) {
+		sc.best = append(sc.best[:0], sc.order...)
+	}
+	sc.visited[key] = true
+	return false
+}
+
+// try places operation id of client c and searches on from state.
+func (sc *seqChecker) try(c, id int, state interface{}) bool {
+	sc.pos[c]++
+	sc.order = append(sc.order, id)
+	if sc.placed != nil {
+		sc.placed[id] = true
+	}
+	if sc.search(state) {
+		return true
+	}
+	if sc.placed != nil {
+		sc.placed[id] = false
+	}
+	sc.order = sc.order[:len(sc.order)-1]
+	sc.pos[c]--
+	return false
+}
+
+// ready reports whether operation id may be placed next: always without
+// realTime, and otherwise once every operation that returned before it was
+// called has been placed.
+func (sc *seqChecker) ready(id int) bool {
+	if !sc.realTime {
+		return true
+	}
+	for other, placed := range sc.placed {
+		if !placed && other != id && sc.ret[other] < sc.call[id] {
+			return false
+		}
+	}
+	return true
+}
+
+// byNextCall returns the clients with operations left, ordered by the
+// position of their next operation in the history.
+func (sc *seqChecker) byNextCall() []int {
+	var cs []int
+	for c, ids := range sc.clients {
+		if sc.pos[c] < len(ids) {
+			cs = append(cs, c)
+		}
+	}
+	// Operation ids are in call order
+	for i := 1; i < len(cs); i++ {
+		for j := i; j > 0 && sc.clients[cs[j]][sc.pos[cs[j]]] < sc.clients[cs[j-1]][sc.pos[cs[j-1]]]; j-- {
+			cs[j], cs[j-1] = cs[j-1], cs[j]
+		}
+	}
+	return cs
+}
+
+// stateKey identifies the search position: how far each client got and the
+// model state reached.
+func (sc *seqChecker) stateKey(state interface{}) string {
+	buf := make([]byte, 0, 4*len(sc.pos))
+	for _, p := range sc.pos {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(p))
+	}
+	return fmt.Sprintf("%s%v", buf, state)
+}
+
+// sequentialViolation summarizes why no sequentially consistent order of a
+// key's history exists, from the longest order the search found. The
+// culprits are the operations each client could not continue with.
+func sequentialViolation(evs []porcupine.Event, model porcupine.Model, order []int) Violation {
+	ops := historyOps(evs, model)
+	v := Violation{total: len(ops), linearized: len(order), sequential: true}
+
+	from := len(order) - 3
+	if from < 0 {
+		from = 0
+	}
+	placed := make(map[int]bool)
+	for _, id := range order {
+		placed[id] = true
+	}
+	for _, id := range order[from:] {
+		v.lastOk = append(v.lastOk, ops[id])
+	}
+	blocked := make(map[int]bool)
+	for id, op := range ops {
+		if !placed[id] && !blocked[op.clientId] {
+			blocked[op.clientId] = true
+			v.culprits = append(v.culprits, op)
+		}
+	}
+	noteReads(v.culprits, ops, model)
+	return v
+}
@@ -0,0 +1,216 @@
+package checker
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// events converts operations to the call and return events of a history.
+func events(ops []porcupine.Operation) []porcupine.Event {
+	type at struct {
+		t  int64
+		ev porcupine.Event
+	}
+	var all []at
+	for id, op := range ops {
+		all = append(all,
+			at{op.Call, porcupine.Event{ClientId: op.ClientId, Kind: porcupine.CallEvent, Value: op.Input, Id: id}},
+			at{op.Return, porcupine.Event{ClientId: op.ClientId, Kind: porcupine.ReturnEvent, Value: op.Output, Id: id}})
+	}
+	for i := 1; i < len(all); i++ {
+		for j := i; j > 0 && all[j].t < all[j-1].t; j-- {
+			all[j], all[j-1] = all[j-1], all[j]
+		}
+	}
+	evs := make([]porcupine.Event, len(all))
+	for i, a := range all {
+		evs[i] = a.ev
+	}
+	return evs
+}
+
+func TestCheckSequential(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  []porcupine.Operation
+		want porcupine.CheckResult
+	}{
+		{
+			name: "stale read by another client",
+			ops: []porcupine.Operation{
+				op(1, 0, 1, put("a"), val("a")),
+				op(2, 2, 3, get(), none()),
+			},
+			want: porcupine.Ok,
+		},
+		{
+			name: "stale read by the writing client",
+			ops: []porcupine.Operation{
+				op(1, 0, 1, put("a"), val("a")),
+				op(1, 2, 3, get(), none()),
+			},
+			want: porcupine.Illegal,
+		},
+		{
+			name: "writes seen in different orders",
+			ops: []porcupine.Operation{
+				op(1, 0, 1, put("a"), val("a")),
+				op(1, 2, 3, put("b"), val("b")),
+				op(2, 4, 5, get(), val("b")),
+				op(2, 6, 7, get(), val("a")),
+			},
+			want: porcupine.Illegal,
+		},
+		{
+			name: "reader lagging behind a writer",
+			ops: []porcupine.Operation{
+				op(1, 0, 1, put("a"), val("a")),
+				op(1, 2, 3, put("b"), val("b")),
+				op(2, 4, 5, get(), val("a")),
+				op(2, 6, 7, get(), val("b")),
+			},
+			want: porcupine.Ok,
+		},
+		{
+			name: "pending write that never took effect",
+			ops: []porcupine.Operation{
+				op(1, 0, 100, put("a"), InputOutput{Key: "k", Pending: true}),
+				op(2, 1, 2, get(), none()),
+				op(2, 3, 4, get(), none()),
+			},
+			want: porcupine.Ok,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, order := CheckSequential(singleKeyModel, events(tt.ops), 0)
+			if got != tt.want {
+				t.Fatalf("CheckSequential = %v, want %v", got, tt.want)
+			}
+			if got == porcupine.Illegal && order == nil {
+				t.Error("no order reported for an Illegal result")
+			}
+		})
+	}
+}
+
+func TestSequentialViolation(t *testing.T) {
+	evs := events([]porcupine.Operation{
+		op(1, 0, 1, put("a"), val("a")),
+		op(1, 2, 3, put("b"), val("b")),
+		op(2, 4, 5, get(), val("b")),
+		op(2, 6, 7, get(), val("a")),
+	})
+	res := CheckKeys([]string{"k"}, map[string][]porcupine.Event{"k": evs}, Options{Sequential: true})
+	if res[0].Result != porcupine.Illegal {
+		t.Fatalf("result = %v, want Illegal", res[0].Result)
+	}
+	lines := res[0].Violation().Lines()
+	if len(lines) == 0 || !strings.HasPrefix(lines[0], "longest sequentially consistent prefix: 3 of 4") {
+		t.Errorf("violation = %q", lines)
+	}
+	if last := lines[len(lines)-1]; last != "  cannot order: client 2: get()=a (stale read: value was written)" {
+		t.Errorf("culprit = %q", last)
+	}
+}
+
+func TestCheckClientOrder(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  []porcupine.Operation
+		want porcupine.CheckResult
+	}{
+		{
+			name: "pipelined read taking effect before the client's write",
+			ops: []porcupine.Operation{
+				op(1, 0, 10, put("a"), val("a")),
+				op(1, 1, 5, get(), none()),
+			},
+			want: porcupine.Illegal,
+		},
+		{
+			name: "pipelined read after the client's write",
+			ops: []porcupine.Operation{
+				op(1, 0, 10, put("a"), val("a")),
+				op(1, 1, 5, get(), val("a")),
+			},
+			want: porcupine.Ok,
+		},
+		{
+			name: "overlapping read by another client",
+			ops: []porcupine.Operation{
+				op(1, 0, 10, put("a"), val("a")),
+				op(2, 1, 5, get(), none()),
+			},
+			want: porcupine.Ok,
+		},
+		{
+			name: "stale read by another client",
+			ops: []porcupine.Operation{
+				op(1, 0, 1, put("a"), val("a")),
+				op(2, 2, 3, get(), none()),
+			},
+			want: porcupine.Illegal,
+		},
+		{
+			name: "pending write that never took effect",
+			ops: []porcupine.Operation{
+				op(1, 0, 100, put("a"), InputOutput{Key: "k", Pending: true}),
+				op(1, 1, 2, get(), none()),
+			},
+			want: porcupine.Ok,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, order := CheckClientOrder(singleKeyModel, events(tt.ops), 0)
+			if got != tt.want {
+				t.Fatalf("CheckClientOrder = %v, want %v", got, tt.want)
+			}
+			if got == porcupine.Illegal && order == nil {
+				t.Error("no order reported for an Illegal result")
+			}
+		})
+	}
+}
+
+// TestClientOrderAfterSplit checks that splitting a history by key keeps
+// the client of every event, and that only ClientOrder rejects a client's
+// read taking effect before its own overlapping write.
+func TestClientOrderAfterSplit(t *testing.T) {
+	other := func(in InputOutput) InputOutput { in.Key = "j"; return in }
+	evs := events([]porcupine.Operation{
+		op(1, 0, 10, put("a"), val("a")),
+		op(2, 1, 2, other(put("b")), other(val("b"))),
+		op(1, 3, 5, get(), none()),
+		op(2, 6, 7, other(get()), other(val("b"))),
+	})
+	grouped := SplitEventsByKey(evs)
+	for _, ev := range grouped["k"] {
+		if ev.ClientId != 1 {
+			t.Fatalf("event %d of k has client %d, want 1", ev.Id, ev.ClientId)
+		}
+	}
+	for _, ev := range grouped["j"] {
+		if ev.ClientId != 2 {
+			t.Fatalf("event %d of j has client %d, want 2", ev.Id, ev.ClientId)
+		}
+	}
+
+	keys := []string{"j", "k"}
+	for _, r := range CheckKeys(keys, grouped, Options{}) {
+		if r.Result != porcupine.Ok {
+			t.Errorf("key %s = %v without client order, want Ok", r.Key, r.Result)
+		}
+	}
+	res := CheckKeys(keys, grouped, Options{ClientOrder: true})
+	if res[0].Result != porcupine.Ok || res[1].Result != porcupine.Illegal {
+		t.Fatalf("results = %v, %v, want Ok, Illegal", res[0].Result, res[1].Result)
+	}
+	lines := res[1].Violation().Lines()
+	if len(lines) == 0 || lines[0] != "longest linearizable prefix: 1 of 2 operations" {
+		t.Errorf("violation = %q", lines)
+	}
+}
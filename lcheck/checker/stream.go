@@ -0,0 +1,161 @@
+package checker
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// ================= Low-memory (two-pass) parsing =================
+
+// Index records, for each key, the byte offsets of the log lines that
+// belong to it. It lets a key's events be parsed on demand, so only the keys
+// being checked are held in memory. The price is reading the log twice and
+// seeking once per line while loading.
+type Index struct {
+	path    string
+	format  *Format
+	offsets map[string][]int64
+	stats   MatchStats
+}
+
+// Stats returns how many of the log's lines matched each pattern, with the
+// warnings of indexing and of the keys loaded so far.
+func (ix *Index) Stats() MatchStats {
+	return ix.stats
+}
+
+// readLine reads one line, without its "\n" or "\r\n" terminator, and
+// returns the number of bytes consumed.
+func readLine(r *bufio.Reader) (string, int, error) {
+	line, err := r.ReadString('\n')
+	n := len(line)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	line = strings.TrimSuffix(line, "\n")
+	line = strings.TrimSuffix(line, "\r")
+	return line, n, err
+}
+
+// IndexLog makes the first pass over the log at path, recording which lines
+// match a pattern and which key they belong to.
+func IndexLog(path string, format *Format) (*Index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Loading seeks to each line, which a compressed stream can't do
+	var magic [2]byte
+	if n, _ := io.ReadFull(f, magic[:]); n == len(gzipMagic) && magic == [2]byte(gzipMagic) {
+		return nil, errors.New("gzip-compressed logs cannot be read with -low-mem, decompress it first")
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	ix := &Index{path: path, format: format, offsets: make(map[string][]int64)}
+	// Repeated lines are dropped here already, so that loading never sees
+	// them
+	seen := make(lineSet)
+	r := bufio.NewReader(f)
+	var offset int64
+	for {
+		line, n, err := readLine(r)
+		if err == io.EOF {
+			return ix, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		p, m := format.match(line)
+		if format.emptyKey(p, m, line, &ix.stats) {
+			p = nil
+		}
+		if seen.repeat(format, p, m) {
+			ix.stats.addDuplicate()
+			offset += int64(n)
+			continue
+		}
+		ix.stats.add(p)
+		if p != nil {
+			// A multi-get's line belongs to every key it reads
+			for _, key := range format.keys(p, m) {
+				ix.offsets[key] = append(ix.offsets[key], offset)
+			}
+		}
+		offset += int64(n)
+	}
+}
+
+// Keys returns the indexed keys in natural order (see SortKeys).
+func (ix *Index) Keys() []string {
+	keys := make([]string, 0, len(ix.offsets))
+	for k := range ix.offsets {
+		keys = append(keys, k)
+	}
+	SortKeys(keys)
+	return keys
+}
+
+// Lines returns how many of the log's lines belong to key.
+func (ix *Index) Lines(key string) int {
+	return len(ix.offsets[key])
+}
+
+// Load makes the second pass for the given keys, parsing only their lines.
+// Each key is parsed on its own, so calls and returns are paired within it.
+func (ix *Index) Load(keys []string) (map[string][]porcupine.Event, error) {
+	f, err := os.Open(ix.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	type lineRef struct {
+		offset int64
+		key    string
+	}
+	var refs []lineRef
+	parsers := make(map[string]*logParser)
+	for _, key := range keys {
+		parsers[key] = newLogParser(ix.format)
+		parsers[key].only = key
+		for _, off := range ix.offsets[key] {
+			refs = append(refs, lineRef{off, key})
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].offset < refs[j].offset })
+
+	r := bufio.NewReader(f)
+	var pos int64
+	for _, ref := range refs {
+		if ref.offset != pos {
+			if _, err := f.Seek(ref.offset, io.SeekStart); err != nil {
+				return nil, err
+			}
+			r.Reset(f)
+		}
+		line, n, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		pos = ref.offset + int64(n)
+		parsers[ref.key].parseLine(line)
+	}
+
+	grouped := make(map[string][]porcupine.Event, len(keys))
+	for _, key := range keys {
+		lp := parsers[key]
+		grouped[key] = lp.finish()
+		ix.stats.AddWarnings(lp.stats.Warnings())
+	}
+	return grouped, nil
+}
@@ -0,0 +1,115 @@
+package checker
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// ================= Following a growing log =================
+
+// Tail follows a log file that is still being written, parsing only the
+// lines appended since the last Poll. A line is only parsed once it is
+// complete, i.e. ends in a newline. If the file is truncated or replaced, as
+// by log rotation, the history read so far is dropped and the file is read
+// again from the start.
+type Tail struct {
+	path   string
+	format *Format // nil reads JSON lines, as ParseJSONL does
+	lines  int     // lines read, for the JSON-lines warnings
+
+	lp     *logParser
+	offset int64       // bytes of complete lines parsed so far
+	info   os.FileInfo // the file as of the last Poll, to detect rotation
+}
+
+// NewTail returns a Tail of the log at path in the given format, or of JSON
+// lines if format is nil. Nothing is read until the first Poll.
+func NewTail(path string, format *Format) *Tail {
+	return &Tail{path: path, format: format, lp: newLogParser(format)}
+}
+
+// Poll parses the complete lines appended since the last call. It returns
+// how many operations were completed by them, and whether the file was
+// truncated or replaced since the last call, in which case the history was
+// started over.
+func (t *Tail) Poll() (completed int, reset bool, err error) {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return 0, false, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, false, err
+	}
+	if t.info != nil && (!os.SameFile(t.info, info) || info.Size() < t.offset) {
+		reset = true
+		t.lp, t.offset, t.lines = newLogParser(t.format), 0, 0
+	}
+	t.info = info
+
+	if t.offset == 0 {
+		// A compressed stream can't be followed as it grows
+		var magic [2]byte
+		if n, _ := io.ReadFull(f, magic[:]); n == len(gzipMagic) && magic == [2]byte(gzipMagic) {
+			return 0, reset, errors.New("gzip-compressed logs cannot be watched")
+		}
+	}
+	if _, err := f.Seek(t.offset, io.SeekStart); err != nil {
+		return 0, reset, err
+	}
+
+	before := len(t.lp.events)
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			break // an incomplete last line is parsed once it is finished
+		}
+		if err != nil {
+			return t.completed(before), reset, err
+		}
+		t.offset += int64(len(line))
+		t.lines++
+		t.parseLine(strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"))
+	}
+	return t.completed(before), reset, nil
+}
+
+// parseLine parses one complete line in the Tail's format.
+func (t *Tail) parseLine(line string) {
+	if t.format != nil {
+		t.lp.parseLine(line)
+		return
+	}
+	t.lp.parseJSONLine(t.lines, []byte(line))
+}
+
+// completed counts the return events parsed since the first from events
+func (t *Tail) completed(from int) int {
+	n := 0
+	for _, ev := range t.lp.events[from:] {
+		if ev.Kind == porcupine.ReturnEvent {
+			n++
+		}
+	}
+	return n
+}
+
+// Events returns the history parsed so far, in real-time order. Operations
+// still in flight are only present as their calls.
+func (t *Tail) Events() []porcupine.Event {
+	events := append([]porcupine.Event(nil), t.lp.events...)
+	sortByTimestamp(events)
+	return events
+}
+
+// Stats returns how many of the lines parsed so far matched each pattern.
+func (t *Tail) Stats() MatchStats {
+	return t.lp.stats
+}
@@ -0,0 +1,51 @@
+package checker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "live.log")
+	write := func(flag int, s string) {
+		t.Helper()
+		f, err := os.OpenFile(path, flag|os.O_WRONLY|os.O_CREATE, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.WriteString(s); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+	poll := func(tail *Tail, wantCompleted int, wantReset bool, wantEvents int) {
+		t.Helper()
+		completed, reset, err := tail.Poll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if completed != wantCompleted || reset != wantReset || len(tail.Events()) != wantEvents {
+			t.Errorf("Poll = %d completed, reset %v, %d events; want %d, %v, %d",
+				completed, reset, len(tail.Events()), wantCompleted, wantReset, wantEvents)
+		}
+	}
+
+	write(os.O_TRUNC, "Client_1 [Req:1] Setting k = a\n")
+	tail := NewTail(path, DefaultFormat)
+	poll(tail, 0, false, 1)
+
+	// The return is only parsed once its line is complete
+	write(os.O_APPEND, "Client_1 [Req:1] Set k")
+	poll(tail, 0, false, 1)
+	write(os.O_APPEND, " = a\nClient_2 [Req:1] Getting k\n")
+	poll(tail, 1, false, 3)
+	poll(tail, 0, false, 3)
+
+	// A truncated log is read again from the start
+	write(os.O_TRUNC, "Client_3 [Req:1] Getting k\nClient_3 [Req:1] Get k = NONE\n")
+	poll(tail, 1, true, 2)
+	if stats := tail.Stats(); stats.Lines() != 2 {
+		t.Errorf("lines after reset = %d, want 2", stats.Lines())
+	}
+}
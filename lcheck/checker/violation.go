@@ -0,0 +1,211 @@
+package checker
+
+import (
+	"fmt"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// ================= Violation reporting =================
+
+// maxListedOps caps how many operations a violation lists
+const maxListedOps = 10
+
+// opRecord is one call/return pair of a key's history
+type opRecord struct {
+	clientId int
+	input    InputOutput
+	output   InputOutput
+	desc     string // the model's description of the operation
+	note     string // diagnosis of a culprit, see noteReads
+}
+
+func (op opRecord) String() string {
+	if op.note != "" {
+		return fmt.Sprintf("client %d: %s (%s)", op.clientId, op.desc, op.note)
+	}
+	return fmt.Sprintf("client %d: %s", op.clientId, op.desc)
+}
+
+// historyOps reconstructs the operations of a key's history. They are
+// numbered in order of first appearance, the same way porcupine renumbers
+// events, so the ids in a LinearizationInfo index this slice.
+func historyOps(evs []porcupine.Event, model porcupine.Model) []opRecord {
+	ids := make(map[int]int)
+	var ops []opRecord
+	for _, ev := range evs {
+		id, ok := ids[ev.Id]
+		if !ok {
+			id = len(ops)
+			ids[ev.Id] = id
+			ops = append(ops, opRecord{clientId: ev.ClientId})
+		}
+		if ev.Kind == porcupine.CallEvent {
+			ops[id].input = ev.Value.(InputOutput)
+		} else {
+			ops[id].output = ev.Value.(InputOutput)
+		}
+	}
+	for i := range ops {
+		ops[i].desc = model.DescribeOperation(ops[i].input, ops[i].output)
+	}
+	return ops
+}
+
+// Violation summarizes why porcupine could not linearize a key
+type Violation struct {
+	total      int        // operations in the key's history
+	linearized int        // length of the longest partial linearization
+	lastOk     []opRecord // tail of the longest partial linearization
+	culprits   []opRecord // operations porcupine could not linearize
+	// sequential is set for a violation of sequential consistency, whose
+	// prefix and culprits come from CheckSequential
+	sequential bool
+	// readYourWrites is set for a violation of read-your-writes
+	// consistency, whose culprits are the stale reads out of reads
+	readYourWrites bool
+	// eventual is set for a violation of eventual consistency, whose
+	// culprits are the reads of values not written yet out of reads
+	eventual bool
+	reads    int
+}
+
+// FindViolation extracts the operations responsible for an Illegal result.
+// The culprits are the operations that appear in no partial linearization
+// at all; if every operation fits into some partial linearization, they are
+// the operations left out of the longest one.
+func FindViolation(evs []porcupine.Event, info porcupine.LinearizationInfo, model porcupine.Model) Violation {
+	return findViolation(evs, info.PartialLinearizations(), model)
+}
+
+// findViolation is FindViolation, given the partial linearizations of info.
+func findViolation(evs []porcupine.Event, partitions [][][]int, model porcupine.Model) Violation {
+	ops := historyOps(evs, model)
+	v := Violation{total: len(ops)}
+
+	if len(partitions) == 0 {
+		return v
+	}
+	var longest []int
+	inAny := make(map[int]bool)
+	for _, partial := range partitions[0] {
+		if len(partial) > len(longest) {
+			longest = partial
+		}
+		for _, id := range partial {
+			inAny[id] = true
+		}
+	}
+	v.linearized = len(longest)
+
+	from := len(longest) - 3
+	if from < 0 {
+		from = 0
+	}
+	for _, id := range longest[from:] {
+		v.lastOk = append(v.lastOk, ops[id])
+	}
+
+	inLongest := make(map[int]bool)
+	for _, id := range longest {
+		inLongest[id] = true
+	}
+	for id, op := range ops {
+		if !inAny[id] {
+			v.culprits = append(v.culprits, op)
+		}
+	}
+	if len(v.culprits) == 0 {
+		for id, op := range ops {
+			if !inLongest[id] {
+				v.culprits = append(v.culprits, op)
+			}
+		}
+	}
+	noteReads(v.culprits, ops, model)
+	return v
+}
+
+// Notes on a read among the culprits, telling a value that was never
+// written from one that was, but not at the time of the read
+const (
+	notePhantom = "phantom value: never written"
+	noteStale   = "stale read: value was written"
+)
+
+// noteReads notes, for each culprit that is a get, whether any operation of
+// the history wrote the value it returned or it is the key's initial value.
+// Keys that are incremented or appended to compute their values, so their
+// reads are left without a note.
+func noteReads(culprits []opRecord, ops []opRecord, model porcupine.Model) {
+	written := make(map[string]map[keyValue]bool)
+	computed := make(map[string]bool)
+	for _, op := range ops {
+		in := op.input
+		if written[in.Key] == nil {
+			written[in.Key] = make(map[keyValue]bool)
+		}
+		switch in.Op {
+		case OpPut, OpCAS:
+			written[in.Key][keyValue{s: in.Value}] = true
+		case OpDelete:
+			written[in.Key][in.deletedValue()] = true
+		case OpIncrement, OpAppend:
+			computed[in.Key] = true
+		}
+	}
+	for i, op := range culprits {
+		in, out := op.input, op.output
+		if in.Op != OpGet || out.Pending || computed[in.Key] {
+			continue
+		}
+		// A get of the initial value is legal in the initial state
+		initial, _ := model.Step(model.Init(), in, out)
+		if initial || written[in.Key][out.observed()] {
+			culprits[i].note = noteStale
+		} else {
+			culprits[i].note = notePhantom
+		}
+	}
+}
+
+// Lines renders the violation for the text output, one entry per line. The
+// zero Violation, of a key that is not Illegal, has no lines.
+func (v Violation) Lines() []string {
+	if v.total == 0 {
+		return nil
+	}
+	if v.readYourWrites || v.eventual {
+		header := fmt.Sprintf("stale reads: %d of %d reads missed their client's own writes", len(v.culprits), v.reads)
+		label := "stale read"
+		if v.eventual {
+			header = fmt.Sprintf("unwritten reads: %d of %d reads returned a value not written before they returned", len(v.culprits), v.reads)
+			label = "unwritten read"
+		}
+		lines := []string{header}
+		for i, op := range v.culprits {
+			if i == maxListedOps {
+				lines = append(lines, fmt.Sprintf("  ... and %d more", len(v.culprits)-maxListedOps))
+				break
+			}
+			lines = append(lines, "  "+label+": "+op.String())
+		}
+		return lines
+	}
+	prefix, placed, culprit := "linearizable", "linearized", "cannot linearize"
+	if v.sequential {
+		prefix, placed, culprit = "sequentially consistent", "ordered", "cannot order"
+	}
+	lines := []string{fmt.Sprintf("longest %s prefix: %d of %d operations", prefix, v.linearized, v.total)}
+	for _, op := range v.lastOk {
+		lines = append(lines, "  "+placed+": "+op.String())
+	}
+	for i, op := range v.culprits {
+		if i == maxListedOps {
+			lines = append(lines, fmt.Sprintf("  ... and %d more", len(v.culprits)-maxListedOps))
+			break
+		}
+		lines = append(lines, "  "+culprit+": "+op.String())
+	}
+	return lines
+}
@@ -0,0 +1,59 @@
+package checker
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+)
+
+func TestViolationReadNotes(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  []porcupine.Operation
+		init map[string]string
+		want string // note on the culprit, "" for none
+	}{
+		{"phantom", []porcupine.Operation{
+			op(1, 0, 1, put("a"), val("a")),
+			op(2, 2, 3, get(), val("zz")),
+		}, nil, notePhantom},
+		{"stale", []porcupine.Operation{
+			op(1, 0, 1, put("a"), val("a")),
+			op(1, 2, 3, put("b"), val("b")),
+			op(2, 4, 5, get(), val("a")),
+		}, nil, noteStale},
+		{"stale initial value", []porcupine.Operation{
+			op(1, 0, 1, put("a"), val("a")),
+			op(2, 2, 3, get(), none()),
+		}, nil, noteStale},
+		{"stale configured initial value", []porcupine.Operation{
+			op(1, 0, 1, put("a"), val("a")),
+			op(2, 2, 3, get(), val("seed")),
+		}, map[string]string{"k": "seed"}, noteStale},
+		{"counter", []porcupine.Operation{
+			op(1, 0, 1, incr(1), val("1")),
+			op(2, 2, 3, get(), val("7")),
+		}, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			evs := events(tt.ops)
+			res := CheckKeys([]string{"k"}, map[string][]porcupine.Event{"k": evs}, Options{InitValues: tt.init})
+			if res[0].Result != porcupine.Illegal {
+				t.Fatalf("result = %v, want Illegal", res[0].Result)
+			}
+			lines := res[0].Violation().Lines()
+			last := lines[len(lines)-1]
+			if !strings.Contains(last, "cannot linearize: client 2: get()") {
+				t.Fatalf("culprit = %q", last)
+			}
+			if tt.want == "" && strings.HasSuffix(last, ")") {
+				t.Errorf("culprit = %q, want no note", last)
+			}
+			if tt.want != "" && !strings.HasSuffix(last, "("+tt.want+")") {
+				t.Errorf("culprit = %q, want note %q", last, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// ================= Colored output =================
+
+// ANSI colors of the result lines
+const (
+	colorGreen  = "\x1b[32m" // linearizable
+	colorRed    = "\x1b[31m" // not linearizable, or could not be checked
+	colorYellow = "\x1b[33m" // timed out or skipped
+	colorReset  = "\x1b[0m"
+)
+
+// useColor is set when out is a terminal and color was not turned off
+var useColor bool
+
+// isTerminal reports whether w writes to a terminal rather than a file or
+// pipe.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// printColored prints a result line to out, in the given color if useColor
+// is set.
+func printColored(color, format string, args ...interface{}) {
+	line := fmt.Sprintf(format, args...)
+	if useColor {
+		line = color + line + colorReset
+	}
+	fmt.Fprintln(out, line)
+}
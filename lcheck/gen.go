@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// ================= Log generator =================
+
+// genOptions configures a generated log
+type genOptions struct {
+	clients, keys, ops int
+	seed               int64
+	// violation appends operations that no linearization can explain
+	violation bool
+	// timestamps starts each line with an RFC3339 timestamp
+	timestamps bool
+}
+
+// genMain is the gen subcommand: it writes a synthetic log in the default
+// format, for fixtures and to show the format lcheck expects.
+func genMain(args []string) {
+	fs := flag.NewFlagSet("gen", flag.ExitOnError)
+	var o genOptions
+	fs.IntVar(&o.clients, "clients", 3, "number of clients issuing operations concurrently")
+	fs.IntVar(&o.keys, "keys", 2, "number of keys the operations spread over")
+	fs.IntVar(&o.ops, "ops", 20, "number of operations")
+	fs.Int64Var(&o.seed, "seed", 1, "seed of the random choices; the same seed generates the same log")
+	fs.BoolVar(&o.violation, "inject-violation", false, "end the log with a stale read of key_1, which makes it not linearizable")
+	fs.BoolVar(&o.timestamps, "timestamps", false, "start each line with an RFC3339 timestamp, 1ms apart")
+	outPath := fs.String("o", "", "write the log to this file instead of stdout")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: go run . gen [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if o.clients < 1 || o.keys < 1 || o.ops < 0 {
+		fmt.Fprintln(os.Stderr, "-clients and -keys must be at least 1, and -ops not negative")
+		os.Exit(1)
+	}
+
+	var w io.Writer = os.Stdout
+	if *outPath != "" {
+		f, err := os.Create(*outPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		w = f
+	}
+	bw := bufio.NewWriter(w)
+	generateLog(bw, o)
+	if err := bw.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+// genOp is an operation of a generated log, from its call to its return
+type genOp struct {
+	kind     string // put, get, cas or delete
+	key      string
+	value    string // put: written; cas: new value
+	old      string // cas: expected value
+	result   string // get and cas: the value after the operation
+	req      int
+	executed bool
+}
+
+// generateLog writes a history of a key-value store to w. Each client calls
+// one operation at a time, but the clients run concurrently: at every step a
+// random client calls an operation, has its pending one take effect on the
+// store, or logs its return. Every operation thus takes effect between its
+// call and its return, which makes the history linearizable, unless
+// o.violation appends a read of key_1 that misses a write finished before it.
+func generateLog(w io.Writer, o genOptions) {
+	rng := rand.New(rand.NewSource(o.seed))
+	store := make(map[string]string)
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	lines := 0
+	logf := func(client int, format string, args ...interface{}) {
+		if o.timestamps {
+			fmt.Fprintf(w, "%s ", start.Add(time.Duration(lines)*time.Millisecond).Format(time.RFC3339Nano))
+		}
+		fmt.Fprintf(w, "Client_%d %s\n", client, fmt.Sprintf(format, args...))
+		lines++
+	}
+	current := func(key string) string {
+		if v, ok := store[key]; ok {
+			return v
+		}
+		return "NONE"
+	}
+	written := 0
+	newValue := func() string {
+		written++
+		return fmt.Sprintf("v%d", written)
+	}
+
+	call := func(client int, op *genOp) {
+		switch op.kind {
+		case "put":
+			logf(client, "[Req:%d] Setting %s = %s", op.req, op.key, op.value)
+		case "get":
+			logf(client, "[Req:%d] Getting %s", op.req, op.key)
+		case "cas":
+			logf(client, "[Req:%d] CASing %s old=%s new=%s", op.req, op.key, op.old, op.value)
+		case "delete":
+			logf(client, "[Req:%d] Deleting %s", op.req, op.key)
+		}
+	}
+	execute := func(op *genOp) {
+		switch op.kind {
+		case "put":
+			store[op.key] = op.value
+		case "cas":
+			if current(op.key) == op.old {
+				store[op.key] = op.value
+			}
+		case "delete":
+			delete(store, op.key)
+		}
+		op.result = current(op.key)
+		op.executed = true
+	}
+	ret := func(client int, op *genOp) {
+		switch op.kind {
+		case "put":
+			logf(client, "[Req:%d] Set %s = %s", op.req, op.key, op.value)
+		case "get":
+			logf(client, "[Req:%d] Get %s = %s", op.req, op.key, op.result)
+		case "cas":
+			logf(client, "[Req:%d] CAS %s = %s", op.req, op.key, op.result)
+		case "delete":
+			logf(client, "[Req:%d] Deleted %s", op.req, op.key)
+		}
+	}
+
+	pending := make([]*genOp, o.clients+1)
+	reqs := make([]int, o.clients+1)
+	called := 0
+	for {
+		var busy []int
+		for c := 1; c <= o.clients; c++ {
+			if pending[c] != nil {
+				busy = append(busy, c)
+			}
+		}
+		if called == o.ops && len(busy) == 0 {
+			break
+		}
+		client := 1 + rng.Intn(o.clients)
+		if called == o.ops {
+			client = busy[rng.Intn(len(busy))]
+		}
+		op := pending[client]
+		switch {
+		case op == nil:
+			reqs[client]++
+			op = &genOp{key: fmt.Sprintf("key_%d", 1+rng.Intn(o.keys)), req: reqs[client]}
+			switch n := rng.Intn(10); {
+			case n < 4:
+				op.kind = "get"
+			case n < 8:
+				op.kind, op.value = "put", newValue()
+			case n < 9:
+				// Expect the current value half of the time, so that some
+				// swaps succeed
+				op.kind, op.old, op.value = "cas", fmt.Sprintf("v%d", 1+rng.Intn(written+1)), newValue()
+				if rng.Intn(2) == 0 {
+					op.old = current(op.key)
+				}
+			default:
+				op.kind = "delete"
+			}
+			pending[client] = op
+			called++
+			call(client, op)
+		case !op.executed:
+			execute(op)
+		default:
+			pending[client] = nil
+			ret(client, op)
+		}
+	}
+
+	if o.violation {
+		// Two writes of key_1 one after the other, then a read returning
+		// the first: the second finished before the read was called, so
+		// the read cannot be ordered before it
+		first := &genOp{kind: "put", key: "key_1", value: newValue()}
+		second := &genOp{kind: "put", key: "key_1", value: newValue()}
+		read := &genOp{kind: "get", key: "key_1", result: first.value}
+		reader := 1 + 1%o.clients
+		for _, step := range []struct {
+			client int
+			op     *genOp
+		}{{1, first}, {1, second}, {reader, read}} {
+			reqs[step.client]++
+			step.op.req = reqs[step.client]
+			call(step.client, step.op)
+			ret(step.client, step.op)
+		}
+	}
+}
@@ -6,4 +6,4 @@ toolchain go1.23.2
 
 require github.com/anishathalye/porcupine v1.0.3
 
-require github.com/maruel/natural v1.1.1 // indirect
+require github.com/maruel/natural v1.1.1
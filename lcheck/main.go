@@ -2,326 +2,1786 @@ package main
 
 import (
 	"bufio"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
-	"regexp"
-	"sort"
-	"time"
+	"os/signal"
 	"path/filepath"
-	"strings"
+	"runtime"
+	"runtime/debug"
+	"sort"
 	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/anishathalye/porcupine"
-	"github.com/maruel/natural"
+
+	"lcheck/checker"
 )
 
-type crInputOutput struct {
-	op    bool // true = put, false = get
-	key   string
-	value string
-}
-
-// ================= Per-key model =================
-
-var singleKeyModel = porcupine.Model{
-	Init: func() interface{} {
-		// initial value for one key
-		return "NONE"
-	},
-	Step: func(state, input, output interface{}) (bool, interface{}) {
-		in := input.(crInputOutput)
-		curr := state.(string)
-		if in.op { // put
-			return true, in.value
-		} else { // get
-			out := output.(crInputOutput)
-			return out.value == curr, state
-		}
-	},
-	Equal: func(a, b interface{}) bool {
-		return a.(string) == b.(string)
-	},
-	DescribeOperation: func(input, output interface{}) string {
-		in := input.(crInputOutput)
-		out := output.(crInputOutput)
-		if in.op {
-			return fmt.Sprintf("put(%v)", in.value)
-		}
-		return fmt.Sprintf("get()=%v", out.value)
-	},
-}
-
-// ==================================================
-// Revised log parsing (Handles out of order events)
-// ==================================================
-func parseLog(filename string) []porcupine.Event {
-    file, err := os.Open(filename)
-    if err != nil {
-        panic(err)
-    }
-    defer file.Close()
-
-    var events []porcupine.Event
-
-    // 1. UPDATED REGEX: Captures ClientID (group 1) and RequestID (group 2)
-    // Matches: "... Client_1 [Req:55] Setting key_1 = val"
-    reSetterStart := regexp.MustCompile(`Client_?(\d+)\s+\[Req:\s*(\d+)\]\s+Setting\s+(\w+)\s+=\s+(\S*)`)
-    reSetterEnd   := regexp.MustCompile(`Client_?(\d+)\s+\[Req:\s*(\d+)\]\s+Set\s+(\w+)\s+=\s+(\S*)`)
-    reGetterStart := regexp.MustCompile(`Client_?(\d+)\s+\[Req:\s*(\d+)\]\s+Getting\s+(\w+)(\S*)`)
-    reGetterEnd   := regexp.MustCompile(`Client_?(\d+)\s+\[Req:\s*(\d+)\]\s+Get\s+(\w+)\s+=\s+(\S*)`)
-
-    id := 0
-    
-    // 2. NEW MAP: Maps "ClientID:ReqID" -> Porcupine Event ID
-    pendingOps := make(map[string]int)
-
-    scanner := bufio.NewScanner(file)
-    for scanner.Scan() {
-        line := scanner.Text()
-
-        // Helper to create a unique key for the map (e.g., "1:55")
-        makeKey := func(clientId, reqId string) string {
-            return clientId + ":" + reqId
-        }
-
-        switch {
-        // --- WRITER START ---
-        case reSetterStart.MatchString(line):
-            m := reSetterStart.FindStringSubmatch(line)
-            clientId, reqId, key, val := m[1], m[2], m[3], m[4]
-            
-            // Store the porcupine ID in the map
-            pendingOps[makeKey(clientId, reqId)] = id
-            
-            cid, _ := strconv.Atoi(clientId)
-            events = append(events, porcupine.Event{
-                ClientId: cid,
-                Kind:     porcupine.CallEvent,
-                Value:    crInputOutput{true, key, val},
-                Id:       id,
-            })
-            id++
-
-        // --- WRITER END ---
-        case reSetterEnd.MatchString(line):
-            m := reSetterEnd.FindStringSubmatch(line)
-            clientId, reqId, key, val := m[1], m[2], m[3], m[4]
-
-            lookupKey := makeKey(clientId, reqId)
-            callId, ok := pendingOps[lookupKey]
-            
-            if !ok {
-				fmt.Printf("Warning: No matching start event for Client %s Req %s\n", clientId, reqId)
-				continue
-            }
-            delete(pendingOps, lookupKey) // Remove from map to keep it clean
-
-            cid, _ := strconv.Atoi(clientId)
-            events = append(events, porcupine.Event{
-                ClientId: cid,
-                Kind:     porcupine.ReturnEvent,
-                Value:    crInputOutput{true, key, val},
-                Id:       callId, // Links correctly to the specific start event
-            })
-
-        // --- READER START ---
-        case reGetterStart.MatchString(line):
-            m := reGetterStart.FindStringSubmatch(line)
-            clientId, reqId, key := m[1], m[2], m[3]
-
-            pendingOps[makeKey(clientId, reqId)] = id
-
-            cid, _ := strconv.Atoi(clientId)
-            events = append(events, porcupine.Event{
-                ClientId: cid,
-                Kind:     porcupine.CallEvent,
-                Value:    crInputOutput{false, key, ""},
-                Id:       id,
-            })
-            id++
-
-        // --- READER END ---
-        case reGetterEnd.MatchString(line):
-            m := reGetterEnd.FindStringSubmatch(line)
-            clientId, reqId, key, val := m[1], m[2], m[3], m[4]
-
-            lookupKey := makeKey(clientId, reqId)
-            callId, ok := pendingOps[lookupKey]
-            if !ok {
-				fmt.Printf("Warning: No matching start event for Client %s Req %s\n", clientId, reqId)
-				continue
-            }
-            delete(pendingOps, lookupKey)
+// ================= Output =================
 
-            cid, _ := strconv.Atoi(clientId)
-            events = append(events, porcupine.Event{
-                ClientId: cid,
-                Kind:     porcupine.ReturnEvent,
-                Value:    crInputOutput{false, key, val},
-                Id:       callId,
-            })
-        }
-    }
-    return events
-}
+// reportUnfinished prints how many operations never completed, per key and
+// client if perKey is set.
+func reportUnfinished(pending []porcupine.Event, perKey bool) {
+	byKey := make(map[string]map[int]int)
+	for _, ev := range pending {
+		key := ev.Value.(checker.InputOutput).Key
+		if byKey[key] == nil {
+			byKey[key] = make(map[int]int)
+		}
+		byKey[key][ev.ClientId]++
+	}
+	var keys []string
+	for k := range byKey {
+		keys = append(keys, k)
+	}
+	checker.SortKeys(keys)
 
-// ================= Per-key check logic =================
+	if !perKey {
+		fmt.Fprintf(out, "=== %d unfinished operations on %d keys ===\n", len(pending), len(keys))
+		return
+	}
+	fmt.Fprintf(out, "=== %d unfinished operations ===\n", len(pending))
+	for _, key := range keys {
+		var clients []int
+		total := 0
+		for c, n := range byKey[key] {
+			clients = append(clients, c)
+			total += n
+		}
+		sort.Ints(clients)
+		var parts []string
+		for _, c := range clients {
+			parts = append(parts, fmt.Sprintf("client %d: %d", c, byKey[key][c]))
+		}
+		fmt.Fprintf(out, "Key %s: %d unfinished (%s)\n", key, total, strings.Join(parts, ", "))
+	}
+}
 
-func splitEventsByKey(events []porcupine.Event) map[string][]porcupine.Event {
-	grouped := make(map[string][]porcupine.Event)
+// printEvents writes the parsed events as a table, in the order they are
+// fed to porcupine, for debugging log formats with -parse-only.
+func printEvents(w io.Writer, events []porcupine.Event) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tCLIENT\tKIND\tKEY\tOP\tVALUE")
 	for _, e := range events {
-		io := e.Value.(crInputOutput)
-		grouped[io.key] = append(grouped[io.key], e)
+		v := e.Value.(checker.InputOutput)
+		kind, value := "call", v.Value
+		if e.Kind == porcupine.ReturnEvent {
+			kind, value = "return", v.ValueString()
+		} else {
+			switch v.Op {
+			case checker.OpGet, checker.OpDelete:
+				value = ""
+			case checker.OpCAS:
+				old := checker.InputOutput{Value: v.Old, None: v.OldNone}
+				value = fmt.Sprintf("old=%s new=%s", old.ValueString(), v.Value)
+			case checker.OpIncrement:
+				value = fmt.Sprintf("by %d", v.Delta)
+			}
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%s\t%s\t%s\t%s\n", e.Id, e.ClientId, kind, v.Key, v.Op, value)
 	}
-	return grouped
+	tw.Flush()
 }
 
-func checkLinearizability(filename string) bool {
-	fmt.Println("Checking linearizability of log file:", filename)
+// opStats tallies the operations of a history by client, key and operation,
+// for -stats
+type opStats map[int]map[string]map[checker.OpType]int
 
-	events := parseLog(filename)
-	if len(events) == 0 {
-		fmt.Println("No events found in log file!")
-		return false
-	}
-	
-	// 1. Identify which Call IDs actually finished (O(N) pass over the events slice)
-	finishedIds := make(map[int]bool)
+// allOps lists the operations in the order of the -stats columns
+var allOps = []checker.OpType{checker.OpGet, checker.OpPut, checker.OpCAS, checker.OpDelete, checker.OpIncrement, checker.OpAppend}
+
+// add counts the operations called in events, finished or not.
+func (s opStats) add(events []porcupine.Event) {
 	for _, ev := range events {
-		if ev.Kind == porcupine.ReturnEvent {
-			// This ID corresponds to a completed operation
-			finishedIds[ev.Id] = true
+		if ev.Kind != porcupine.CallEvent {
+			continue
+		}
+		v := ev.Value.(checker.InputOutput)
+		if s[ev.ClientId] == nil {
+			s[ev.ClientId] = make(map[string]map[checker.OpType]int)
+		}
+		if s[ev.ClientId][v.Key] == nil {
+			s[ev.ClientId][v.Key] = make(map[checker.OpType]int)
+		}
+		s[ev.ClientId][v.Key][v.Op]++
+	}
+}
+
+// print writes two tables: the operations of each client by operation, with
+// totals, and the same broken down by key. Only operations that occur get a
+// column.
+func (s opStats) print(w io.Writer) {
+	var clients []int
+	total := make(map[checker.OpType]int)
+	for c, byKey := range s {
+		clients = append(clients, c)
+		for _, byOp := range byKey {
+			for op, n := range byOp {
+				total[op] += n
+			}
+		}
+	}
+	sort.Ints(clients)
+	var ops []checker.OpType
+	header := ""
+	for _, op := range allOps {
+		if total[op] > 0 {
+			ops = append(ops, op)
+			header += "\t" + strings.ToUpper(op.String())
+		}
+	}
+	// row formats the counts of one table row, and their sum
+	row := func(counts map[checker.OpType]int) string {
+		var b strings.Builder
+		sum := 0
+		for _, op := range ops {
+			fmt.Fprintf(&b, "\t%d", counts[op])
+			sum += counts[op]
 		}
+		fmt.Fprintf(&b, "\t%d", sum)
+		return b.String()
 	}
 
-	// 2. Filter the events list (O(N) pass over the events slice)
-	var finalEvents []porcupine.Event
+	fmt.Fprintln(w, "=== Operations per client ===")
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "CLIENT%s\tTOTAL\n", header)
+	for _, c := range clients {
+		byClient := make(map[checker.OpType]int)
+		for _, byOp := range s[c] {
+			for op, n := range byOp {
+				byClient[op] += n
+			}
+		}
+		fmt.Fprintf(tw, "%d%s\n", c, row(byClient))
+	}
+	fmt.Fprintf(tw, "TOTAL%s\n", row(total))
+	tw.Flush()
+
+	fmt.Fprintln(w, "=== Operations per client and key ===")
+	tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "CLIENT\tKEY%s\tTOTAL\n", header)
+	for _, c := range clients {
+		var keys []string
+		for k := range s[c] {
+			keys = append(keys, k)
+		}
+		checker.SortKeys(keys)
+		for _, k := range keys {
+			fmt.Fprintf(tw, "%d\t%s%s\n", c, k, row(s[c][k]))
+		}
+	}
+	tw.Flush()
+}
+
+// spanStats is the real-time extent of a history and how concurrent it is,
+// for -stats
+type spanStats struct {
+	first, last time.Time // earliest and latest event timestamps, zero if none
+	// peak is the most operations in flight at once, across all keys, and
+	// keyPeak the most on a single key, peakKey
+	peak    int
+	keyPeak int
+	peakKey string
+	// byKey is set once a history has been added one batch of keys at a
+	// time, which leaves peak unknown
+	byKey bool
+}
+
+// add folds a history, in real-time order, into the stats. An operation is
+// in flight from its call until its return; one that never returned stays in
+// flight until the end. batch marks a history holding only some of the keys
+// (-low-mem), whose concurrency across keys says nothing about the log's.
+func (s *spanStats) add(events []porcupine.Event, batch bool) {
+	s.byKey = s.byKey || batch
+	open := make(map[int]bool)
+	openByKey := make(map[string]int)
 	for _, ev := range events {
-		// Keep all Return events (we already used them to populate finishedIds)
+		v := ev.Value.(checker.InputOutput)
+		if !v.Time.IsZero() {
+			if s.first.IsZero() || v.Time.Before(s.first) {
+				s.first = v.Time
+			}
+			if v.Time.After(s.last) {
+				s.last = v.Time
+			}
+		}
 		if ev.Kind == porcupine.ReturnEvent {
-			finalEvents = append(finalEvents, ev)
+			if open[ev.Id] {
+				delete(open, ev.Id)
+				openByKey[v.Key]--
+			}
+			continue
+		}
+		open[ev.Id] = true
+		openByKey[v.Key]++
+		if len(open) > s.peak {
+			s.peak = len(open)
+		}
+		if n := openByKey[v.Key]; n > s.keyPeak {
+			s.keyPeak, s.peakKey = n, v.Key
+		}
+	}
+}
+
+// print writes the time span and peak concurrency.
+func (s *spanStats) print(w io.Writer) {
+	fmt.Fprintln(w, "=== Time span and concurrency ===")
+	if s.first.IsZero() {
+		fmt.Fprintln(w, "Time span: unknown, the log has no timestamps")
+	} else {
+		fmt.Fprintf(w, "Time span: %s to %s (%v)\n", s.first.Format(time.RFC3339Nano), s.last.Format(time.RFC3339Nano), s.last.Sub(s.first))
+	}
+	if s.byKey {
+		fmt.Fprintln(w, "Peak concurrency: unknown with -low-mem, which reads the log a batch of keys at a time")
+	} else {
+		fmt.Fprintf(w, "Peak concurrency: %d operations in flight\n", s.peak)
+	}
+	if s.keyPeak > 0 {
+		fmt.Fprintf(w, "Peak concurrency on one key: %d operations in flight (%s)\n", s.keyPeak, s.peakKey)
+	}
+}
+
+// printStats writes the -stats tables and time span of a whole history.
+func printStats(w io.Writer, events []porcupine.Event) {
+	counts := make(opStats)
+	counts.add(events)
+	counts.print(w)
+	var span spanStats
+	span.add(events, false)
+	span.print(w)
+}
+
+// ================= Input discovery =================
+
+// logTarget is a log file to check, together with the name of its
+// visualization directory under the output directory.
+type logTarget struct {
+	path    string
+	vizName string
+	// parts, with -merge, are the logs merged into the one history checked
+	// under path
+	parts []string
+}
+
+// vizNameFor derives the visualization directory name from the file name
+// without path and extension.
+func vizNameFor(filename string) string {
+	if filename == "-" {
+		return "stdin"
+	}
+	baseName := strings.TrimSuffix(filepath.Base(filename), ".gz")
+	return strings.TrimSuffix(baseName, filepath.Ext(baseName))
+}
+
+// collectTargets expands the command-line arguments into log files to check.
+// Directories are walked recursively and every file whose name matches glob
+// is included; its visualizations are namespaced by its path relative to the
+// directory so that equally named logs in different runs don't collide. Logs
+// that still share a name, such as run.log under two directory arguments,
+// get a numbered one: run, run-2 and so on, in the order of the arguments.
+func collectTargets(args []string, glob string) ([]logTarget, error) {
+	if _, err := filepath.Match(glob, ""); err != nil {
+		return nil, fmt.Errorf("invalid glob %q: %v", glob, err)
+	}
+
+	var targets []logTarget
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if arg == "-" || err != nil || !info.IsDir() {
+			targets = append(targets, logTarget{path: arg, vizName: vizNameFor(arg)})
 			continue
 		}
 
-		// Must be a CallEvent at this point
-		if finishedIds[ev.Id] {
-			// If the Call has a matching Return, keep it
-			finalEvents = append(finalEvents, ev)
+		err = filepath.WalkDir(arg, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			// Compressed logs match the glob of their uncompressed name
+			ok, _ := filepath.Match(glob, d.Name())
+			if !ok {
+				ok, _ = filepath.Match(glob, strings.TrimSuffix(d.Name(), ".gz"))
+			}
+			if !ok {
+				return nil
+			}
+			rel, err := filepath.Rel(arg, path)
+			if err != nil {
+				return err
+			}
+			rel = strings.TrimSuffix(rel, ".gz")
+			vizName := strings.TrimSuffix(rel, filepath.Ext(rel))
+			targets = append(targets, logTarget{path: path, vizName: vizName})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("scanning %s: %v", arg, err)
+		}
+	}
+	used := make(map[string]bool)
+	for i := range targets {
+		name := targets[i].vizName
+		for n := 2; used[name]; n++ {
+			name = fmt.Sprintf("%s-%d", targets[i].vizName, n)
+		}
+		used[name] = true
+		targets[i].vizName = name
+	}
+	return targets, nil
+}
+
+// readManifest returns the paths a manifest lists, one per line. Blank
+// lines and lines starting with '#' are skipped, and a relative path is
+// taken relative to the manifest's directory. A manifest of "-" is read from
+// standard input, its paths relative to the working directory. Listed paths
+// that don't exist are all reported in the error.
+func readManifest(manifest string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	name, dir := "standard input", "."
+	if manifest != "-" {
+		f, err := os.Open(manifest)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r, name, dir = f, manifest, filepath.Dir(manifest)
+	}
+	var paths, missing []string
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		path := strings.TrimSpace(sc.Text())
+		if path == "" || strings.HasPrefix(path, "#") {
+			continue
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		if _, err := os.Stat(path); err != nil {
+			missing = append(missing, fmt.Sprintf("line %d: %s", line, path))
+			continue
 		}
-		// If finishedIds[ev.Id] is false, the call is dangling, and we skip it.
+		paths = append(paths, path)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %v", name, err)
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%s: %d listed paths are missing:\n  %s", name, len(missing), strings.Join(missing, "\n  "))
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%s lists no paths", name)
 	}
+	return paths, nil
+}
 
-	grouped := splitEventsByKey(finalEvents)
+// ================= Whole-log check =================
 
-	vizDir := "viz_output"
-	// make output dir
-	if err := os.MkdirAll(vizDir, 0755); err != nil {
-		fmt.Printf("Error creating output directory: %v\n", err)
-		os.Exit(1)
+// checkOptions configures how each log is checked: the checker's options
+// plus those of the command line tool
+type checkOptions struct {
+	checker.Options
+	// lowMem parses each batch of keys from the log on demand instead of
+	// holding every event in memory
+	lowMem bool
+	// vizDir is the base directory of the visualizations
+	vizDir string
+	// zipOut, if set, is the zip archive the visualizations end up in;
+	// vizDir is then a temporary directory archived once every log is
+	// checked
+	zipOut string
+	// vizFormat is the format of the per-key visualizations, or vizNone to
+	// skip them
+	vizFormat string
+	// vizGzip gzip-compresses the html visualizations
+	vizGzip bool
+	// counterexamples writes a minimal failing slice of each key that is
+	// not linearizable next to the visualizations
+	counterexamples bool
+	// perKeyDir, if set, is the base directory of a JSON file per key
+	// holding its result
+	perKeyDir string
+	// jsonl reads the log as JSON lines instead of with Options.Format,
+	// which is then nil
+	jsonl bool
+	// stats prints the operations per client of each log
+	stats bool
+	// summaryOnly leaves out the lines of keys that pass, and counts them
+	summaryOnly bool
+	// groupDelim, if set, rolls the key results up by the logical key
+	// before the last groupDelim
+	groupDelim string
+	// timeoutPolicy is how an Unknown result counts towards the verdict
+	timeoutPolicy string
+	// sortBy is the order the keys are reported in, one of the sort
+	// constants
+	sortBy string
+	// verifyCombined checks a log whose keys all pass once more as one
+	// history, to confirm the per-key verdict
+	verifyCombined bool
+	// minOpsUnknown makes a log with keys left out by Options.MinOps
+	// Unknown, instead of deciding it by the other keys
+	minOpsUnknown bool
+	// clientOverlaps is what is done about a client's call timestamped
+	// before its previous operation returned, one of the overlaps
+	// constants
+	clientOverlaps string
+}
+
+// shownPath returns how the output names a file written under vizDir: its
+// path, or its place in the archive with -zip-out.
+func (o checkOptions) shownPath(path string) string {
+	if o.zipOut == "" {
+		return path
 	}
-	// Get file name without path and extension
-	baseName := filepath.Base(filename)
-	ext := filepath.Ext(baseName)
-	nameOnly := strings.TrimSuffix(baseName, ext)
-	outDir := fmt.Sprintf("%s/%s", vizDir, nameOnly)
-	if err := os.MkdirAll(outDir, 0755); err != nil {
-		fmt.Printf("Error creating run-specific output directory: %v\n", err)
-		os.Exit(1)
+	rel, err := filepath.Rel(o.vizDir, path)
+	if err != nil {
+		return path
+	}
+	return o.zipOut + ":" + filepath.ToSlash(rel)
+}
+
+// visualized reports whether the linearizable keys of a check are drawn:
+// porcupine has a linearization to draw only for its own search, not for the
+// orders -model=sequential and -client-order find, nor for the single passes
+// of -model=ryw and -model=eventual.
+func (o checkOptions) visualized() bool {
+	return o.vizFormat != vizNone && !o.Sequential && !o.ClientOrder && !o.ReadYourWrites && !o.Eventual
+}
+
+// Orders of -sort, in which the keys of a log are reported
+const (
+	sortName   = "name"   // natural order of the key names
+	sortEvents = "events" // most events first
+	sortStatus = "status" // not linearizable first, then failed, timed out, skipped and ok
+)
+
+// statusRank orders the key statuses for -sort=status, worst first
+var statusRank = map[string]int{statusIllegal: 0, statusError: 1, statusTimeout: 2, statusSkipped: 3, statusOk: 4}
+
+// sortResults orders key results for reporting by the given sort, keeping
+// the natural name order among equals.
+func sortResults(results []checker.KeyResult, by string) {
+	switch by {
+	case sortEvents:
+		sort.SliceStable(results, func(i, j int) bool { return len(results[i].Events) > len(results[j].Events) })
+	case sortStatus:
+		sort.SliceStable(results, func(i, j int) bool {
+			return statusRank[keyStatus(results[i])] < statusRank[keyStatus(results[j])]
+		})
 	}
+}
 
-	// Collect all keys and sort them for consistent output
-	// (not strictly necessary, but helps with visualization)
-	var keys []string
-	for k := range grouped {
-		keys = append(keys, k)
+// How -timeout-policy counts a log whose check was not decided, as a key
+// timed out or was skipped
+const (
+	policyFail   = "fail"   // not ok, with its own exit code
+	policyPass   = "pass"   // counted as satisfying the property
+	policyIgnore = "ignore" // tallied as timed out, but not failing the run
+)
+
+// What -client-overlaps does about a call timestamped before its client's
+// previous operation returned
+const (
+	overlapsWarn   = "warn"   // warn, keeping the call's time
+	overlapsClamp  = "clamp"  // warn and move the call to that return
+	overlapsIgnore = "ignore" // keep the call's time without a warning
+)
+
+// How -value-type compares the values of keys
+const (
+	valuesString  = "string"  // equal if the same string
+	valuesNumeric = "numeric" // numbers equal if the same number, as 007 and 7
+)
+
+// patternList is a flag that may be repeated, collecting the glob pattern
+// of each use.
+type patternList []string
+
+func (l *patternList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *patternList) Set(p string) error {
+	if _, err := filepath.Match(p, ""); err != nil {
+		return fmt.Errorf("invalid glob pattern %q: %v", p, err)
 	}
-	sort.Sort(natural.StringSlice(keys)) // Use natural sorting for better readability
+	*l = append(*l, p)
+	return nil
+}
 
-	allOk := true
-	for _, key := range keys {
-		evs := grouped[key]
-		fmt.Printf("=== Checking key %s (%d events) ===\n", key, len(evs))
-
-		// Uncomment below for detailed per-key event debug output
-		// // Debug: print events for this key
-		// fmt.Printf("DEBUG: Events for key %s:\n", key)
-		// for i, e := range evs {
-		// 	io := e.Value.(crInputOutput)
-		// 	kind := "Call"
-		// 	if e.Kind == porcupine.ReturnEvent {
-		// 		kind = "Return"
-		// 	}
-		// 	fmt.Printf("  [%d] Id=%d Proc=%d Kind=%s Key=%s Value=%s\n",
-		// 		i, e.Id, e.ClientId, kind, io.key, io.value)
-		// }
-
-		// Check linearizability for this key
-		res, info := porcupine.CheckEventsVerbose(singleKeyModel, evs, 60*time.Second)
-		switch res {
-		case porcupine.Ok:
-			fmt.Printf("Key %s: linearizable\n", key)
-		case porcupine.Illegal:
-			fmt.Printf("Key %s: NOT linearizable\n", key)
-			allOk = false
+// parseLog parses a log in the input format of opts, and adds the warnings
+// of checker.CheckClocks to its stats.
+func parseLog(r io.Reader, opts checkOptions) ([]porcupine.Event, checker.MatchStats, error) {
+	var events []porcupine.Event
+	var stats checker.MatchStats
+	var err error
+	if opts.jsonl {
+		events, stats, err = checker.ParseJSONL(r)
+	} else {
+		events, stats, err = checker.ParseLogFormat(r, opts.Format)
+	}
+	if err != nil {
+		return events, stats, err
+	}
+	for _, w := range checker.CheckClocks(events, opts.clientOverlaps == overlapsClamp) {
+		if w.Category != checker.WarnClientOverlap || opts.clientOverlaps != overlapsIgnore {
+			stats.AddWarnings([]checker.ParseWarning{w})
+		}
+	}
+	return events, stats, nil
+}
+
+// checkLinearizability checks every key in the target log independently, or
+// in the merged history of its parts. A path of "-" reads the log from
+// standard input. Visualizations are written to <opts.vizDir>/<vizName>.
+//
+// The file's verdict is Illegal if any key is not linearizable, otherwise
+// Unknown if any key timed out or was skipped, otherwise Ok.
+func checkLinearizability(target logTarget, opts checkOptions) fileReport {
+	filename, vizName := target.path, target.vizName
+	fmt.Fprintf(out, "Checking %s of log file: %s\n", property, filename)
+	rep := fileReport{File: filename, PerKey: []keyReport{}}
+
+	fail := func(err error) fileReport {
+		fmt.Fprintln(out, err)
+		rep.setError(err)
+		return rep
+	}
+	openErr := func(path string, err error) fileReport {
+		if pe, ok := err.(*os.PathError); ok {
+			err = pe.Err // the path is already part of the message
+		}
+		return fail(fmt.Errorf("cannot open %s: %v", path, err))
+	}
+	noEvents := func() fileReport {
+		fmt.Fprintln(out, "No events found in log file!")
+		// Nothing to check is treated as a failure
+		rep.setVerdict(porcupine.Illegal)
+		return rep
+	}
+	warnUnmatched := func(unmatched []string) {
+		for _, p := range unmatched {
+			fmt.Fprintf(out, "Warning: requested key %s matches no key in the log\n", p)
+		}
+	}
+	// reportSelected counts the keys that -keys, -include-glob and
+	// -exclude-glob selected, if any of them is set
+	reportSelected := func(selected, total, excluded int) {
+		if len(opts.Keys) == 0 && len(opts.ExcludeKeys) == 0 {
+			return
+		}
+		line := fmt.Sprintf("Selected %d of %d keys", selected, total)
+		if excluded > 0 {
+			line += fmt.Sprintf(" (%d excluded)", excluded)
+		}
+		fmt.Fprintln(out, line)
+	}
+	warnNoClient := func(unmatched []int) {
+		for _, c := range unmatched {
+			fmt.Fprintf(out, "Warning: requested client %d has no operation in the log\n", c)
+		}
+	}
+	// reportTrivial summarizes the keys -min-ops left out in one line
+	reportTrivial := func(trivial []string) {
+		rep.TrivialKeys = trivial
+		if len(trivial) == 0 {
+			return
+		}
+		names := trivial
+		if len(names) > 10 {
+			names = append(names[:10:10], "...")
+		}
+		printColored(colorYellow, "Skipped %d keys (trivial, fewer than %d operations): %s", len(trivial), opts.MinOps, strings.Join(names, ", "))
+	}
+
+	// The output directory is only created once there is something to write
+	outDir := filepath.Join(opts.vizDir, vizName)
+	outDirMade := false
+	makeOutDir := func() {
+		if outDirMade {
+			return
+		}
+		// make output dir
+		if err := os.MkdirAll(opts.vizDir, 0755); err != nil {
+			fmt.Fprintf(out, "Error creating output directory: %v\n", err)
+			exit(1)
+		}
+		if err := os.MkdirAll(outDir, 0755); err != nil {
+			fmt.Fprintf(out, "Error creating run-specific output directory: %v\n", err)
+			exit(1)
+		}
+		outDirMade = true
+	}
+
+	keyDir := filepath.Join(opts.perKeyDir, vizName)
+	keyDirMade := false
+
+	var checked []string // keys in the order they were checked
+	// reportKey prints and records one key's result, and visualizes it if it
+	// is linearizable, or writes its counterexample if it is not
+	reportKey := func(r checker.KeyResult) {
+		key, evs := r.Key, r.Events
+		checked = append(checked, key)
+		// With -summary-only, passing keys are only counted
+		quiet := opts.summaryOnly && r.Result == porcupine.Ok
+		if !quiet {
+			fmt.Fprintf(out, "=== Checking key %s (%d events, peak concurrency %d) ===\n", key, len(evs), r.Concurrency())
+		}
+
+		took := r.Elapsed.Round(time.Microsecond).String()
+		if r.Cached {
+			took += ", cached"
+		}
+		switch {
+		case quiet:
+		case r.Skipped:
+			printColored(colorYellow, "Key %s: skipped (too large, over %d events)", key, opts.MaxEvents)
+		case r.Err != nil:
+			printColored(colorRed, "Key %s: %v (%v)", key, r.Err, took)
+		case r.Result == porcupine.Ok:
+			printColored(colorGreen, "Key %s: %s (%v)", key, satisfies, took)
+		case r.Result == porcupine.Illegal:
+			printColored(colorRed, "Key %s: NOT %s (%v)", key, satisfies, took)
 		default:
-			fmt.Printf("Key %s: check timed out (Unknown)\n", key)
-			allOk = false
+			printColored(colorYellow, "Key %s: check timed out (Unknown) (%v)", key, took)
+		}
+		kr := keyReport{Key: key, EventCount: len(evs), Concurrency: r.Concurrency(), Status: keyStatus(r), Cached: r.Cached, elapsed: r.Elapsed}
+		if r.Err != nil {
+			kr.Error = r.Err.Error()
+			if pe, ok := r.Err.(*checker.PanicError); ok {
+				kr.Stack = string(pe.Stack)
+				for _, line := range strings.Split(strings.TrimRight(kr.Stack, "\n"), "\n") {
+					fmt.Fprintf(out, "Key %s:   %s\n", key, line)
+				}
+			}
+		}
+		kr.DurationMs = float64(kr.elapsed) / float64(time.Millisecond)
+		if p, ok := r.Progress(); ok {
+			kr.Progress = &progressReport{LongestPrefix: p.Longest, Operations: p.Operations, Partials: p.Partials}
+			line := fmt.Sprintf("Key %s: longest %s prefix before the timeout: %d of %d operations", key, satisfies, p.Longest, p.Operations)
+			switch {
+			case p.Partials == 1:
+				line += " (1 partial linearization)"
+			case p.Partials > 1:
+				line += fmt.Sprintf(" (%d partial linearizations)", p.Partials)
+			}
+			fmt.Fprintln(out, line)
+		}
+		if r.Result == porcupine.Illegal {
+			kr.Violation = r.Violation().Lines()
+			for _, line := range kr.Violation {
+				fmt.Fprintf(out, "Key %s: %s\n", key, line)
+			}
+		}
+		if r.Result == porcupine.Illegal && opts.counterexamples {
+			makeOutDir()
+			slice := r.Counterexample(opts.Timeout)
+			if fname, err := writeCounterexample(outDir, key, slice); err != nil {
+				fmt.Fprintf(out, "Error writing counterexample for %s: %v\n", key, err)
+			} else {
+				kr.Counterexample = opts.shownPath(fname)
+				fmt.Fprintf(out, "Counterexample for %s written to %s (replay with -input=jsonl)\n", key, kr.Counterexample)
+			}
+			// A picture of just the failing slice, which porcupine can
+			// draw from its partial linearizations
+			if opts.vizFormat == vizHTML && !r.Sequential && !r.ReadYourWrites && !r.Eventual && !r.ClientOrder {
+				s := r.Recheck(slice, opts.Timeout)
+				if reason := noFailureViz(s); reason != "" {
+					fmt.Fprintf(out, "Key %s: NOT %s, but no visualization is available: %s\n", key, satisfies, reason)
+				} else if fname, err := writeFailureViz(outDir, s, opts.vizGzip); err != nil {
+					fmt.Fprintf(out, "Error generating visualization of the counterexample for %s: %v\n", key, err)
+				} else {
+					fmt.Fprintf(out, "Visualization of the counterexample for %s written to %s\n", key, opts.shownPath(fname))
+				}
+			}
+		}
+		rep.PerKey = append(rep.PerKey, kr)
+		if opts.perKeyDir != "" {
+			if !keyDirMade {
+				if err := os.MkdirAll(keyDir, 0755); err != nil {
+					fmt.Fprintf(out, "Error creating per-key output directory: %v\n", err)
+					exit(1)
+				}
+				keyDirMade = true
+			}
+			if _, err := writeKeyFile(keyDir, filename, kr); err != nil {
+				fmt.Fprintf(out, "Error writing the result file of %s: %v\n", key, err)
+			}
 		}
 
 		// Skip visualization if not linearizable
-		if res != porcupine.Ok {
+		if r.Result != porcupine.Ok || !opts.visualized() {
 			// fmt.Printf("Skipping visualization for %s because it is NOT linearizable\n", key)
-			continue
+			return
 		}
 
 		// visualization only for linearizable keys
 		// per-key viz
-		fname := fmt.Sprintf("%s/output_%s.html", outDir, key)
-		f, err := os.Create(fname)
+		if r.Cached {
+			// porcupine's linearization is not cached, so it has to be found
+			// again to be drawn
+			r = r.Recheck(evs, opts.Timeout)
+		}
+		makeOutDir()
+		if fname, err := writeViz(outDir, r, opts.vizFormat, opts.vizGzip); err != nil {
+			fmt.Fprintf(out, "Error generating visualization for %s: %v\n", key, err)
+		} else if !quiet {
+			fmt.Fprintf(out, "Visualization for %s written to %s\n", key, opts.shownPath(fname))
+		}
+	}
+
+	verdict := porcupine.Ok
+	if opts.lowMem {
+		// Check the keys in batches of opts.Jobs, each parsed from the
+		// log on demand
+		if filename == "-" {
+			return fail(fmt.Errorf("-low-mem needs a log file, not standard input"))
+		}
+		if opts.WholeHistory {
+			return fail(fmt.Errorf("-low-mem cannot be combined with -whole-history"))
+		}
+		if opts.jsonl {
+			return fail(fmt.Errorf("-low-mem cannot be combined with -input=jsonl"))
+		}
+		if len(target.parts) > 0 {
+			return fail(fmt.Errorf("-low-mem cannot be combined with -merge"))
+		}
+		start := time.Now()
+		index, err := checker.IndexLog(filename, opts.Format)
+		rep.parseTime += time.Since(start)
 		if err != nil {
-			fmt.Printf("Error creating visualization file for %s: %v\n", key, err)
-			continue
+			return openErr(filename, err)
 		}
-		if err := porcupine.Visualize(singleKeyModel, info, f); err != nil {
-			fmt.Printf("Error generating visualization for %s: %v\n", key, err)
-		} else {
-			fmt.Printf("Visualization for %s written to %s\n", key, fname)
+		stats := index.Stats()
+		stats.Print(out, opts.Format)
+		rep.addMatches(stats)
+
+		keys := index.Keys()
+		if len(keys) == 0 {
+			return noEvents()
+		}
+		total := len(keys)
+		keys, unmatched := checker.SelectKeys(keys, opts.Keys)
+		warnUnmatched(unmatched)
+		keys, excluded := checker.ExcludeKeys(keys, opts.ExcludeKeys)
+		reportSelected(len(keys), total, len(excluded))
+		if opts.sortBy == sortEvents {
+			// Batches are checked in the order of the keys, by their
+			// indexed lines as the events are not parsed yet
+			sort.SliceStable(keys, func(i, j int) bool { return index.Lines(keys[i]) > index.Lines(keys[j]) })
+		}
+
+		var allPending []porcupine.Event
+		var trivial []string
+		counts := make(opStats)
+		var span spanStats
+		progress := opts.Progress
+		// The requested clients with no operation in any key loaded so far
+		noClient := opts.Clients
+		for start := 0; start < len(keys); start += opts.Jobs {
+			if closed(opts.Interrupt) {
+				rep.UncheckedKeys = len(keys) - start
+				break
+			}
+			batch := keys[start:min(start+opts.Jobs, len(keys))]
+			loadStart := time.Now()
+			grouped, err := index.Load(batch)
+			rep.parseTime += time.Since(loadStart)
+			if err != nil {
+				return fail(fmt.Errorf("reading %s: %v", filename, err))
+			}
+			// Keys that only had unfinished operations drop out once loaded,
+			// as they do when the whole log is checked at once
+			var present []string
+			for _, key := range batch {
+				evs, unmatched := checker.SelectClients(grouped[key], opts.Clients)
+				noClient = intersect(noClient, unmatched)
+				rep.TotalEvents += len(evs)
+				counts.add(evs)
+				span.add(evs, true)
+				finished, pending := checker.SplitUnfinished(evs)
+				allPending = append(allPending, pending...)
+				if len(pending) > 0 && opts.IncludePending {
+					finished = append(evs, checker.PendingReturns(pending)...)
+				}
+				if len(finished) > 0 {
+					grouped[key] = finished
+					present = append(present, key)
+				}
+			}
+			present, few := checker.SelectBusyKeys(present, grouped, opts.MinOps)
+			trivial = append(trivial, few...)
+
+			if progress != nil {
+				// Number the keys across batches
+				offset := start
+				opts.Progress = func(i, n int, key string, events int) {
+					progress(offset+i, len(keys), key, events)
+				}
+			}
+			checkStart := time.Now()
+			results := checker.CheckKeys(present, grouped, opts.Options)
+			rep.checkTime += time.Since(checkStart)
+			sortResults(results, opts.sortBy)
+			for _, r := range results {
+				reportKey(r)
+			}
+			if v := checker.Verdict(results); v == porcupine.Illegal || verdict == porcupine.Ok {
+				verdict = v
+			}
+			if (opts.FailFast && verdict != porcupine.Ok) || closed(opts.Interrupt) {
+				rep.UncheckedKeys = len(present) - len(results) + len(keys) - (start + len(batch))
+				break
+			}
+		}
+
+		if rep.UncheckedKeys == 0 {
+			warnNoClient(noClient)
+		}
+		reportTrivial(trivial)
+		// Pairing calls and returns is only done as each key is loaded, so
+		// the warnings are only complete now
+		stats = index.Stats()
+		stats.PrintWarnings(out)
+		rep.ParseWarnings = stats.Warnings()
+		if len(allPending) > 0 {
+			rep.UnfinishedOps = len(allPending)
+			reportUnfinished(allPending, !opts.summaryOnly)
+		}
+		if opts.stats {
+			counts.print(out)
+			span.print(out)
+		}
+	} else {
+		paths := target.parts
+		if len(paths) == 0 {
+			paths = []string{filename}
+		}
+		start := time.Now()
+		histories := make([][]porcupine.Event, len(paths))
+		for i, path := range paths {
+			file, err := checker.OpenLog(path)
+			if err != nil {
+				return openErr(path, err)
+			}
+			events, stats, err := parseLog(file, opts)
+			file.Close()
+			if err != nil {
+				return fail(fmt.Errorf("reading %s: %v", path, err))
+			}
+			if len(target.parts) > 0 {
+				fmt.Fprintf(out, "%s: ", path)
+			}
+			stats.Print(out, opts.Format)
+			stats.PrintWarnings(out)
+			rep.addMatches(stats)
+			histories[i] = events
+		}
+		events := histories[0]
+		if len(histories) > 1 {
+			var ordered bool
+			if events, ordered = checker.MergeHistories(histories...); !ordered {
+				fmt.Fprintln(out, "Warning: not every merged event has a timestamp; the logs are checked as if each ran after the one before it")
+			}
+		}
+		rep.parseTime = time.Since(start)
+		// Drop the other clients here already, so that the stats and event
+		// counts are of the operations checked only
+		events, unmatched := checker.SelectClients(events, opts.Clients)
+		warnNoClient(unmatched)
+		rep.TotalEvents = len(events)
+		if opts.stats {
+			printStats(out, events)
+		}
+
+		checkStart := time.Now()
+		res, err := checker.CheckEvents(events, opts.Options)
+		rep.checkTime = time.Since(checkStart)
+		rep.UnfinishedOps = len(res.Unfinished)
+		if len(res.Unfinished) > 0 {
+			reportUnfinished(res.Unfinished, !opts.summaryOnly)
+		}
+		if errors.Is(err, checker.ErrNoEvents) {
+			return noEvents()
+		}
+		if err != nil {
+			return fail(err)
+		}
+		warnUnmatched(res.UnmatchedKeys)
+		reportSelected(res.Selected, res.Total, len(res.ExcludedKeys))
+		sortResults(res.Keys, opts.sortBy)
+		for _, r := range res.Keys {
+			reportKey(r)
 		}
-		f.Close()
+		reportTrivial(res.TrivialKeys)
+		verdict = res.Status
+		rep.UncheckedKeys = res.Unchecked
+		if opts.verifyCombined && verdict == porcupine.Ok && !closed(opts.Interrupt) {
+			checkStart = time.Now()
+			verdict, rep.Combined, rep.CombinedViolation = checkCombined(events, opts)
+			rep.checkTime += time.Since(checkStart)
+		}
+	}
+	switch {
+	case rep.UncheckedKeys > 0 && closed(opts.Interrupt):
+		rep.Interrupted = true
+		fmt.Fprintf(out, "Interrupted: %d more keys not checked\n", rep.UncheckedKeys)
+		// The keys checked so far can't vouch for the rest
+		if verdict == porcupine.Ok {
+			verdict = porcupine.Unknown
+		}
+	case rep.UncheckedKeys > 0:
+		fmt.Fprintf(out, "Stopped early (-fail-fast): %d more keys not checked\n", rep.UncheckedKeys)
+	}
+	if opts.minOpsUnknown && len(rep.TrivialKeys) > 0 && verdict == porcupine.Ok {
+		verdict = porcupine.Unknown
 	}
 
-	if allOk {
-		fmt.Println("All keys linearizable")
-		// Combined visualization for all keys using manual HTML wrapper (no porcupine method)
-		fmt.Println("Generating combined visualization...")
-		wrapper := fmt.Sprintf("%s/output_all.html", outDir)
-		fw, err := os.Create(wrapper)
+	if opts.groupDelim != "" {
+		rep.Groups = groupKeys(rep.PerKey, opts.groupDelim)
+		printGroups(rep.Groups)
+	}
+	if opts.summaryOnly {
+		counts := make(map[string]int)
+		for _, k := range rep.PerKey {
+			counts[k.Status]++
+		}
+		line := fmt.Sprintf("Keys: %d %s, %d not %s, %d timed out, %d skipped",
+			counts[statusOk], satisfies, counts[statusIllegal], satisfies, counts[statusTimeout], counts[statusSkipped])
+		if counts[statusError] > 0 {
+			line += fmt.Sprintf(", %d failed", counts[statusError])
+		}
+		fmt.Fprintln(out, line)
+	}
+	if verdict == porcupine.Ok {
+		fmt.Fprintln(out, "All keys", satisfies)
+	}
+	if verdict == porcupine.Ok && opts.vizFormat == vizHTML && opts.visualized() {
+		fmt.Fprintln(out, "Generating combined visualization...")
+		wrapper, err := writeCombinedViz(outDir, checked, opts.vizGzip)
 		if err != nil {
-			fmt.Printf("Error creating wrapper HTML: %v\n", err)
+			fmt.Fprintf(out, "Error writing combined visualization: %v\n", err)
 		} else {
-			fmt.Fprintln(fw, "<!DOCTYPE html>")
-			fmt.Fprintln(fw, "<html><head><title>Combined Visualization</title>")
-			fmt.Fprintln(fw, "<style>iframe{width:100%;height:600px;border:1px solid #ccc;margin:10px 0;}</style>")
-			fmt.Fprintln(fw, "</head><body>")
-			fmt.Fprintln(fw, "<h1>Combined Visualization (per-key)</h1>")
-			for _, key := range keys {
-				fmt.Fprintf(fw, "<h2>Key %s</h2>\n", key)
-				fmt.Fprintf(fw, "<iframe src=\"output_%s.html\"></iframe>\n", key)
+			fmt.Fprintf(out, "Combined visualization written to %s\n", opts.shownPath(wrapper))
+		}
+	}
+	rep.setVerdict(verdict)
+	return rep
+}
+
+// checkCombined checks the history of a log whose keys all passed on their
+// own as one history, against the model of the whole store, and reports
+// whether that agrees. It returns the log's verdict, Illegal if the whole
+// history is not, the report status of the combined check and, if it failed,
+// its violation. A combined check that is not decided leaves the per-key
+// verdict standing.
+func checkCombined(events []porcupine.Event, opts checkOptions) (porcupine.CheckResult, string, []string) {
+	combined := opts.Options
+	combined.WholeHistory = true
+	fmt.Fprintln(out, "Verifying the per-key verdict against the whole history...")
+	res, err := checker.CheckEvents(events, combined)
+	if err != nil {
+		fmt.Fprintln(out, "Combined check:", err)
+		return porcupine.Ok, statusError, nil
+	}
+	if len(res.Keys) == 0 {
+		fmt.Fprintln(out, "Combined check: interrupted")
+		return porcupine.Ok, "", nil
+	}
+	r := res.Keys[0]
+	took := r.Elapsed.Round(time.Microsecond)
+	switch {
+	case r.Err != nil:
+		printColored(colorYellow, "Combined check: %v; the per-key verdict stands (%v)", r.Err, took)
+	case r.Result == porcupine.Ok:
+		printColored(colorGreen, "Combined check: the whole history is %s too (%v)", satisfies, took)
+	case r.Result == porcupine.Illegal:
+		printColored(colorRed, "Combined check: the whole history is NOT %s, although every key is (%v)", satisfies, took)
+		lines := r.Violation().Lines()
+		for _, line := range lines {
+			fmt.Fprintf(out, "Combined check: %s\n", line)
+		}
+		return porcupine.Illegal, statusIllegal, lines
+	default:
+		printColored(colorYellow, "Combined check: timed out (Unknown); the per-key verdict stands (%v)", took)
+	}
+	return porcupine.Ok, keyStatus(r), nil
+}
+
+// intersect returns the ids of a that are also in b, in the order of a.
+func intersect(a, b []int) []int {
+	var both []int
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				both = append(both, x)
+				break
 			}
-			fmt.Fprintln(fw, "</body></html>")
-			fw.Close()
-			fmt.Printf("Wrapper visualization written to %s\n", wrapper)
 		}
 	}
-	return allOk
+	return both
+}
+
+// noFailureViz returns why porcupine cannot draw the recheck of a
+// counterexample, or "" if it can.
+func noFailureViz(s checker.KeyResult) string {
+	switch {
+	case s.Result == porcupine.Unknown:
+		return "rechecking the counterexample timed out"
+	case s.Result != porcupine.Illegal:
+		return "the counterexample passed when rechecked"
+	case !s.Visualizable():
+		return "porcupine returned no linearization info"
+	}
+	return ""
+}
+
+// printGroups prints a table of the key results per logical key.
+func printGroups(groups []groupReport) {
+	fmt.Fprintln(out, "=== Results per key group ===")
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "GROUP\tKEYS\tOK\tILLEGAL\tTIMEOUT\tSKIPPED\tERRORS\tSTATUS")
+	for _, g := range groups {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%s\n", g.Group, g.Keys, g.Ok, g.Illegal, g.Timeout, g.Skipped, g.Errors, g.Status)
+	}
+	tw.Flush()
+}
+
+// printProgress reports that the check of a key has started, so a slow key
+// shows which one it is instead of looking like a hang.
+func printProgress(i, n int, key string, events int) {
+	fmt.Fprintf(out, "[%d/%d] checking %s with %d events...\n", i+1, n, key, events)
+}
+
+// printTimings lists every checked key across all files, slowest first, to
+// show which keys dominate the runtime.
+func printTimings(results []fileReport) {
+	type timing struct {
+		file string
+		kr   keyReport
+	}
+	var all []timing
+	for _, r := range results {
+		for _, kr := range r.PerKey {
+			all = append(all, timing{r.File, kr})
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].kr.elapsed > all[j].kr.elapsed })
+
+	fmt.Fprintln(out, "=== Timings (slowest first) ===")
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	for _, t := range all {
+		fmt.Fprintf(tw, "%v\t%s\t%s\t%d events\tpeak concurrency %d\t%s\n", t.kr.elapsed.Round(time.Microsecond), t.file, t.kr.Key, t.kr.EventCount, t.kr.Concurrency, t.kr.Status)
+	}
+	tw.Flush()
+}
+
+// version identifies the build in -version and the JSON report. Release
+// builds set it with -ldflags "-X main.version=v1.2.0".
+var version = "dev"
+
+// revision returns the commit the binary was built from, as the Go
+// toolchain records it when building in a git checkout, with "+modified"
+// appended if the checkout had uncommitted changes; "" if unknown.
+func revision() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	var rev, modified string
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			rev = s.Value
+		case "vcs.modified":
+			modified = s.Value
+		}
+	}
+	if rev != "" && modified == "true" {
+		rev += "+modified"
+	}
+	return rev
+}
+
+// versionString describes the build for -version.
+func versionString() string {
+	v := "lcheck " + version
+	if rev := revision(); rev != "" {
+		v += " (" + rev + ")"
+	}
+	return v + " " + runtime.Version()
+}
+
+// Process exit codes
+const (
+	exitOk              = 0   // every log is linearizable
+	exitNotLinearizable = 1   // some log is not linearizable, or could not be checked
+	exitTimeout         = 2   // no violation found, but some key's check timed out or was skipped
+	exitInterrupted     = 130 // no violation found before the run was interrupted
+)
+
+// handleInterrupt returns a channel that is closed on the first SIGINT, so
+// that the run stops checking and reports the keys checked so far. A second
+// SIGINT ends the process at once, as it would have without the handler.
+func handleInterrupt() <-chan struct{} {
+	interrupt := make(chan struct{})
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	go func() {
+		<-sigs
+		signal.Stop(sigs)
+		fmt.Fprintln(out, "Interrupted: reporting the keys checked so far (interrupt again to quit at once)")
+		close(interrupt)
+	}()
+	return interrupt
+}
+
+// closed reports whether ch is closed; a nil channel never is.
+func closed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
 }
 
 func main() {
-	if len(os.Args) != 2 {
-		fmt.Println("Usage: go run main.go <log-file-path>")
+	if len(os.Args) > 1 && os.Args[1] == "gen" {
+		genMain(os.Args[2:])
+		return
+	}
+	format := flag.String("format", "text", "output format: text, json or junit")
+	showVersion := flag.Bool("version", false, "print the version of lcheck and exit")
+	reportOut := flag.String("report-out", "", "write the json or junit report to this file instead of stdout")
+	glob := flag.String("glob", "*.log", "file name pattern to check when a directory is given")
+	filesFrom := flag.String("files-from", "", "file listing the logs or directories to check, one per line, in addition to the arguments ('#' starts a comment; - reads standard input)")
+	timeout := flag.Duration("timeout", 60*time.Second, "per-key linearizability check timeout (0 = no timeout); the ceiling when -timeout-per-event is set")
+	timeoutPerEvent := flag.Duration("timeout-per-event", 0, "scale each key's timeout by its event count (0 = same timeout for every key)")
+	formatConfig := flag.String("format-config", "", "JSON file with custom log line regexes (default: EPaxos client format)")
+	valuesToEOL := flag.Bool("values-to-eol", false, "take an unquoted value that ends its line up to the end of the line, so it may contain spaces (default format only)")
+	wholeHistory := flag.Bool("whole-history", false, "check all keys as one history, for multi-key invariants (much slower)")
+	verifyCombined := flag.Bool("verify-combined", false, "after every key of a log passes, check its whole history once more as one history and report if that disagrees")
+	lowMem := flag.Bool("low-mem", false, "index the log and parse only the keys being checked (slower, bounded memory)")
+	includePending := flag.Bool("include-pending", false, "check unfinished operations as ongoing instead of discarding them")
+	initList := flag.String("init", "", "comma-separated key=value initial values for pre-seeded keys")
+	initFile := flag.String("init-file", "", "file of key=value initial values, one per line")
+	keyModel := flag.String("key-model", checker.DefaultModel, "model the operations are checked against: kv (a key-value store, counters for incremented keys) or one added with checker.RegisterModel")
+	tombstone := flag.String("tombstone", "", "value reads of a deleted key return; a deleted key then reads only this, and a never-written one only NONE (default: deleted keys read NONE)")
+	valueType := flag.String("value-type", valuesString, "how values are compared: string (exactly) or numeric (numbers by value, so 007, \" 7\" and 7.0 equal 7; other values as strings)")
+	var includeGlobs, excludeGlobs, numericGlobs patternList
+	flag.Var(&numericGlobs, "numeric-key", "compare the values of the keys matching this glob pattern as numbers, like -value-type=numeric for those keys only; may be repeated")
+	flag.Var(&includeGlobs, "include-glob", "check the keys matching this glob pattern, like -keys; may be repeated")
+	flag.Var(&excludeGlobs, "exclude-glob", "leave out the keys matching this glob pattern, even if -keys or -include-glob matches them; may be repeated")
+	keyList := flag.String("keys", "", "comma-separated keys or glob patterns to check (default: all keys)")
+	clientList := flag.String("clients", "", "comma-separated client ids whose operations are checked; the other clients' operations are dropped (default: all clients)")
+	maxEvents := flag.Int("max-events-per-key", 0, "skip keys with more events than this instead of checking them (0 = no limit)")
+	minOps := flag.Int("min-ops", 0, "skip keys with fewer operations than this as trivial, listing them in one line; they don't affect the verdict (0 = check every key)")
+	minOpsUnknown := flag.Bool("min-ops-unknown", false, "count a log with keys skipped by -min-ops as Unknown, like keys skipped as too large")
+	jobs := flag.Int("jobs", runtime.NumCPU(), "number of keys to check concurrently")
+	vizDir := flag.String("out-dir", "viz_output", "base directory of the visualizations")
+	zipOut := flag.String("zip-out", "", "write the visualizations and counterexamples into this zip archive instead of -out-dir")
+	perKeyOut := flag.String("per-key-out", "", "write each key's result as JSON to <dir>/<log>/<key>.json, for tooling")
+	noViz := flag.Bool("no-viz", false, "skip writing visualizations and counterexamples, only report verdicts")
+	vizFormat := flag.String("viz-format", vizHTML, "visualization of each linearizable key: html (interactive page), svg (static timeline), json (linearization data), mermaid or dot (text diagrams of the linearization order) or none")
+	vizGzip := flag.Bool("viz-gzip", false, "gzip-compress the html visualizations (.html.gz)")
+	noCounterexample := flag.Bool("no-counterexample", false, "skip writing the minimal failing slice of each non-linearizable key (failure_<key>.jsonl)")
+	timings := flag.Bool("timings", false, "list the per-key check times, slowest first, after the summary")
+	parseOnly := flag.Bool("parse-only", false, "print the parsed events of each log and exit without checking")
+	minTimeout := flag.Duration("min-timeout", time.Second, "lower bound of the scaled per-key timeout")
+	merge := flag.Bool("merge", false, "merge all logs into one history, e.g. one log per server, and check it as a whole")
+	model := flag.String("model", "linearizable", "consistency to check for: linearizable, sequential (each client's operations in program order, no real-time order across clients), ryw (read-your-writes: each client reads its own latest write or a newer value) or eventual (every read returns a value written before it returned, however stale)")
+	clientOrder := flag.Bool("client-order", false, "also keep each client's operations in the order it called them, for clients that pipeline requests (porcupine orders operations by real time only)")
+	keyFromClient := flag.Bool("key-from-client", false, "use the client id as the key of lines that capture none, for per-client registers")
+	dedup := flag.Bool("dedup", false, "drop log lines repeating an earlier line of the same request (same client, request id, kind, key and values), as duplicated by log collection")
+	maxLineSize := flag.Int("max-line-size", checker.MaxLineSize, "longest log line to read, in bytes; a log with a longer line cannot be checked")
+	input := flag.String("input", "log", "log input format: log (regex-parsed lines), jsonl (one JSON event per line) or etcd (logfmt lines of etcd client operations)")
+	clientOverlaps := flag.String("client-overlaps", overlapsWarn, "what to do about a call timestamped before its client's previous operation returned, as by a bad clock: warn, clamp (warn and move the call to that return, for clients that never pipeline) or ignore")
+	timeoutPolicy := flag.String("timeout-policy", policyFail, "how a log with timed-out or skipped keys (Unknown) counts: fail (exit code 2), pass (counted as passing, exit code 0) or ignore (reported as timed out, exit code 0)")
+	sortBy := flag.String("sort", sortName, "order of the per-key results: name (natural order), events (most events first) or status (failures first)")
+	failFast := flag.Bool("fail-fast", false, "stop at the first key that is not linearizable or times out, skipping the remaining keys and files")
+	groupByPrefix := flag.String("group-by-prefix", "", "delimiter that splits a logical key from its shard, e.g. '#' for user#0..user#15; results are also summed up per logical key")
+	listFailures := flag.Bool("list-failures", false, "print only the keys that are not linearizable, one per line, and nothing else; the exit code is unchanged")
+	timeoutsOut := flag.String("timeouts-out", "", "with -list-failures, also write the keys that timed out or were skipped to this file, one per line")
+	summaryOnly := flag.Bool("summary-only", false, "leave out the lines of passing keys; list only failing, timed-out and skipped keys and the key counts")
+	stats := flag.Bool("stats", false, "print the operations each client issued, by operation and key")
+	noColor := flag.Bool("no-color", false, "never color the result lines (default: color them on a terminal)")
+	watch := flag.Bool("watch", false, "follow a single log file as it grows and re-check it as operations complete, until interrupted")
+	watchInterval := flag.Duration("watch-interval", time.Second, "how often -watch looks for new lines")
+	verbose := flag.Bool("verbose", false, "print progress as the check of each key starts")
+	cpuProfile := flag.String("cpuprofile", "", "write a CPU profile of the run to this file, for go tool pprof")
+	noCache := flag.Bool("no-cache", false, "check every key again instead of restoring unchanged keys' results from the cache, and cache the new results")
+	cacheDir := flag.String("cache-dir", defaultCacheDir(), "directory of the cached key results (empty = no cache)")
+	memProfile := flag.String("memprofile", "", "write a memory profile to this file at the end of the run")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: go run . [flags] <log-file-path | log-dir | -> ...")
+		fmt.Fprintln(flag.CommandLine.Output(), "       go run . gen [flags]  (generate a log; see go run . gen -h)")
+		flag.PrintDefaults()
+		fmt.Fprintln(flag.CommandLine.Output(), `
+Exit codes:
+  0    all logs linearizable
+  1    a log is not linearizable, or could not be checked
+  2    no violation found, but a per-key check timed out or was skipped (Unknown)
+  130  no violation found before the run was interrupted`)
+	}
+	flag.Parse()
+
+	if *showVersion {
+		fmt.Println(versionString())
+		return
+	}
+	if flag.NArg() < 1 && *filesFrom == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	switch *format {
+	case "text":
+	case "json", "junit":
+		if *reportOut == "" {
+			out = os.Stderr
+		}
+	default:
+		fmt.Fprintf(out, "Unknown format %q (want text, json or junit)\n", *format)
+		os.Exit(1)
+	}
+	if *listFailures {
+		var conflict string
+		switch {
+		case *format != "text":
+			conflict = "-list-failures cannot be combined with -format=" + *format
+		case *parseOnly:
+			conflict = "-list-failures cannot be combined with -parse-only"
+		case *watch:
+			conflict = "-list-failures cannot be combined with -watch"
+		}
+		if conflict != "" {
+			fmt.Fprintln(out, conflict)
+			os.Exit(1)
+		}
+	} else if *timeoutsOut != "" {
+		fmt.Fprintln(out, "-timeouts-out needs -list-failures")
+		os.Exit(1)
+	}
+	checker.Warnings = out
+	// NO_COLOR is the common convention for turning color off (no-color.org)
+	useColor = !*noColor && os.Getenv("NO_COLOR") == "" && isTerminal(out)
+
+	if *timeout < 0 || *timeoutPerEvent < 0 || *minTimeout < 0 {
+		fmt.Fprintln(out, "Timeouts must not be negative")
+		os.Exit(1)
+	}
+	if *maxEvents < 0 {
+		fmt.Fprintln(out, "-max-events-per-key must not be negative")
+		os.Exit(1)
+	}
+	if *minOps < 0 {
+		fmt.Fprintln(out, "-min-ops must not be negative")
+		os.Exit(1)
+	}
+	if *tombstone == checker.NoneValue {
+		fmt.Fprintln(out, "-tombstone must not be NONE, which is read from unwritten keys")
+		os.Exit(1)
+	}
+	if *jobs < 1 {
+		fmt.Fprintln(out, "-jobs must be at least 1")
+		os.Exit(1)
+	}
+	if *maxLineSize < 1 {
+		fmt.Fprintln(out, "-max-line-size must be at least 1")
+		os.Exit(1)
+	}
+	checker.MaxLineSize = *maxLineSize
+	var keyPatterns []string
+	for _, p := range strings.Split(*keyList, ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		if _, err := filepath.Match(p, ""); err != nil {
+			fmt.Fprintf(out, "Invalid key pattern %q: %v\n", p, err)
+			os.Exit(1)
+		}
+		keyPatterns = append(keyPatterns, p)
+	}
+	keyPatterns = append(keyPatterns, includeGlobs...)
+	var clients []int
+	for _, c := range strings.Split(*clientList, ",") {
+		if c = strings.TrimSpace(c); c == "" {
+			continue
+		}
+		id, err := strconv.Atoi(c)
+		if err != nil || id < 0 {
+			fmt.Fprintf(out, "Invalid client id %q\n", c)
+			os.Exit(1)
+		}
+		clients = append(clients, id)
+	}
+	switch *model {
+	case "linearizable":
+	case "sequential":
+		property, satisfies = "sequential consistency", "sequentially consistent"
+	case "ryw":
+		property, satisfies = "read-your-writes consistency", "read-your-writes consistent"
+	case "eventual":
+		property, satisfies = "eventual consistency", "eventually consistent"
+	default:
+		fmt.Fprintf(out, "Unknown model %q (want linearizable, sequential, ryw or eventual)\n", *model)
+		os.Exit(1)
+	}
+	if *clientOrder && *model != "linearizable" {
+		fmt.Fprintln(out, "-client-order only applies to -model=linearizable")
+		os.Exit(1)
+	}
+	switch *input {
+	case "log", "jsonl", "etcd":
+	default:
+		fmt.Fprintf(out, "Unknown input format %q (want log, jsonl or etcd)\n", *input)
+		os.Exit(1)
+	}
+	if *input != "log" && *formatConfig != "" {
+		fmt.Fprintln(out, "-format-config only applies to -input=log")
+		os.Exit(1)
+	}
+	if *valuesToEOL && (*input != "log" || *formatConfig != "") {
+		fmt.Fprintln(out, "-values-to-eol only applies to the default log format")
 		os.Exit(1)
 	}
+	logFmt := checker.DefaultFormat
+	switch {
+	case *input == "jsonl":
+		logFmt = nil
+	case *input == "etcd":
+		logFmt = checker.EtcdFormat
+	case *valuesToEOL:
+		logFmt = checker.RestOfLineFormat
+	}
+	if *formatConfig != "" {
+		var err error
+		if logFmt, err = checker.LoadFormat(*formatConfig); err != nil {
+			fmt.Fprintln(out, "Invalid format config:", err)
+			os.Exit(1)
+		}
+	}
+	switch {
+	case *keyFromClient && logFmt == nil:
+		fmt.Fprintln(out, "-key-from-client does not apply to -input=jsonl")
+		os.Exit(1)
+	case *keyFromClient:
+		logFmt = logFmt.KeyFromClient()
+	case logFmt != nil && logFmt.Keyless():
+		fmt.Fprintln(out, "Invalid format config: a pattern has no key group; use -key-from-client to key its lines by client")
+		os.Exit(1)
+	}
+	switch {
+	case *dedup && logFmt == nil:
+		fmt.Fprintln(out, "-dedup does not apply to -input=jsonl")
+		os.Exit(1)
+	case *dedup:
+		logFmt = logFmt.Dedup()
+	}
+	initValues := make(map[string]string)
+	if *initFile != "" {
+		data, err := os.ReadFile(*initFile)
+		if err == nil {
+			err = checker.ParseInitValues(string(data), initValues)
+		}
+		if err != nil {
+			fmt.Fprintln(out, "Invalid -init-file:", err)
+			os.Exit(1)
+		}
+	}
+	if err := checker.ParseInitValues(*initList, initValues); err != nil {
+		fmt.Fprintln(out, "Invalid -init:", err)
+		os.Exit(1)
+	}
+	known := false
+	for _, m := range checker.Models() {
+		known = known || m == *keyModel
+	}
+	if !known {
+		fmt.Fprintf(out, "Unknown key model %q (want %s)\n", *keyModel, strings.Join(checker.Models(), ", "))
+		os.Exit(1)
+	}
+	if *keyModel != checker.DefaultModel && len(initValues) > 0 {
+		fmt.Fprintf(out, "-init and -init-file only apply to -key-model=%s\n", checker.DefaultModel)
+		os.Exit(1)
+	}
+	switch *vizFormat {
+	case vizNone, vizHTML, vizSVG, vizJSON, vizMermaid, vizDot:
+	default:
+		fmt.Fprintf(out, "Unknown visualization format %q (want html, svg, json, mermaid, dot or none)\n", *vizFormat)
+		os.Exit(1)
+	}
+	switch *sortBy {
+	case sortName, sortEvents, sortStatus:
+	default:
+		fmt.Fprintf(out, "Unknown key order %q (want name, events or status)\n", *sortBy)
+		os.Exit(1)
+	}
+	if *verifyCombined && (*lowMem || *wholeHistory) {
+		fmt.Fprintln(out, "-verify-combined cannot be combined with -low-mem or -whole-history")
+		os.Exit(1)
+	}
+	if *sortBy == sortStatus && *lowMem {
+		fmt.Fprintln(out, "-sort=status cannot be combined with -low-mem, which reports each batch of keys as it is checked")
+		os.Exit(1)
+	}
+	switch *timeoutPolicy {
+	case policyFail, policyPass, policyIgnore:
+	default:
+		fmt.Fprintf(out, "Unknown timeout policy %q (want fail, pass or ignore)\n", *timeoutPolicy)
+		os.Exit(1)
+	}
+	switch *clientOverlaps {
+	case overlapsWarn, overlapsClamp, overlapsIgnore:
+	default:
+		fmt.Fprintf(out, "Unknown -client-overlaps %q (want warn, clamp or ignore)\n", *clientOverlaps)
+		os.Exit(1)
+	}
+	switch *valueType {
+	case valuesString:
+	case valuesNumeric:
+		numericGlobs = patternList{"*"}
+	default:
+		fmt.Fprintf(out, "Unknown -value-type %q (want string or numeric)\n", *valueType)
+		os.Exit(1)
+	}
+	if *clientOverlaps == overlapsClamp && *lowMem {
+		fmt.Fprintln(out, "-client-overlaps=clamp cannot be combined with -low-mem, which parses a few keys at a time")
+		os.Exit(1)
+	}
+	if *vizGzip && *vizFormat != vizHTML {
+		fmt.Fprintln(out, "-viz-gzip only applies to -viz-format=html")
+		os.Exit(1)
+	}
+	if *vizGzip && *zipOut != "" {
+		fmt.Fprintln(out, "-viz-gzip cannot be combined with -zip-out, which compresses the visualizations already")
+		os.Exit(1)
+	}
+	if *noViz || *model != "linearizable" || *clientOrder {
+		*vizFormat = vizNone
+	}
+	opts := checkOptions{
+		Options: checker.Options{
+			Timeout:         *timeout,
+			TimeoutPerEvent: *timeoutPerEvent,
+			MinTimeout:      *minTimeout,
+			Jobs:            *jobs,
+			Keys:            keyPatterns,
+			ExcludeKeys:     excludeGlobs,
+			Clients:         clients,
+			Format:          logFmt,
+			IncludePending:  *includePending,
+			WholeHistory:    *wholeHistory,
+			InitValues:      initValues,
+			Model:           *keyModel,
+			Tombstone:       *tombstone,
+			NumericKeys:     numericGlobs,
+			Sequential:      *model == "sequential",
+			ReadYourWrites:  *model == "ryw",
+			Eventual:        *model == "eventual",
+			ClientOrder:     *clientOrder,
+			MaxEvents:       *maxEvents,
+			MinOps:          *minOps,
+			FailFast:        *failFast,
+		},
+		lowMem:          *lowMem,
+		vizDir:          *vizDir,
+		zipOut:          *zipOut,
+		vizFormat:       *vizFormat,
+		vizGzip:         *vizGzip,
+		jsonl:           *input == "jsonl",
+		stats:           *stats,
+		summaryOnly:     *summaryOnly,
+		groupDelim:      *groupByPrefix,
+		timeoutPolicy:   *timeoutPolicy,
+		sortBy:          *sortBy,
+		verifyCombined:  *verifyCombined,
+		minOpsUnknown:   *minOpsUnknown,
+		clientOverlaps:  *clientOverlaps,
+		counterexamples: !*noViz && !*noCounterexample,
+		perKeyDir:       *perKeyOut,
+	}
+	if *verbose {
+		opts.Progress = printProgress
+	}
+	// A watched log's keys change with every check, leaving nothing worth
+	// caching
+	if *cacheDir != "" && !*watch && !*parseOnly {
+		if cache, err := openCache(*cacheDir, *noCache); err != nil {
+			fmt.Fprintf(out, "Warning: not caching results: %v\n", err)
+		} else {
+			opts.Cache = cache
+		}
+	}
+	args := flag.Args()
+	if *filesFrom != "" {
+		listed, err := readManifest(*filesFrom)
+		if err != nil {
+			fmt.Fprintln(out, "Error:", err)
+			os.Exit(1)
+		}
+		args = append(args, listed...)
+	}
+	targets, err := collectTargets(args, *glob)
+	if err != nil {
+		fmt.Fprintln(out, "Error:", err)
+		os.Exit(1)
+	}
+	if len(targets) == 0 {
+		fmt.Fprintf(out, "No log files matching %s found\n", *glob)
+		os.Exit(1)
+	}
+
+	if err := startProfiles(*cpuProfile, *memProfile); err != nil {
+		fmt.Fprintln(out, "Error:", err)
+		os.Exit(1)
+	}
+	if *listFailures {
+		// Only the list of keys, and the files that could not be checked,
+		// are printed from here on
+		out, checker.Warnings = io.Discard, io.Discard
+	}
+
+	if *watch {
+		var conflict string
+		switch {
+		case len(targets) != 1 || targets[0].path == "-":
+			conflict = "-watch needs exactly one log file"
+		case *watchInterval <= 0:
+			conflict = "-watch-interval must be positive"
+		case *lowMem:
+			conflict = "-watch cannot be combined with -low-mem"
+		case *wholeHistory:
+			conflict = "-watch cannot be combined with -whole-history"
+		case *verifyCombined:
+			conflict = "-watch cannot be combined with -verify-combined"
+		case *parseOnly:
+			conflict = "-watch cannot be combined with -parse-only"
+		case *format != "text":
+			conflict = "-watch only prints text output"
+		}
+		if conflict != "" {
+			fmt.Fprintln(out, conflict)
+			exit(1)
+		}
+		watchLog(targets[0].path, opts, *watchInterval)
+	}
+
+	if *parseOnly {
+		status := 0
+		for _, target := range targets {
+			file, err := checker.OpenLog(target.path)
+			if err != nil {
+				fmt.Fprintln(out, "Error:", err)
+				status = 1
+				continue
+			}
+			events, stats, err := parseLog(file, opts)
+			file.Close()
+			if err != nil {
+				fmt.Fprintf(out, "Error: reading %s: %v\n", target.path, err)
+				status = 1
+				continue
+			}
+			fmt.Fprintf(out, "=== %s: %d events ===\n", target.path, len(events))
+			printEvents(out, events)
+			stats.PrintWarnings(out)
+			if opts.stats {
+				printStats(out, events)
+			}
+		}
+		exit(status)
+	}
+
+	if *merge && len(targets) > 1 {
+		// Check one history under a name of its own
+		parts := make([]string, len(targets))
+		for i, target := range targets {
+			parts[i] = target.path
+		}
+		targets = []logTarget{{path: fmt.Sprintf("merged (%d logs)", len(parts)), vizName: "merged", parts: parts}}
+	}
+
+	ceiling := "none"
+	if *timeout > 0 {
+		ceiling = timeout.String()
+	}
+	if *timeoutPerEvent > 0 {
+		fmt.Fprintf(out, "Per-key timeout: %v per event, min %v, max %s\n", *timeoutPerEvent, *minTimeout, ceiling)
+	} else {
+		fmt.Fprintln(out, "Per-key timeout:", ceiling)
+	}
+
+	if opts.zipOut != "" {
+		// The files are gathered in a directory of their own and archived
+		// at the end, as the combined page reads the per-key pages back
+		tmp, err := os.MkdirTemp("", "lcheck-zip-")
+		if err != nil {
+			fmt.Fprintln(out, "Error:", err)
+			exit(1)
+		}
+		opts.vizDir = tmp
+	}
+
+	opts.Interrupt = handleInterrupt()
+	results := make([]fileReport, len(targets))
+	interrupted := false
+	for i, target := range targets {
+		results[i] = checkLinearizability(target, opts)
+		interrupted = results[i].Interrupted
+		if closed(opts.Interrupt) && i+1 < len(targets) {
+			fmt.Fprintf(out, "Interrupted: %d more files not checked\n", len(targets)-i-1)
+			targets, results = targets[:i+1], results[:i+1]
+			interrupted = true
+			break
+		}
+		if opts.FailFast && results[i].verdict != porcupine.Ok && i+1 < len(targets) {
+			fmt.Fprintf(out, "Stopped early (-fail-fast): %d more files not checked\n", len(targets)-i-1)
+			targets, results = targets[:i+1], results[:i+1]
+			break
+		}
+	}
+
+	// Per-file summary and combined tally, so the overall outcome is greppable
+	sum := summarize(targets, results, opts)
+	var parseTime, checkTime time.Duration
+	for _, r := range results {
+		parseTime += r.parseTime
+		checkTime += r.checkTime
+	}
+	fmt.Fprintf(out, "Parse time %v, check time %v\n", parseTime.Round(time.Microsecond), checkTime.Round(time.Microsecond))
+	if *timings {
+		printTimings(results)
+	}
+	if opts.zipOut != "" {
+		n, err := writeZip(opts.zipOut, opts.vizDir)
+		os.RemoveAll(opts.vizDir)
+		if err != nil {
+			fmt.Fprintf(out, "Error writing %s: %v\n", opts.zipOut, err)
+			exit(1)
+		}
+		fmt.Fprintf(out, "Archived %d files to %s\n", n, opts.zipOut)
+	}
+
+	if *listFailures {
+		for i, target := range targets {
+			if results[i].Error != "" {
+				fmt.Fprintf(os.Stderr, "Error: %s: %s\n", target.path, results[i].Error)
+			}
+		}
+		err := writeKeyList(results, "", statusIllegal)
+		if err == nil && *timeoutsOut != "" {
+			err = writeKeyList(results, *timeoutsOut, statusTimeout, statusSkipped)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			exit(1)
+		}
+	}
+
+	if *format != "text" {
+		rep := report{Version: version, Revision: revision(), GoVersion: runtime.Version(), Files: results, OverallOk: sum.overallOk(interrupted, opts.timeoutPolicy)}
+		write := writeReport
+		if *format == "junit" {
+			write = writeJUnit
+		}
+		if err := write(rep, *reportOut); err != nil {
+			fmt.Fprintln(out, "Error:", err)
+			exit(1)
+		}
+	}
+
+	switch {
+	case sum.failed > 0, sum.errored > 0:
+		exit(exitNotLinearizable)
+	case interrupted:
+		exit(exitInterrupted)
+	case sum.timedOut > 0 && opts.timeoutPolicy == policyFail:
+		exit(exitTimeout)
+	}
+	exit(exitOk)
+}
+
+// runSummary counts the logs of a run by how they were decided
+type runSummary struct {
+	passed, failed, timedOut, errored int
+	// stopped counts the logs an interrupt left undecided
+	stopped int
+}
+
+// summarize prints the verdict of each log and the tally of the run, and
+// marks the logs -timeout-policy lets pass as OverallOk.
+func summarize(targets []logTarget, results []fileReport, opts checkOptions) runSummary {
+	var s runSummary
+	undecided := "Unknown"
+	switch opts.timeoutPolicy {
+	case policyPass:
+		undecided = "Unknown, counted as " + satisfies
+	case policyIgnore:
+		undecided = "Unknown, ignored"
+	}
+	fmt.Fprintln(out, "=== Summary ===")
+	for i, target := range targets {
+		switch {
+		case results[i].Error != "":
+			s.errored++
+			printColored(colorRed, "File %s: could not be checked: %s", target.path, results[i].Error)
+		case results[i].verdict == porcupine.Ok:
+			s.passed++
+			printColored(colorGreen, "File %s: %s", target.path, satisfies)
+		case results[i].verdict == porcupine.Illegal:
+			s.failed++
+			printColored(colorRed, "File %s: NOT %s", target.path, satisfies)
+		case results[i].hasKeyStatus(statusError):
+			// Not decided, but unlike a timeout no -timeout-policy lets it pass
+			s.errored++
+			printColored(colorRed, "File %s: could not be checked: the check of a key failed", target.path)
+		default:
+			// -timeout-policy is about keys that could not be decided, not
+			// keys an interrupt left unchecked
+			switch {
+			case results[i].Interrupted:
+				s.stopped++
+			case opts.timeoutPolicy == policyPass:
+				s.passed++
+			default:
+				s.timedOut++
+			}
+			if opts.timeoutPolicy != policyFail && !results[i].Interrupted {
+				results[i].OverallOk = true
+			}
+			what, label := "check timed out", undecided
+			switch {
+			case results[i].Interrupted:
+				what, label = "interrupted", "Unknown"
+			case results[i].hasKeyStatus(statusTimeout):
+			case results[i].hasKeyStatus(statusSkipped):
+				what = "keys skipped as too large"
+			case len(results[i].TrivialKeys) > 0:
+				what = "keys skipped as trivial"
+			}
+			printColored(colorYellow, "File %s: %s (%s)", target.path, what, label)
+		}
+	}
+	tally := fmt.Sprintf("Checked %d file(s): %d %s, %d not %s, %d timed out, %d could not be checked",
+		len(targets), s.passed, satisfies, s.failed, satisfies, s.timedOut, s.errored)
+	if s.stopped > 0 {
+		tally += fmt.Sprintf(", %d interrupted", s.stopped)
+	}
+	fmt.Fprintln(out, tally)
+	return s
+}
 
-	filename := os.Args[1]
-	checkLinearizability(filename)
+// overallOk reports whether the run passes as a whole: nothing failed or was
+// interrupted, and -timeout-policy=ignore if a log timed out.
+func (s runSummary) overallOk(interrupted bool, policy string) bool {
+	return s.failed == 0 && s.errored == 0 && !interrupted && (s.timedOut == 0 || policy == policyIgnore)
 }
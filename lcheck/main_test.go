@@ -0,0 +1,460 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anishathalye/porcupine"
+
+	"lcheck/checker"
+)
+
+func TestSpanStats(t *testing.T) {
+	log := `2025-01-01T00:00:00Z Client_1 [Req:1] Setting a = 1
+2025-01-01T00:00:01Z Client_2 [Req:1] Getting a
+2025-01-01T00:00:02Z Client_3 [Req:1] Getting b
+2025-01-01T00:00:03Z Client_1 [Req:1] Set a = 1
+2025-01-01T00:00:04Z Client_2 [Req:1] Get a = 1
+2025-01-01T00:00:05Z Client_1 [Req:2] Getting a
+2025-01-01T00:00:06Z Client_1 [Req:2] Get a = 1
+`
+	events, _, err := checker.ParseLogFormat(strings.NewReader(log), checker.DefaultFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s spanStats
+	s.add(events, false)
+	// The get of b never returns, so it stays in flight until the end
+	if s.peak != 3 || s.keyPeak != 2 || s.peakKey != "a" {
+		t.Errorf("peak = %d, on one key %d (%s); want 3, 2 (a)", s.peak, s.keyPeak, s.peakKey)
+	}
+	if got := s.last.Sub(s.first); got != 6*time.Second {
+		t.Errorf("span = %v, want 6s", got)
+	}
+}
+
+func TestSortResults(t *testing.T) {
+	evs := func(n int) []porcupine.Event { return make([]porcupine.Event, n) }
+	results := func() []checker.KeyResult {
+		return []checker.KeyResult{
+			{Key: "a", Events: evs(2), Result: porcupine.Ok},
+			{Key: "b", Events: evs(6), Result: porcupine.Unknown},
+			{Key: "c", Events: evs(4), Result: porcupine.Illegal},
+			{Key: "d", Events: evs(6), Result: porcupine.Unknown, Skipped: true},
+			{Key: "e", Events: evs(8), Result: porcupine.Ok},
+		}
+	}
+	tests := []struct {
+		by   string
+		want string
+	}{
+		{sortName, "abcde"},
+		{sortEvents, "ebdca"},
+		{sortStatus, "cbdae"},
+	}
+	for _, tt := range tests {
+		rs := results()
+		sortResults(rs, tt.by)
+		var got string
+		for _, r := range rs {
+			got += r.Key
+		}
+		if got != tt.want {
+			t.Errorf("-sort=%s: got %s, want %s", tt.by, got, tt.want)
+		}
+	}
+}
+
+func TestCheckWithoutViz(t *testing.T) {
+	out = io.Discard
+	checker.Warnings = io.Discard
+	defer func() { out, checker.Warnings = os.Stdout, os.Stderr }()
+
+	dir := t.TempDir()
+	logs := map[string]string{
+		"ok": `Client_1 [Req: 1] Setting a = 1
+Client_1 [Req: 1] Set a = 1
+Client_1 [Req: 2] Getting a
+Client_1 [Req: 2] Get a = 1
+`,
+		"stale": `Client_1 [Req: 1] Setting a = 1
+Client_1 [Req: 1] Set a = 1
+Client_1 [Req: 2] Getting a
+Client_1 [Req: 2] Get a = NONE
+`,
+	}
+	vizDir := filepath.Join(dir, "viz")
+	// What -no-viz sets
+	opts := checkOptions{Options: checker.Options{Format: checker.DefaultFormat}, vizDir: vizDir, vizFormat: vizNone}
+	for name, log := range logs {
+		path := filepath.Join(dir, name+".log")
+		if err := os.WriteFile(path, []byte(log), 0644); err != nil {
+			t.Fatal(err)
+		}
+		rep := checkLinearizability(logTarget{path: path, vizName: name}, opts)
+		if rep.Error != "" {
+			t.Fatalf("%s: %s", name, rep.Error)
+		}
+	}
+	if _, err := os.Stat(vizDir); !os.IsNotExist(err) {
+		t.Errorf("output directory created without visualizations (stat: %v)", err)
+	}
+}
+
+func TestSummaryOnly(t *testing.T) {
+	checker.Warnings = io.Discard
+	defer func() { out, checker.Warnings = os.Stdout, os.Stderr }()
+
+	path := filepath.Join(t.TempDir(), "mixed.log")
+	log := `Client_1 [Req: 1] Setting good = 1
+Client_1 [Req: 1] Set good = 1
+Client_1 [Req: 2] Setting bad = 1
+Client_1 [Req: 2] Set bad = 1
+Client_1 [Req: 3] Getting bad
+Client_1 [Req: 3] Get bad = NONE
+`
+	if err := os.WriteFile(path, []byte(log), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var got strings.Builder
+	out = &got
+	opts := checkOptions{Options: checker.Options{Format: checker.DefaultFormat}, vizFormat: vizNone, summaryOnly: true}
+	rep := checkLinearizability(logTarget{path: path, vizName: "mixed"}, opts)
+	if rep.verdict != porcupine.Illegal || len(rep.PerKey) != 2 {
+		t.Fatalf("verdict %v with %d keys, want Illegal with both keys reported", rep.verdict, len(rep.PerKey))
+	}
+	for _, want := range []string{"=== Checking key bad ", "Key bad: NOT linearizable", "Keys: 1 linearizable, 1 not linearizable, 0 timed out, 0 skipped\n"} {
+		if !strings.Contains(got.String(), want) {
+			t.Errorf("missing %q in the output:\n%s", want, got.String())
+		}
+	}
+	if strings.Contains(got.String(), "key good") || strings.Contains(got.String(), "Key good") {
+		t.Errorf("the passing key is listed:\n%s", got.String())
+	}
+}
+
+func TestVerifyCombined(t *testing.T) {
+	out = io.Discard
+	checker.Warnings = io.Discard
+	defer func() { out, checker.Warnings = os.Stdout, os.Stderr }()
+
+	// Each key is sequentially consistent on its own, but no order of the
+	// whole history lets both clients miss the other's write
+	path := filepath.Join(t.TempDir(), "sc.log")
+	log := `Client_1 [Req: 1] Setting x = 1
+Client_2 [Req: 1] Setting y = 1
+Client_1 [Req: 1] Set x = 1
+Client_2 [Req: 1] Set y = 1
+Client_1 [Req: 2] Getting y
+Client_2 [Req: 2] Getting x
+Client_1 [Req: 2] Get y = NONE
+Client_2 [Req: 2] Get x = NONE
+`
+	if err := os.WriteFile(path, []byte(log), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts := checkOptions{Options: checker.Options{Format: checker.DefaultFormat, Sequential: true}, vizFormat: vizNone}
+	if rep := checkLinearizability(logTarget{path: path, vizName: "sc"}, opts); rep.verdict != porcupine.Ok || rep.Combined != "" {
+		t.Fatalf("per key: verdict %v, combined %q; want Ok without a combined check", rep.verdict, rep.Combined)
+	}
+	opts.verifyCombined = true
+	rep := checkLinearizability(logTarget{path: path, vizName: "sc"}, opts)
+	if rep.verdict != porcupine.Illegal || rep.Combined != statusIllegal || len(rep.CombinedViolation) == 0 {
+		t.Fatalf("combined: verdict %v, combined %q, violation %q; want Illegal", rep.verdict, rep.Combined, rep.CombinedViolation)
+	}
+	// Every key passed, so only the whole history's testcase fails
+	junit := filepath.Join(t.TempDir(), "junit.xml")
+	if err := writeJUnit(report{Files: []fileReport{rep}}, junit); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(junit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `failures="1"`) || !strings.Contains(string(data), `name="`+checker.HistoryKey+`"`) {
+		t.Errorf("JUnit report of the failed combined check:\n%s", data)
+	}
+}
+
+func TestFileCache(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := openCache(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := checker.CacheEntry{Result: porcupine.Illegal, Elapsed: time.Second, Partials: [][][]int{{{0, 1}}}}
+	if _, ok := cache.Get("id"); ok {
+		t.Fatal("empty cache has an entry")
+	}
+	cache.Put("id", want)
+	if got, ok := cache.Get("id"); !ok || got.Result != want.Result || got.Elapsed != want.Elapsed || len(got.Partials) != 1 {
+		t.Errorf("Get = %+v, %v; want %+v", got, ok, want)
+	}
+
+	refresh, err := openCache(dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := refresh.Get("id"); ok {
+		t.Error("refreshing cache restored an entry")
+	}
+}
+
+func TestCollectTargets(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a/run.log", "a/sub/run.log", "b/run.log.gz", "b/notes.txt"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	targets, err := collectTargets([]string{filepath.Join(dir, "a"), filepath.Join(dir, "b")}, "*.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, tg := range targets {
+		rel, _ := filepath.Rel(dir, tg.path)
+		got = append(got, filepath.ToSlash(rel)+"="+filepath.ToSlash(tg.vizName))
+	}
+	// The two run.log get names of their own, so their outputs don't
+	// overwrite each other
+	want := []string{"a/run.log=run", "a/sub/run.log=sub/run", "b/run.log.gz=run-2"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("targets = %q, want %q", got, want)
+	}
+}
+
+func TestReadManifest(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.log", "b.log"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	abs := filepath.Join(dir, "b.log")
+	manifest := filepath.Join(dir, "manifest.txt")
+	write := func(s string) {
+		if err := os.WriteFile(manifest, []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("# run 1\na.log\n\n  " + abs + "  \n")
+	paths, err := readManifest(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{filepath.Join(dir, "a.log"), abs}; strings.Join(paths, ",") != strings.Join(want, ",") {
+		t.Errorf("paths = %q, want %q", paths, want)
+	}
+
+	write("a.log\nc.log\nd.log\n")
+	_, err = readManifest(manifest)
+	if err == nil || !strings.Contains(err.Error(), "2 listed paths are missing") || !strings.Contains(err.Error(), "line 3: "+filepath.Join(dir, "d.log")) {
+		t.Errorf("err = %v, want the 2 missing paths listed", err)
+	}
+
+	write("# nothing yet\n")
+	if _, err := readManifest(manifest); err == nil {
+		t.Error("an empty manifest was accepted")
+	}
+}
+
+func TestWriteKeyList(t *testing.T) {
+	results := []fileReport{
+		{File: "a.log", PerKey: []keyReport{{Key: "k1", Status: statusOk}, {Key: "k2", Status: statusIllegal}, {Key: "k3", Status: statusTimeout}}},
+		{File: "b.log", PerKey: []keyReport{{Key: "k1", Status: statusSkipped}}, Combined: statusIllegal},
+	}
+	path := filepath.Join(t.TempDir(), "keys.txt")
+	read := func() string {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	if err := writeKeyList(results[:1], path, statusIllegal); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(); got != "k2\n" {
+		t.Errorf("failures of one file = %q, want %q", got, "k2\n")
+	}
+	if err := writeKeyList(results, path, statusIllegal); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := read(), "a.log\tk2\nb.log\t"+checker.HistoryKey+"\n"; got != want {
+		t.Errorf("failures = %q, want %q", got, want)
+	}
+	if err := writeKeyList(results, path, statusTimeout, statusSkipped); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := read(), "a.log\tk3\nb.log\tk1\n"; got != want {
+		t.Errorf("timeouts = %q, want %q", got, want)
+	}
+}
+
+func TestGenerateLog(t *testing.T) {
+	for _, violation := range []bool{false, true} {
+		o := genOptions{clients: 4, keys: 3, ops: 200, seed: 7, violation: violation, timestamps: true}
+		var log strings.Builder
+		generateLog(&log, o)
+		var again strings.Builder
+		generateLog(&again, o)
+		if log.String() != again.String() {
+			t.Errorf("violation %t: the same seed generated different logs", violation)
+		}
+		events, stats, err := checker.ParseLogFormat(strings.NewReader(log.String()), checker.DefaultFormat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.Matched() != stats.Lines() || len(stats.Warnings()) > 0 {
+			t.Errorf("violation %t: matched %d of %d lines, warnings %v", violation, stats.Matched(), stats.Lines(), stats.Warnings())
+		}
+		res, err := checker.CheckEvents(events, checker.Options{Timeout: time.Minute})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := porcupine.Ok
+		if violation {
+			want = porcupine.Illegal
+		}
+		if res.Status != want {
+			t.Errorf("violation %t: status %v, want %v", violation, res.Status, want)
+		}
+		for _, r := range res.Keys {
+			if r.Result == porcupine.Illegal && r.Key != "key_1" {
+				t.Errorf("violation %t: key %s is not linearizable", violation, r.Key)
+			}
+		}
+	}
+}
+
+// TestCheckClientOrderViz checks that -client-order, whose orders porcupine
+// cannot draw, writes no visualizations, while the same log checked by
+// porcupine does.
+func TestCheckClientOrderViz(t *testing.T) {
+	out = io.Discard
+	checker.Warnings = io.Discard
+	defer func() { out, checker.Warnings = os.Stdout, os.Stderr }()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "x.log")
+	var log strings.Builder
+	generateLog(&log, genOptions{clients: 3, keys: 2, ops: 20, seed: 1})
+	if err := os.WriteFile(path, []byte(log.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, clientOrder := range []bool{false, true} {
+		vizDir := filepath.Join(dir, fmt.Sprintf("viz-%t", clientOrder))
+		opts := checkOptions{Options: checker.Options{Format: checker.DefaultFormat, ClientOrder: clientOrder}, vizDir: vizDir, vizFormat: vizHTML}
+		rep := checkLinearizability(logTarget{path: path, vizName: "x"}, opts)
+		if rep.Error != "" || rep.verdict != porcupine.Ok {
+			t.Fatalf("client order %t: verdict %v, error %q", clientOrder, rep.verdict, rep.Error)
+		}
+		files, _ := filepath.Glob(filepath.Join(vizDir, "x", "*.html"))
+		if clientOrder && len(files) > 0 {
+			t.Errorf("-client-order wrote visualizations %v", files)
+		}
+		if !clientOrder && len(files) != 3 {
+			t.Errorf("wrote visualizations %v, want 2 keys and output_all.html", files)
+		}
+		for _, f := range files {
+			if st, err := os.Stat(f); err != nil || st.Size() == 0 {
+				t.Errorf("%s is empty (stat: %v)", f, err)
+			}
+		}
+	}
+}
+
+// TestTimeoutPolicy checks how each -timeout-policy counts a log with a key
+// that timed out, one with a key skipped as too large, and one an interrupt
+// left undecided, which no policy lets pass.
+func TestTimeoutPolicy(t *testing.T) {
+	checker.Warnings = io.Discard
+	defer func() { out, checker.Warnings = os.Stdout, os.Stderr }()
+
+	// Any order of the overlapping puts is linearizable up to the read of
+	// a value none of them wrote, so the search takes long to give up
+	var slow strings.Builder
+	const n = 22
+	for c := 1; c <= n; c++ {
+		fmt.Fprintf(&slow, "Client_%d [Req: 1] Setting k = %d\n", c, c)
+	}
+	for c := 1; c <= n; c++ {
+		fmt.Fprintf(&slow, "Client_%d [Req: 1] Set k = %d\n", c, c)
+	}
+	fmt.Fprintf(&slow, "Client_%d [Req: 1] Getting k\nClient_%d [Req: 1] Get k = x\n", n+1, n+1)
+	dir := t.TempDir()
+	logs := map[string]string{
+		"slow": slow.String(),
+		"ok":   "Client_1 [Req: 1] Setting k = a\nClient_1 [Req: 1] Set k = a\n",
+	}
+	for name, log := range logs {
+		if err := os.WriteFile(filepath.Join(dir, name+".log"), []byte(log), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	interrupt := make(chan struct{})
+	close(interrupt)
+	check := func(name string, o checker.Options) fileReport {
+		o.Format = checker.DefaultFormat
+		return checkLinearizability(logTarget{path: filepath.Join(dir, name+".log"), vizName: name}, checkOptions{Options: o, vizFormat: vizNone})
+	}
+
+	tests := []struct {
+		policy                       string
+		timeout, skipped, stopped    string // the summary lines of the logs
+		tally                        string
+		timedOutOk, skippedOk, runOk bool
+	}{
+		{policyFail, "check timed out (Unknown)", "keys skipped as too large (Unknown)", "interrupted (Unknown)",
+			"Checked 4 file(s): 1 linearizable, 0 not linearizable, 2 timed out, 0 could not be checked, 1 interrupted", false, false, false},
+		{policyPass, "check timed out (Unknown, counted as linearizable)", "keys skipped as too large (Unknown, counted as linearizable)", "interrupted (Unknown)",
+			"Checked 4 file(s): 3 linearizable, 0 not linearizable, 0 timed out, 0 could not be checked, 1 interrupted", true, true, true},
+		{policyIgnore, "check timed out (Unknown, ignored)", "keys skipped as too large (Unknown, ignored)", "interrupted (Unknown)",
+			"Checked 4 file(s): 1 linearizable, 0 not linearizable, 2 timed out, 0 could not be checked, 1 interrupted", true, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			out = io.Discard
+			results := []fileReport{
+				check("ok", checker.Options{}),
+				check("slow", checker.Options{Timeout: 20 * time.Millisecond}),
+				check("slow", checker.Options{MaxEvents: 2}),
+				check("slow", checker.Options{Interrupt: interrupt}),
+			}
+			targets := []logTarget{{path: "ok.log"}, {path: "timeout.log"}, {path: "skipped.log"}, {path: "stopped.log"}}
+			var summary strings.Builder
+			out = &summary
+			s := summarize(targets, results, checkOptions{timeoutPolicy: tt.policy})
+			for _, want := range []string{"File ok.log: linearizable", "File timeout.log: " + tt.timeout,
+				"File skipped.log: " + tt.skipped, "File stopped.log: " + tt.stopped, tt.tally} {
+				if !strings.Contains(summary.String(), want+"\n") {
+					t.Errorf("missing %q in the summary:\n%s", want, summary.String())
+				}
+			}
+			if results[1].OverallOk != tt.timedOutOk || results[2].OverallOk != tt.skippedOk || results[3].OverallOk {
+				t.Errorf("OverallOk of the timed-out, skipped and interrupted logs = %t, %t, %t; want %t, %t, false",
+					results[1].OverallOk, results[2].OverallOk, results[3].OverallOk, tt.timedOutOk, tt.skippedOk)
+			}
+			// main says whether the run was interrupted; otherwise the policy
+			// decides whether the undecided logs fail it
+			if got := s.overallOk(false, tt.policy); got != tt.runOk {
+				t.Errorf("run without the interrupt: overallOk = %t, want %t", got, tt.runOk)
+			}
+			if s.overallOk(true, tt.policy) {
+				t.Error("interrupted run: overallOk = true")
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// ================= Profiling =================
+
+// stopProfiles finishes the profiles started by startProfiles, if any
+var stopProfiles = func() {}
+
+// startProfiles starts a CPU profile written to cpuPath, and arranges for a
+// heap profile to be written to memPath when the run ends. Either path may
+// be empty to skip that profile. The profiles are only complete if the run
+// ends through exit.
+func startProfiles(cpuPath, memPath string) error {
+	var cpu *os.File
+	if cpuPath != "" {
+		f, err := os.Create(cpuPath)
+		if err != nil {
+			return fmt.Errorf("creating CPU profile: %v", err)
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return fmt.Errorf("starting CPU profile: %v", err)
+		}
+		cpu = f
+	}
+	stopProfiles = func() {
+		if cpu != nil {
+			pprof.StopCPUProfile()
+			cpu.Close()
+		}
+		if memPath == "" {
+			return
+		}
+		f, err := os.Create(memPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating memory profile: %v\n", err)
+			return
+		}
+		defer f.Close()
+		// Collect garbage first so that the in-use figures are current; the
+		// profile also records every allocation of the run (-sample_index=alloc_space)
+		runtime.GC()
+		if err := pprof.WriteHeapProfile(f); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing memory profile: %v\n", err)
+		}
+	}
+	return nil
+}
+
+// exit finishes the profiles and ends the process with code.
+func exit(code int) {
+	stopProfiles()
+	os.Exit(code)
+}
@@ -0,0 +1,423 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anishathalye/porcupine"
+
+	"lcheck/checker"
+)
+
+// ================= Machine-readable report =================
+
+// out receives the human-readable progress output. It is redirected to
+// stderr when the JSON report is written to stdout, so that stdout stays
+// parseable.
+var out io.Writer = os.Stdout
+
+// The property being checked and the adjective of a history that has it, as
+// the text output names them; -model=sequential and -model=ryw switch them
+var (
+	property  = "linearizability"
+	satisfies = "linearizable"
+)
+
+// Per-key and per-file statuses as they appear in the JSON report
+const (
+	statusOk      = "ok"
+	statusIllegal = "illegal"
+	statusTimeout = "timeout"
+	statusSkipped = "skipped" // the key had too many events to be checked
+	statusError   = "error"   // the file, or the key, could not be checked at all
+)
+
+// keyStatus maps a key's result onto its report status.
+func keyStatus(r checker.KeyResult) string {
+	switch {
+	case r.Skipped:
+		return statusSkipped
+	case r.Err != nil:
+		return statusError
+	}
+	return statusOf(r.Result)
+}
+
+// statusOf maps a porcupine result onto its report status.
+func statusOf(res porcupine.CheckResult) string {
+	switch res {
+	case porcupine.Ok:
+		return statusOk
+	case porcupine.Illegal:
+		return statusIllegal
+	default:
+		return statusTimeout
+	}
+}
+
+type keyReport struct {
+	Key        string `json:"key"`
+	EventCount int    `json:"eventCount"`
+	// Concurrency is the most operations of the key in flight at once
+	Concurrency int    `json:"concurrency"`
+	Status      string `json:"status"`
+	// DurationMs is the time porcupine spent checking the key
+	DurationMs float64 `json:"durationMs"`
+	// Cached is set if the result was restored from the cache, DurationMs
+	// then being the time of the check that was cached
+	Cached bool `json:"cached,omitempty"`
+	// Violation describes the operations porcupine could not linearize
+	Violation []string `json:"violation,omitempty"`
+	// Counterexample is the file holding the key's minimal failing slice
+	Counterexample string `json:"counterexample,omitempty"`
+	// Progress tells how far the search of a key that timed out got
+	Progress *progressReport `json:"progress,omitempty"`
+	// Error says why the check of the key failed, and Stack where it
+	// panicked
+	Error string `json:"error,omitempty"`
+	Stack string `json:"stack,omitempty"`
+
+	elapsed time.Duration
+}
+
+// progressReport is checker.Progress as the JSON report has it
+type progressReport struct {
+	LongestPrefix int `json:"longestPrefix"`
+	Operations    int `json:"operations"`
+	Partials      int `json:"partials,omitempty"`
+}
+
+type fileReport struct {
+	File string `json:"file"`
+	// TotalLines and MatchedLines tell how much of the log the format parsed
+	TotalLines   int `json:"totalLines"`
+	MatchedLines int `json:"matchedLines"`
+	// DuplicateLines counts the matched lines -dedup dropped as repeats
+	DuplicateLines int `json:"duplicateLines,omitempty"`
+	TotalEvents    int `json:"totalEvents"`
+	// UnfinishedOps counts calls that never returned
+	UnfinishedOps int `json:"unfinishedOps"`
+	// UncheckedKeys counts the keys -fail-fast, or an interrupt, left
+	// unchecked
+	UncheckedKeys int `json:"uncheckedKeys,omitempty"`
+	// ParseWarnings are the anomalies of the log's lines, such as returns
+	// without a call
+	ParseWarnings []checker.ParseWarning `json:"parseWarnings,omitempty"`
+	// Interrupted is set if the run was interrupted before every key of
+	// the file was checked
+	Interrupted bool        `json:"interrupted,omitempty"`
+	PerKey      []keyReport `json:"perKey"`
+	// TrivialKeys lists the keys -min-ops skipped
+	TrivialKeys []string `json:"trivialKeys,omitempty"`
+	// Groups rolls the keys up by logical key, with -group-by-prefix
+	Groups []groupReport `json:"groups,omitempty"`
+	// Combined is the status of the -verify-combined check of the whole
+	// history, if it ran
+	Combined string `json:"combined,omitempty"`
+	// CombinedViolation explains a combined check that failed
+	CombinedViolation []string `json:"combinedViolation,omitempty"`
+	Status            string   `json:"status"`
+	OverallOk         bool     `json:"overallOk"`
+	Error             string   `json:"error,omitempty"`
+
+	verdict   porcupine.CheckResult
+	parseTime time.Duration // reading and parsing the log
+	checkTime time.Duration // wall time of the porcupine checks
+}
+
+// setVerdict records the file's overall result in all its representations.
+func (r *fileReport) setVerdict(res porcupine.CheckResult) {
+	r.verdict = res
+	r.Status = statusOf(res)
+	r.OverallOk = res == porcupine.Ok
+}
+
+// hasKeyStatus reports whether any key of the file has the given status.
+func (r *fileReport) hasKeyStatus(status string) bool {
+	for _, k := range r.PerKey {
+		if k.Status == status {
+			return true
+		}
+	}
+	return false
+}
+
+// groupReport tallies the results of the keys sharing a logical key, such
+// as the shards user#0 to user#15 of "user"
+type groupReport struct {
+	Group   string `json:"group"`
+	Keys    int    `json:"keys"`
+	Ok      int    `json:"ok"`
+	Illegal int    `json:"illegal"`
+	Timeout int    `json:"timeout"`
+	Skipped int    `json:"skipped"`
+	Errors  int    `json:"errors"`
+	// Status is the worst status of the group's keys
+	Status string `json:"status"`
+}
+
+// groupKeys rolls the per-key results up by the part of each key before the
+// last delim, in order of first appearance. A key without delim is a group
+// of its own.
+func groupKeys(keys []keyReport, delim string) []groupReport {
+	var groups []groupReport
+	index := make(map[string]int)
+	for _, k := range keys {
+		name := k.Key
+		if i := strings.LastIndex(name, delim); i > 0 {
+			name = name[:i]
+		}
+		i, ok := index[name]
+		if !ok {
+			i = len(groups)
+			index[name] = i
+			groups = append(groups, groupReport{Group: name})
+		}
+		g := &groups[i]
+		g.Keys++
+		switch k.Status {
+		case statusOk:
+			g.Ok++
+		case statusIllegal:
+			g.Illegal++
+		case statusTimeout:
+			g.Timeout++
+		case statusSkipped:
+			g.Skipped++
+		case statusError:
+			g.Errors++
+		}
+	}
+	for i := range groups {
+		g := &groups[i]
+		switch {
+		case g.Illegal > 0:
+			g.Status = statusIllegal
+		case g.Errors > 0:
+			g.Status = statusError
+		case g.Timeout > 0:
+			g.Status = statusTimeout
+		case g.Skipped > 0:
+			g.Status = statusSkipped
+		default:
+			g.Status = statusOk
+		}
+	}
+	return groups
+}
+
+// addMatches records how many of a log's lines were parsed, adding up the
+// logs of a merged history.
+func (r *fileReport) addMatches(s checker.MatchStats) {
+	r.TotalLines += s.Lines()
+	r.MatchedLines += s.Matched()
+	r.DuplicateLines += s.Duplicates()
+	r.ParseWarnings = append(r.ParseWarnings, s.Warnings()...)
+}
+
+// setError records that the file could not be checked.
+func (r *fileReport) setError(err error) {
+	r.verdict = porcupine.Illegal
+	r.Status = statusError
+	r.OverallOk = false
+	r.Error = err.Error()
+}
+
+type report struct {
+	// Version, Revision and GoVersion identify the build of lcheck that
+	// wrote the report, as -version prints them
+	Version   string       `json:"version"`
+	Revision  string       `json:"revision,omitempty"`
+	GoVersion string       `json:"goVersion"`
+	Files     []fileReport `json:"files"`
+	OverallOk bool         `json:"overallOk"`
+}
+
+// writeReport marshals the report as indented JSON to path, or to stdout if
+// path is empty.
+func writeReport(r report, path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeOutput(append(data, '\n'), path)
+}
+
+// writeOutput writes a report to path, or to stdout if path is empty.
+func writeOutput(data []byte, path string) error {
+	if path == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("writing report to %s: %v", path, err)
+	}
+	return nil
+}
+
+// keyFile is the result of one key as -per-key-out writes it: the key's
+// report and the log it is from
+type keyFile struct {
+	File string `json:"file"`
+	keyReport
+}
+
+// writeKeyFile writes the result of a key of the log file to dir as
+// <key>.json, and returns its path.
+func writeKeyFile(dir, file string, kr keyReport) (string, error) {
+	data, err := json.MarshalIndent(keyFile{File: file, keyReport: kr}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, safeFileName(kr.Key)+".json")
+	return path, os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// writeKeyList writes the keys of the results with one of the statuses to
+// path, or to stdout if path is empty, one per line as -list-failures lists
+// them. The keys of several files are each prefixed by the file and a tab. A
+// -verify-combined check with one of the statuses lists checker.HistoryKey.
+func writeKeyList(results []fileReport, path string, statuses ...string) error {
+	listed := func(status string) bool {
+		for _, s := range statuses {
+			if status == s {
+				return true
+			}
+		}
+		return false
+	}
+	var b strings.Builder
+	for _, r := range results {
+		var keys []string
+		for _, kr := range r.PerKey {
+			if listed(kr.Status) {
+				keys = append(keys, kr.Key)
+			}
+		}
+		if r.Combined != "" && listed(r.Combined) {
+			keys = append(keys, checker.HistoryKey)
+		}
+		for _, key := range keys {
+			if len(results) > 1 {
+				b.WriteString(r.File + "\t")
+			}
+			b.WriteString(key + "\n")
+		}
+	}
+	return writeOutput([]byte(b.String()), path)
+}
+
+// ================= JUnit XML report =================
+
+// JUnit XML as understood by Jenkins and most CI servers: a testsuite per log
+// file and a testcase per key
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Errors   int          `xml:"errors,attr"`
+	Skipped  int          `xml:"skipped,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Errors   int         `xml:"errors,attr"`
+	Skipped  int         `xml:"skipped,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure,omitempty"`
+	Error     *junitProblem `xml:"error,omitempty"`
+	Skipped   *junitProblem `xml:"skipped,omitempty"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// seconds formats a duration the way JUnit expects it
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+// writeJUnit writes the report as JUnit XML to path, or to stdout if path is
+// empty, with a testcase per key that fails if the key is not linearizable,
+// errs if it timed out and is skipped if it was too large. A file that could
+// not be read or had no events is a single testcase, as in the text summary,
+// and a failed -verify-combined check adds a failing one for the history.
+func writeJUnit(r report, path string) error {
+	var suites junitSuites
+	for _, f := range r.Files {
+		suite := junitSuite{Name: f.File, Time: seconds(f.parseTime + f.checkTime)}
+		add := func(c junitCase) {
+			suite.Tests++
+			if c.Failure != nil {
+				suite.Failures++
+			}
+			if c.Error != nil {
+				suite.Errors++
+			}
+			if c.Skipped != nil {
+				suite.Skipped++
+			}
+			suite.Cases = append(suite.Cases, c)
+		}
+
+		switch {
+		case f.Error != "":
+			add(junitCase{Name: f.File, ClassName: f.File, Time: seconds(0),
+				Error: &junitProblem{Message: "could not be checked", Text: f.Error}})
+		case len(f.PerKey) == 0 && f.verdict != porcupine.Ok:
+			add(junitCase{Name: f.File, ClassName: f.File, Time: seconds(0),
+				Failure: &junitProblem{Message: "no events found in log file"}})
+		}
+		for _, k := range f.PerKey {
+			c := junitCase{Name: k.Key, ClassName: f.File, Time: seconds(k.elapsed)}
+			switch k.Status {
+			case statusIllegal:
+				c.Failure = &junitProblem{Message: "not " + satisfies, Text: strings.Join(k.Violation, "\n")}
+			case statusTimeout:
+				c.Error = &junitProblem{Message: "check timed out (Unknown)"}
+			case statusSkipped:
+				c.Skipped = &junitProblem{Message: "skipped (too large)"}
+			case statusError:
+				c.Error = &junitProblem{Message: k.Error, Text: k.Stack}
+			}
+			add(c)
+		}
+		// The per-key testcases all pass when only the whole history fails
+		if f.Combined == statusIllegal {
+			add(junitCase{Name: checker.HistoryKey, ClassName: f.File, Time: seconds(0),
+				Failure: &junitProblem{Message: "whole history not " + satisfies, Text: strings.Join(f.CombinedViolation, "\n")}})
+		}
+
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Errors += suite.Errors
+		suites.Skipped += suite.Skipped
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	data, err := xml.MarshalIndent(suites, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append([]byte(xml.Header), data...)
+	return writeOutput(append(data, '\n'), path)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+
+	"lcheck/checker"
+)
+
+func TestWriteJUnit(t *testing.T) {
+	ok := fileReport{File: "ok.log", PerKey: []keyReport{{Key: "k1", Status: statusOk}}}
+	ok.setVerdict(porcupine.Ok)
+	bad := fileReport{File: "bad.log", PerKey: []keyReport{
+		{Key: "k1", Status: statusOk},
+		{Key: "k2", Status: statusIllegal, Violation: []string{"cannot linearize: client 2: get()=x"}},
+		{Key: "k3", Status: statusTimeout},
+		{Key: "k4", Status: statusSkipped},
+	}}
+	bad.setVerdict(porcupine.Illegal)
+	empty := fileReport{File: "empty.log", PerKey: []keyReport{}}
+	empty.setVerdict(porcupine.Illegal)
+	missing := fileReport{File: "missing.log", PerKey: []keyReport{}}
+	missing.setError(errors.New("cannot open missing.log"))
+	combined := fileReport{File: "combined.log", PerKey: []keyReport{{Key: "x", Status: statusOk}, {Key: "y", Status: statusOk}},
+		Combined: statusIllegal, CombinedViolation: []string{"cannot linearize the whole history"}}
+	combined.setVerdict(porcupine.Illegal)
+
+	path := filepath.Join(t.TempDir(), "junit.xml")
+	if err := writeJUnit(report{Files: []fileReport{ok, bad, empty, missing, combined}}, path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got junitSuites
+	if err := xml.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got.Suites) != 5 {
+		t.Fatalf("got %d testsuites, want one per file", len(got.Suites))
+	}
+	if got.Tests != 10 || got.Failures != 3 || got.Errors != 2 || got.Skipped != 1 {
+		t.Errorf("totals: tests=%d failures=%d errors=%d skipped=%d, want 10, 3, 2, 1", got.Tests, got.Failures, got.Errors, got.Skipped)
+	}
+	k2 := got.Suites[1].Cases[1]
+	if k2.Name != "k2" || k2.Failure == nil || k2.Failure.Text != "cannot linearize: client 2: get()=x" {
+		t.Errorf("illegal key testcase = %+v", k2)
+	}
+	if c := got.Suites[1].Cases[2]; c.Error == nil {
+		t.Errorf("timed-out key is not an error: %+v", c)
+	}
+	if c := got.Suites[1].Cases[3]; c.Skipped == nil || c.Failure != nil || c.Error != nil {
+		t.Errorf("skipped key testcase = %+v", c)
+	}
+	if c := got.Suites[3].Cases[0]; c.Error == nil || c.Error.Text != "cannot open missing.log" {
+		t.Errorf("unreadable file testcase = %+v", c)
+	}
+	if s := got.Suites[4]; s.Failures != 1 || s.Cases[2].Name != checker.HistoryKey || s.Cases[2].Failure == nil ||
+		s.Cases[2].Failure.Text != "cannot linearize the whole history" {
+		t.Errorf("failed combined check testsuite = %+v", s)
+	}
+}
+
+func TestGroupKeys(t *testing.T) {
+	keys := []keyReport{
+		{Key: "user#0", Status: statusOk},
+		{Key: "user#1", Status: statusIllegal},
+		{Key: "cart#0", Status: statusTimeout},
+		{Key: "cart#1", Status: statusOk},
+		{Key: "a#b#2", Status: statusSkipped},
+		{Key: "plain", Status: statusOk},
+		{Key: "#odd", Status: statusOk},
+	}
+	want := []groupReport{
+		{Group: "user", Keys: 2, Ok: 1, Illegal: 1, Status: statusIllegal},
+		{Group: "cart", Keys: 2, Ok: 1, Timeout: 1, Status: statusTimeout},
+		{Group: "a#b", Keys: 1, Skipped: 1, Status: statusSkipped},
+		{Group: "plain", Keys: 1, Ok: 1, Status: statusOk},
+		{Group: "#odd", Keys: 1, Ok: 1, Status: statusOk},
+	}
+	got := groupKeys(keys, "#")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("groupKeys =\n\t%+v\nwant\n\t%+v", got, want)
+	}
+}
+
+func TestWriteKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	kr := keyReport{Key: "user:42/profile", EventCount: 4, Concurrency: 2, Status: statusIllegal, DurationMs: 1.5, Violation: []string{"stale read"}}
+	path, err := writeKeyFile(dir, "run1.log", kr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "user%3A42%2Fprofile.json"); path != want {
+		t.Errorf("path = %s, want %s", path, want)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"file": "run1.log", "key": "user:42/profile", "eventCount": 4.0, "concurrency": 2.0, "status": statusIllegal,
+		"durationMs": 1.5, "violation": []interface{}{"stale read"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("file holds %v, want %v", got, want)
+	}
+}
+
+func TestWriteKeyFileCollidingKeys(t *testing.T) {
+	dir := t.TempDir()
+	keys := []string{"a/b", "a_b", "a%2Fb", "a:b"}
+	paths := make(map[string]bool)
+	for _, key := range keys {
+		path, err := writeKeyFile(dir, "run1.log", keyReport{Key: key, Status: statusOk})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if paths[path] {
+			t.Errorf("key %q is written to %s, like a key before it", key, path)
+		}
+		paths[path] = true
+	}
+	for path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got keyReport
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatal(err)
+		}
+		if want := filepath.Join(dir, safeFileName(got.Key)+".json"); path != want {
+			t.Errorf("%s holds key %q", path, got.Key)
+		}
+	}
+}
@@ -0,0 +1,474 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/anishathalye/porcupine"
+
+	"lcheck/checker"
+)
+
+// ================= Visualizations =================
+
+// Visualization formats of -viz-format
+const (
+	vizNone = "none"
+	vizHTML = "html" // porcupine's interactive page
+	vizSVG  = "svg"  // a static timeline of the linearization
+	vizJSON = "json" // the linearization as data, for post-processing
+	// Text diagrams of the linearization, to embed in docs
+	vizMermaid = "mermaid" // a Mermaid sequence diagram
+	vizDot     = "dot"     // a Graphviz graph
+)
+
+// vizExtensions maps the formats whose files are not named after them to
+// their file extension
+var vizExtensions = map[string]string{vizMermaid: "mmd"}
+
+// safeFileName percent-escapes the characters of a key that are unsafe in
+// file names, and '%' itself, so that "user:42/profile" is named
+// "user%3A42%2Fprofile". No two keys get the same name.
+func safeFileName(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		switch c := key[i]; c {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|', '%':
+			fmt.Fprintf(&b, "%%%02X", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// vizFileName returns the name of a key's visualization file.
+func vizFileName(key, format string, gzipped bool) string {
+	ext := format
+	if e, ok := vizExtensions[format]; ok {
+		ext = e
+	}
+	name := "output_" + safeFileName(key) + "." + ext
+	if gzipped {
+		name += ".gz"
+	}
+	return name
+}
+
+// writeViz writes the visualization of a linearizable key to dir in the
+// given format, gzip-compressed if gzipped is set, and returns its path.
+func writeViz(dir string, r checker.KeyResult, format string, gzipped bool) (string, error) {
+	path := filepath.Join(dir, vizFileName(r.Key, format, gzipped))
+	return path, writeVizFile(path, r, format, gzipped)
+}
+
+// writeFailureViz writes porcupine's page of the counterexample of a key
+// that is not linearizable, as Recheck checked it, to dir, and returns its
+// path. The page shows the partial linearizations porcupine found, and the
+// operations none of them could take.
+func writeFailureViz(dir string, slice checker.KeyResult, gzipped bool) (string, error) {
+	name := counterexampleFileName(slice.Key, vizHTML)
+	if gzipped {
+		name += ".gz"
+	}
+	path := filepath.Join(dir, name)
+	return path, writeVizFile(path, slice, vizHTML, gzipped)
+}
+
+// writeVizFile writes a key's visualization in the given format to path.
+func writeVizFile(path string, r checker.KeyResult, format string, gzipped bool) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	bw := bufio.NewWriter(f)
+	var w io.Writer = bw
+	var zw *gzip.Writer
+	if gzipped {
+		zw = gzip.NewWriter(bw)
+		w = zw
+	}
+	switch format {
+	case vizSVG:
+		err = writeSVG(w, r.Key, linearization(r))
+	case vizMermaid:
+		err = writeMermaid(w, r.Key, linearization(r))
+	case vizDot:
+		err = writeDot(w, r.Key, linearization(r))
+	case vizJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(keyLinearization{Key: r.Key, Operations: linearization(r)})
+	default:
+		err = r.Visualize(w)
+	}
+	if err != nil {
+		return err
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// counterexampleFileName returns the name of a key's counterexample file
+// with the given extension: the events as jsonl, or porcupine's page as html.
+func counterexampleFileName(key, ext string) string {
+	return "failure_" + safeFileName(key) + "." + ext
+}
+
+// writeCounterexample writes the events of a minimal failing slice of a key
+// that is not linearizable to dir, as JSON lines that -input=jsonl replays,
+// and returns its path.
+func writeCounterexample(dir, key string, events []porcupine.Event) (string, error) {
+	path := filepath.Join(dir, counterexampleFileName(key, "jsonl"))
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if err := checker.WriteJSONL(f, events); err != nil {
+		return "", err
+	}
+	return path, f.Close()
+}
+
+// writeCombinedViz writes output_all.html to outDir, holding the per-key
+// visualizations of keys in one self-contained file. Each page porcupine
+// generated is inlined through an iframe's srcdoc, so the pages keep their
+// own scripts and globals and don't collide, and the file can be shared
+// without the per-key files next to it. With gzipped set the per-key pages
+// are read, and the combined page written, gzip-compressed.
+func writeCombinedViz(outDir string, keys []string, gzipped bool) (string, error) {
+	wrapper := filepath.Join(outDir, "output_all.html")
+	if gzipped {
+		wrapper += ".gz"
+	}
+	fw, err := os.Create(wrapper)
+	if err != nil {
+		return "", err
+	}
+	defer fw.Close()
+
+	bw := bufio.NewWriter(fw)
+	var w io.Writer = bw
+	var zw *gzip.Writer
+	if gzipped {
+		zw = gzip.NewWriter(bw)
+		w = zw
+	}
+	fmt.Fprintln(w, "<!DOCTYPE html>")
+	fmt.Fprintln(w, "<html><head><meta charset=\"utf-8\"><title>Combined Visualization</title>")
+	fmt.Fprintln(w, "<style>iframe{width:100%;height:600px;border:1px solid #ccc;margin:10px 0;}</style>")
+	fmt.Fprintln(w, "</head><body>")
+	fmt.Fprintln(w, "<h1>Combined Visualization (per-key)</h1>")
+	for _, key := range keys {
+		page, err := readPage(filepath.Join(outDir, vizFileName(key, vizHTML, gzipped)), gzipped)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(w, "<h2>Key %s</h2>\n", html.EscapeString(key))
+		fmt.Fprintf(w, "<iframe srcdoc=\"%s\"></iframe>\n", html.EscapeString(string(page)))
+	}
+	fmt.Fprintln(w, "</body></html>")
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return "", err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return "", err
+	}
+	return wrapper, fw.Close()
+}
+
+// writeZip writes every file under dir into a new zip archive at path,
+// deflated and named by their paths relative to dir, and returns how many
+// files it holds. The combined page only refers to the per-key pages it
+// inlines, so it works from the archive as well.
+func writeZip(path, dir string) (int, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	n := 0
+	err = filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		hdr, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		hdr.Name, hdr.Method = filepath.ToSlash(rel), zip.Deflate
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		src, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		if _, err := io.Copy(w, src); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := zw.Close(); err != nil {
+		return 0, err
+	}
+	return n, f.Close()
+}
+
+// readPage reads a per-key page, decompressing it if gzipped is set.
+func readPage(path string, gzipped bool) ([]byte, error) {
+	if !gzipped {
+		return os.ReadFile(path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return io.ReadAll(zr)
+}
+
+// keyLinearization is the json visualization of a key
+type keyLinearization struct {
+	Key        string         `json:"key"`
+	Operations []linearizedOp `json:"operations"`
+}
+
+// linearizedOp is one operation of a key's linearization, as the svg and
+// json visualizations present it
+type linearizedOp struct {
+	// Step is the operation's position in the linearization
+	Step   int `json:"step"`
+	Client int `json:"client"`
+	// Call and Return are the time axis porcupine checks against: the
+	// positions of the operation's events in the key's history, or their
+	// timestamps in Unix nanoseconds if every event had one
+	Call        int64  `json:"call"`
+	Return      int64  `json:"return"`
+	Description string `json:"description"`
+	// State is the key's value after the operation
+	State string `json:"state"`
+	// CallTime and ReturnTime are the log timestamps, if the lines had any
+	CallTime   string `json:"callTime,omitempty"`
+	ReturnTime string `json:"returnTime,omitempty"`
+	// Pending marks an operation that never returned
+	Pending bool `json:"pending,omitempty"`
+}
+
+// linearization lists the operations of a linearizable key in linearization
+// order, with the key's state after each one.
+func linearization(r checker.KeyResult) []linearizedOp {
+	var ops []linearizedOp
+	for _, partials := range r.Info.PartialLinearizationsOperations() {
+		// A linearizable key's longest partial linearization is complete
+		var longest []porcupine.Operation
+		for _, partial := range partials {
+			if len(partial) > len(longest) {
+				longest = partial
+			}
+		}
+		state := r.Model.Init()
+		for _, op := range longest {
+			in, out := op.Input.(checker.InputOutput), op.Output.(checker.InputOutput)
+			_, state = r.Model.Step(state, in, out)
+			lop := linearizedOp{
+				Step:        len(ops),
+				Client:      op.ClientId,
+				Call:        op.Call,
+				Return:      op.Return,
+				Description: r.Model.DescribeOperation(in, out),
+				State:       describeState(r.Model, state),
+				CallTime:    timestamp(in.Time),
+				ReturnTime:  timestamp(out.Time),
+				Pending:     out.Pending,
+			}
+			ops = append(ops, lop)
+		}
+	}
+	return ops
+}
+
+// describeState renders a state the way porcupine does for a model that
+// does not describe its states
+func describeState(model porcupine.Model, state interface{}) string {
+	if model.DescribeState == nil {
+		return fmt.Sprint(state)
+	}
+	return model.DescribeState(state)
+}
+
+// timestamp formats a log timestamp, or returns "" if there was none
+func timestamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// Layout of the svg timeline, in pixels
+const (
+	svgStep     = 60 // width between two consecutive times
+	svgRow      = 36 // height of one client's row
+	svgBar      = 24 // height of an operation's bar
+	svgLabelCol = 90 // width of the client labels
+	svgMargin   = 10
+)
+
+// writeSVG draws a key's linearization as a static timeline: a row per
+// client, a bar per operation spanning its call and return, labeled with its
+// step in the linearization. Hovering a bar shows the key's state after it.
+func writeSVG(w io.Writer, key string, ops []linearizedOp) error {
+	var clients []int
+	row := make(map[int]int)
+	// Times are drawn by rank, so event positions and nanosecond
+	// timestamps give the same layout
+	rank := make(map[int64]int)
+	for _, op := range ops {
+		if _, ok := row[op.Client]; !ok {
+			row[op.Client] = 0
+			clients = append(clients, op.Client)
+		}
+		rank[op.Call], rank[op.Return] = 0, 0
+	}
+	sort.Ints(clients)
+	for i, c := range clients {
+		row[c] = i
+	}
+	times := make([]int64, 0, len(rank))
+	for t := range rank {
+		times = append(times, t)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	for i, t := range times {
+		rank[t] = i
+	}
+
+	width := svgLabelCol + len(times)*svgStep + 2*svgMargin
+	height := 2*svgRow + len(clients)*svgRow + svgMargin
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" font-family=\"monospace\" font-size=\"12\">\n", width, height)
+	fmt.Fprintf(bw, "<text x=\"%d\" y=\"%d\" font-size=\"14\">Key %s</text>\n", svgMargin, svgRow/2+svgMargin, html.EscapeString(key))
+	for _, c := range clients {
+		y := svgRow + row[c]*svgRow + svgMargin
+		fmt.Fprintf(bw, "<text x=\"%d\" y=\"%d\">client %d</text>\n", svgMargin, y+svgBar/2+4, c)
+	}
+	for _, op := range ops {
+		x := svgLabelCol + svgMargin + rank[op.Call]*svgStep
+		y := svgRow + row[op.Client]*svgRow + svgMargin
+		barWidth := max((rank[op.Return]-rank[op.Call])*svgStep, svgStep/2)
+		fill := "#b7e4c7"
+		if op.Pending {
+			fill = "#e9ecef"
+		}
+		fmt.Fprintf(bw, "<g><title>%s\n=&gt; %s</title>\n", html.EscapeString(op.Description), html.EscapeString(op.State))
+		fmt.Fprintf(bw, "<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" rx=\"3\" fill=\"%s\" stroke=\"#40916c\"/>\n", x, y, barWidth, svgBar, fill)
+		fmt.Fprintf(bw, "<text x=\"%d\" y=\"%d\">%d. %s</text></g>\n", x+4, y+svgBar/2+4, op.Step+1, html.EscapeString(op.Description))
+	}
+	fmt.Fprintln(bw, "</svg>")
+	return bw.Flush()
+}
+
+// mermaidText escapes the characters that end a statement of a Mermaid
+// diagram, or start an entity, as Mermaid entity codes.
+var mermaidText = strings.NewReplacer("#", "#35;", ";", "#59;", "\n", " ", "\r", " ")
+
+// writeMermaid writes a key's linearization as a Mermaid sequence diagram: a
+// participant per client and one for the key, and a numbered message per
+// operation in linearization order, answered by the key's state after it.
+// Operations that never returned are answered with a dashed cross.
+func writeMermaid(w io.Writer, key string, ops []linearizedOp) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "sequenceDiagram")
+	fmt.Fprintf(bw, "    title Key %s\n", mermaidText.Replace(key))
+	var clients []int
+	seen := make(map[int]bool)
+	for _, op := range ops {
+		if !seen[op.Client] {
+			seen[op.Client] = true
+			clients = append(clients, op.Client)
+		}
+	}
+	sort.Ints(clients)
+	for _, c := range clients {
+		fmt.Fprintf(bw, "    participant C%d as client %d\n", c, c)
+	}
+	fmt.Fprintln(bw, "    participant K as key")
+	for _, op := range ops {
+		fmt.Fprintf(bw, "    C%d->>K: %d. %s\n", op.Client, op.Step+1, mermaidText.Replace(op.Description))
+		reply := "-->>"
+		if op.Pending {
+			reply = "--x"
+		}
+		fmt.Fprintf(bw, "    K%sC%d: %s\n", reply, op.Client, mermaidText.Replace(op.State))
+	}
+	return bw.Flush()
+}
+
+// dotText escapes the characters that end or escape a Graphviz string, '"'
+// and '\', and turns line breaks into spaces, so that only the line breaks
+// of the label itself, written as \n, break lines.
+var dotText = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", " ", "\r", " ")
+
+// writeDot writes a key's linearization as a Graphviz digraph: a chain of
+// the operations in linearization order, each labeled with its client and
+// the key's state after it. Operations that never returned are dashed.
+func writeDot(w io.Writer, key string, ops []linearizedOp) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph linearization {")
+	fmt.Fprintf(bw, "  label=\"Key %s\";\n", dotText.Replace(key))
+	fmt.Fprintln(bw, "  node [shape=box, fontname=monospace];")
+	for _, op := range ops {
+		style := ""
+		if op.Pending {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(bw, "  op%d [label=\"%d. client %d: %s\\n=> %s\"%s];\n",
+			op.Step, op.Step+1, op.Client, dotText.Replace(op.Description), dotText.Replace(op.State), style)
+		if op.Step > 0 {
+			fmt.Fprintf(bw, "  op%d -> op%d;\n", op.Step-1, op.Step)
+		}
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
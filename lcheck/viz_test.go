@@ -0,0 +1,237 @@
+package main
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+
+	"lcheck/checker"
+)
+
+const vizLog = `Client_1 [Req:1] Setting k = a
+Client_2 [Req:1] Getting k
+Client_1 [Req:1] Set k = a
+Client_2 [Req:1] Get k = NONE
+`
+
+func checkVizLog(t *testing.T) checker.KeyResult {
+	t.Helper()
+	evs, _, err := checker.ParseLogFormat(strings.NewReader(vizLog), checker.DefaultFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := checker.CheckKeys([]string{"k"}, map[string][]porcupine.Event{"k": evs}, checker.Options{})
+	if res[0].Result != porcupine.Ok {
+		t.Fatalf("result = %v, want Ok", res[0].Result)
+	}
+	return res[0]
+}
+
+func TestWriteVizJSON(t *testing.T) {
+	path, err := writeViz(t.TempDir(), checkVizLog(t), vizJSON, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got keyLinearization
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	// The get overlaps the put and saw no value, so it is linearized first
+	want := []linearizedOp{
+		{Step: 0, Client: 2, Call: 1, Return: 3, Description: "get()=NONE", State: "NONE"},
+		{Step: 1, Client: 1, Call: 0, Return: 2, Description: "put(a)", State: "a"},
+	}
+	if got.Key != "k" || len(got.Operations) != len(want) {
+		t.Fatalf("got %+v", got)
+	}
+	for i := range want {
+		if got.Operations[i] != want[i] {
+			t.Errorf("operation %d = %+v, want %+v", i, got.Operations[i], want[i])
+		}
+	}
+}
+
+func TestWriteVizGzip(t *testing.T) {
+	path, err := writeViz(t.TempDir(), checkVizLog(t), vizHTML, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(path, "output_k.html.gz") {
+		t.Errorf("path = %s", path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := gzip.NewReader(f); err != nil {
+		t.Errorf("not gzip-compressed: %v", err)
+	}
+}
+
+func TestWriteVizDiagrams(t *testing.T) {
+	tests := []struct {
+		format, file string
+		want         []string
+	}{
+		{vizMermaid, "output_k.mmd", []string{
+			"sequenceDiagram",
+			"    C2->>K: 1. get()=NONE",
+			"    K-->>C2: NONE",
+			"    C1->>K: 2. put(a)",
+			"    K-->>C1: a",
+		}},
+		{vizDot, "output_k.dot", []string{
+			"digraph linearization {",
+			`  op0 [label="1. client 2: get()=NONE\n=> NONE"];`,
+			`  op1 [label="2. client 1: put(a)\n=> a"];`,
+			"  op0 -> op1;",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			path, err := writeViz(t.TempDir(), checkVizLog(t), tt.format, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasSuffix(path, tt.file) {
+				t.Errorf("path = %s, want %s", path, tt.file)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(string(data), "\n")
+			has := make(map[string]bool)
+			for _, l := range lines {
+				has[l] = true
+			}
+			for _, l := range tt.want {
+				if !has[l] {
+					t.Errorf("missing line %q in\n%s", l, data)
+				}
+			}
+		})
+	}
+}
+
+func TestMermaidText(t *testing.T) {
+	if got, want := mermaidText.Replace("put(a;b#1)"), "put(a#59;b#35;1)"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDotText(t *testing.T) {
+	// Only '"' and '\' are escaped: Graphviz would misread Go escapes such
+	// as \x01 or \l as its own
+	if got, want := dotText.Replace("put(\"a\\lb\x01\u00a0\nc\")"), `put(\"a\\lb`+"\x01\u00a0"+` c\")`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestWriteFailureViz(t *testing.T) {
+	log := `Client_1 [Req:1] Setting k = a
+Client_1 [Req:1] Set k = a
+Client_1 [Req:2] Setting k = b
+Client_1 [Req:2] Set k = b
+Client_2 [Req:1] Getting k
+Client_2 [Req:1] Get k = a
+`
+	evs, _, err := checker.ParseLogFormat(strings.NewReader(log), checker.DefaultFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := checker.CheckKeys([]string{"k"}, map[string][]porcupine.Event{"k": evs}, checker.Options{})[0]
+	if r.Result != porcupine.Illegal {
+		t.Fatalf("result = %v, want Illegal", r.Result)
+	}
+	slice := r.Recheck(r.Counterexample(0), 0)
+	if slice.Result != porcupine.Illegal || len(slice.Events) != 4 {
+		t.Fatalf("counterexample is %v with %d events, want Illegal with 4", slice.Result, len(slice.Events))
+	}
+	path, err := writeFailureViz(t.TempDir(), slice, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(path, "failure_k.html") {
+		t.Errorf("path = %s", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The put of a is dropped from the counterexample
+	for _, op := range []string{"put(b)", "get()=a"} {
+		if !strings.Contains(string(data), op) {
+			t.Errorf("page does not show %s", op)
+		}
+	}
+	if strings.Contains(string(data), "put(a)") {
+		t.Errorf("page shows put(a), which is not part of the counterexample")
+	}
+}
+
+func TestWriteZip(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "viz")
+	if err := os.MkdirAll(filepath.Join(dir, "log"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path, err := writeViz(filepath.Join(dir, "log"), checkVizLog(t), vizHTML, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writeCombinedViz(filepath.Join(dir, "log"), []string{"k"}, false); err != nil {
+		t.Fatal(err)
+	}
+	page, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive := filepath.Join(t.TempDir(), "results.zip")
+	n, err := writeZip(archive, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("archived %d files, want 2", n)
+	}
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+		if f.Method != zip.Deflate {
+			t.Errorf("%s is not deflated", f.Name)
+		}
+	}
+	if want := "log/output_all.html log/output_k.html"; strings.Join(names, " ") != want {
+		t.Errorf("archive holds %q, want %s", names, want)
+	}
+	f, err := zr.Open("log/output_k.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(page) {
+		t.Error("archived page differs from the one written")
+	}
+}
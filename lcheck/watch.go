@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/anishathalye/porcupine"
+
+	"lcheck/checker"
+)
+
+// ================= Watch mode =================
+
+// watchLog follows the log at path as it grows, and re-checks it every
+// interval in which operations completed. Only keys with new events are
+// checked again, since keys are independent and a key's result only changes
+// with its history. Operations still in flight are checked as ongoing, as
+// with -include-pending: a read may already see a write whose return isn't
+// logged yet. Watching ends on an interrupt, with the exit code of the last
+// verdict, as -timeout-policy counts it.
+func watchLog(path string, opts checkOptions, interval time.Duration) {
+	opts.IncludePending = true
+	tail := checker.NewTail(path, opts.Format)
+	fmt.Fprintf(out, "Watching %s for %s every %v (interrupt to stop)\n", path, property, interval)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	results := make(map[string]checker.KeyResult)
+	seen := make(map[string]int) // logged events per key at its last check
+	verdict := porcupine.Ok
+	missing := false
+	warned := 0 // parse warnings printed so far
+	for {
+		completed, reset, err := tail.Poll()
+		switch {
+		case os.IsNotExist(err):
+			// Rotation may leave the path missing for a moment
+			if !missing {
+				fmt.Fprintf(out, "Waiting for %s to appear...\n", path)
+				missing = true
+			}
+		case err != nil:
+			fmt.Fprintln(out, "Error:", err)
+			exit(1)
+		default:
+			missing = false
+			if reset {
+				fmt.Fprintf(out, "%s was truncated or replaced, checking it from the start\n", path)
+				results, seen = make(map[string]checker.KeyResult), make(map[string]int)
+				warned = 0
+			}
+			// A watched log has no end to group its warnings at, so they
+			// are printed as they are found
+			stats := tail.Stats()
+			for _, w := range stats.Warnings()[warned:] {
+				fmt.Fprintf(out, "Warning: %s (%s)\n", w.Message, w.Category)
+			}
+			warned = len(stats.Warnings())
+			if completed > 0 || reset {
+				verdict = recheck(tail.Events(), opts, results, seen)
+			}
+		}
+
+		select {
+		case <-stop:
+			fmt.Fprintf(out, "Stopped watching %s: %s\n", path, verdictText(verdict))
+			switch verdict {
+			case porcupine.Illegal:
+				exit(exitNotLinearizable)
+			case porcupine.Unknown:
+				if opts.timeoutPolicy == policyFail {
+					exit(exitTimeout)
+				}
+			}
+			exit(exitOk)
+		case <-ticker.C:
+		}
+	}
+}
+
+// recheck checks the keys of events whose history changed since their
+// last check, printing the keys whose result changed and a line for the
+// whole log. It returns the log's verdict.
+func recheck(events []porcupine.Event, opts checkOptions, results map[string]checker.KeyResult, seen map[string]int) porcupine.CheckResult {
+	events, _ = checker.SelectClients(events, opts.Clients)
+	finished, pending := checker.SplitUnfinished(events)
+	grouped := checker.SplitEventsByKey(append(events[:len(events):len(events)], checker.PendingReturns(pending)...))
+	keys, _ := checker.SelectKeys(checker.SortedKeys(grouped), opts.Keys)
+	keys, _ = checker.ExcludeKeys(keys, opts.ExcludeKeys)
+
+	// Count the logged events only: an operation completing replaces the
+	// synthesized return of its call, leaving the total unchanged
+	logged := make(map[string]int)
+	for _, ev := range events {
+		logged[ev.Value.(checker.InputOutput).Key]++
+	}
+	var changed []string
+	for _, k := range keys {
+		if logged[k] != seen[k] {
+			changed = append(changed, k)
+			seen[k] = logged[k]
+		}
+	}
+	for _, r := range checker.CheckKeys(changed, grouped, opts.Options) {
+		prev, checked := results[r.Key]
+		results[r.Key] = r
+		if checked && prev.Result == r.Result && prev.Skipped == r.Skipped && (prev.Err == nil) == (r.Err == nil) {
+			continue
+		}
+		switch {
+		case r.Skipped:
+			printColored(colorYellow, "Key %s: skipped (too large, over %d events)", r.Key, opts.MaxEvents)
+		case r.Err != nil:
+			printColored(colorRed, "Key %s: %v", r.Key, r.Err)
+		case r.Result == porcupine.Ok:
+			printColored(colorGreen, "Key %s: %s", r.Key, satisfies)
+		case r.Result == porcupine.Illegal:
+			printColored(colorRed, "Key %s: NOT %s", r.Key, satisfies)
+			for _, line := range r.Violation().Lines() {
+				fmt.Fprintf(out, "Key %s: %s\n", r.Key, line)
+			}
+		default:
+			printColored(colorYellow, "Key %s: check timed out (Unknown)", r.Key)
+		}
+	}
+
+	all := make([]checker.KeyResult, 0, len(keys))
+	for _, k := range keys {
+		all = append(all, results[k])
+	}
+	verdict := checker.Verdict(all)
+	fmt.Fprintf(out, "[%s] %d operations completed, %d in flight, %d keys (%d re-checked): %s\n",
+		time.Now().Format("15:04:05"), len(finished)/2, len(pending), len(keys), len(changed), verdictText(verdict))
+	return verdict
+}
+
+// verdictText describes a verdict of the property being checked
+func verdictText(v porcupine.CheckResult) string {
+	switch v {
+	case porcupine.Ok:
+		return satisfies
+	case porcupine.Illegal:
+		return "NOT " + satisfies
+	}
+	return "Unknown (a key timed out or was skipped)"
+}